@@ -0,0 +1,283 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+	mt "github.com/saeidalz13/battleship-backend/models/tournament"
+)
+
+// Used when a kick or a termination comes without a reason
+const defaultAdminReason = "ended by an operator"
+
+type RespAdminError struct {
+	Error string `json:"error"`
+}
+
+type RespAdminSession struct {
+	// Hashed, the same as `session` in the logs
+	Id          string `json:"id"`
+	RemoteAddr  string `json:"remote_addr"`
+	GameUuid    string `json:"game_uuid,omitempty"`
+	PlayerUuid  string `json:"player_uuid,omitempty"`
+	AgeSeconds  int64  `json:"age_seconds"`
+	IdleSeconds int64  `json:"idle_seconds"`
+}
+
+type RespAdminPlayer struct {
+	Uuid        string `json:"uuid"`
+	IsHost      bool   `json:"is_host"`
+	IsReady     bool   `json:"is_ready"`
+	IsTurn      bool   `json:"is_turn"`
+	SunkenShips uint8  `json:"sunken_ships"`
+	MatchStatus uint8  `json:"match_status"`
+
+	// Only in the state of a single game. Not a Grid, which
+	// encoding/json would write as base64 strings.
+	AttackGrid [][]int `json:"attack_grid,omitempty"`
+}
+
+type RespAdminGame struct {
+	Uuid       string            `json:"uuid"`
+	Difficulty string            `json:"difficulty"`
+	Phase      string            `json:"phase"`
+	Players    []RespAdminPlayer `json:"players"`
+
+	// Only in the state of a single game
+	GridSize  uint8      `json:"grid_size,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+type ReqAdminAction struct {
+	Reason string `json:"reason"`
+}
+
+// Names in the order of their seeds, the best first
+type ReqAdminCreateTournament struct {
+	Format     string   `json:"format"`
+	Difficulty uint8    `json:"difficulty"`
+	Players    []string `json:"players"`
+}
+
+// The seat tokens are handed to the players; each one takes
+// its holder into their next match
+type RespAdminTournament struct {
+	Standings mt.Standings `json:"standings"`
+	Entrants  []mt.Entrant `json:"entrants"`
+}
+
+type adminHandler struct {
+	sessionManager mc.SessionManager
+	gameManager    mb.GameManager
+	tournaments    mt.TournamentManager
+	token          []byte
+}
+
+/*
+NewAdminHandler serves the admin API. Every request needs an
+`Authorization: Bearer <token>` header. It is meant to be
+mounted on its own listener, away from the public port.
+
+	GET    /admin/sessions
+	POST   /admin/sessions/{id}/kick   {"reason": "..."}
+	GET    /admin/games
+	GET    /admin/games/{uuid}
+	DELETE /admin/games/{uuid}         {"reason": "..."}
+	POST   /admin/tournaments          {"format": "...", "difficulty": 0, "players": ["..."]}
+	GET    /admin/tournaments/{uuid}
+*/
+func NewAdminHandler(sessionManager mc.SessionManager, gameManager mb.GameManager, tournaments mt.TournamentManager, token string) http.Handler {
+	if token == "" {
+		panic("admin token must not be empty")
+	}
+
+	ah := adminHandler{sessionManager: sessionManager, gameManager: gameManager, tournaments: tournaments, token: []byte(token)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/sessions", ah.listSessions)
+	mux.HandleFunc("POST /admin/sessions/{id}/kick", ah.kickSession)
+	mux.HandleFunc("GET /admin/games", ah.listGames)
+	mux.HandleFunc("GET /admin/games/{uuid}", ah.inspectGame)
+	mux.HandleFunc("DELETE /admin/games/{uuid}", ah.terminateGame)
+	mux.HandleFunc("POST /admin/tournaments", ah.createTournament)
+	mux.HandleFunc("GET /admin/tournaments/{uuid}", ah.inspectTournament)
+
+	return ah.authenticate(mux)
+}
+
+func (ah adminHandler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), ah.token) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, RespAdminError{Error: "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (ah adminHandler) listSessions(w http.ResponseWriter, r *http.Request) {
+	infos := ah.sessionManager.ListSessions()
+
+	sessions := make([]RespAdminSession, 0, len(infos))
+	for _, info := range infos {
+		sessions = append(sessions, RespAdminSession{
+			Id:          info.Id,
+			RemoteAddr:  info.RemoteAddr,
+			GameUuid:    info.GameUuid,
+			PlayerUuid:  info.PlayerUuid,
+			AgeSeconds:  int64(info.Age.Seconds()),
+			IdleSeconds: int64(info.Idle.Seconds()),
+		})
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (ah adminHandler) kickSession(w http.ResponseWriter, r *http.Request) {
+	reason, ok := readAdminReason(w, r)
+	if !ok {
+		return
+	}
+
+	if err := ah.sessionManager.KickSession(r.PathValue("id"), reason, ah.gameManager); err != nil {
+		writeJSON(w, http.StatusNotFound, RespAdminError{Error: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ah adminHandler) listGames(w http.ResponseWriter, r *http.Request) {
+	all := ah.gameManager.ListGames()
+
+	games := make([]RespAdminGame, 0, len(all))
+	for _, game := range all {
+		games = append(games, newRespAdminGame(game, false))
+	}
+	writeJSON(w, http.StatusOK, games)
+}
+
+func (ah adminHandler) inspectGame(w http.ResponseWriter, r *http.Request) {
+	game, err := ah.gameManager.FetchGame(r.PathValue("uuid"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, RespAdminError{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, newRespAdminGame(game, true))
+}
+
+func (ah adminHandler) terminateGame(w http.ResponseWriter, r *http.Request) {
+	reason, ok := readAdminReason(w, r)
+	if !ok {
+		return
+	}
+
+	if err := ah.sessionManager.EndGame(r.PathValue("uuid"), reason, ah.gameManager); err != nil {
+		writeJSON(w, http.StatusNotFound, RespAdminError{Error: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ah adminHandler) createTournament(w http.ResponseWriter, r *http.Request) {
+	var req ReqAdminCreateTournament
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8192)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, RespAdminError{Error: "invalid body: " + err.Error()})
+		return
+	}
+
+	tournament, err := ah.tournaments.CreateTournament(req.Format, req.Difficulty, req.Players)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, RespAdminError{Error: err.Error()})
+		return
+	}
+	ah.writeTournament(w, http.StatusCreated, tournament)
+}
+
+func (ah adminHandler) inspectTournament(w http.ResponseWriter, r *http.Request) {
+	tournament, err := ah.tournaments.FetchTournament(r.PathValue("uuid"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, RespAdminError{Error: err.Error()})
+		return
+	}
+	ah.writeTournament(w, http.StatusOK, tournament)
+}
+
+func (ah adminHandler) writeTournament(w http.ResponseWriter, status int, tournament mt.Tournament) {
+	standings, err := ah.tournaments.FetchStandings(tournament.Uuid)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, RespAdminError{Error: err.Error()})
+		return
+	}
+	writeJSON(w, status, RespAdminTournament{Standings: standings, Entrants: tournament.Entrants})
+}
+
+// The body is optional
+func readAdminReason(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req ReqAdminAction
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, RespAdminError{Error: "invalid body: " + err.Error()})
+			return "", false
+		}
+	}
+
+	if req.Reason == "" {
+		return defaultAdminReason, true
+	}
+	return req.Reason, true
+}
+
+func gridToInts(grid mb.Grid) [][]int {
+	rows := make([][]int, len(grid))
+	for i, row := range grid {
+		rows[i] = make([]int, len(row))
+		for j, cell := range row {
+			rows[i][j] = int(cell)
+		}
+	}
+	return rows
+}
+
+// Never includes the defence grids; they reveal the ships. Built
+// from a snapshot, so it does not race with the loops of the game.
+func newRespAdminGame(game *mb.Game, withState bool) RespAdminGame {
+	snapshot := game.Snapshot()
+	resp := RespAdminGame{
+		Uuid:       snapshot.Uuid,
+		Difficulty: mb.DifficultyName(snapshot.Difficulty),
+		Phase:      snapshot.Phase,
+		Players:    make([]RespAdminPlayer, 0, 2),
+	}
+
+	for _, player := range []*mb.PlayerSnapshot{snapshot.HostPlayer, snapshot.JoinPlayer} {
+		if player == nil {
+			continue
+		}
+		respPlayer := RespAdminPlayer{
+			Uuid:        player.Uuid,
+			IsHost:      player.IsHost,
+			IsReady:     player.IsReady,
+			IsTurn:      player.IsTurn,
+			SunkenShips: player.SunkenShips,
+			MatchStatus: player.MatchStatus,
+		}
+		if withState {
+			respPlayer.AttackGrid = gridToInts(mb.Grid(player.AttackGrid))
+		}
+		resp.Players = append(resp.Players, respPlayer)
+	}
+
+	if withState {
+		resp.GridSize = snapshot.GridSize
+		if !snapshot.StartedAt.IsZero() {
+			resp.StartedAt = &snapshot.StartedAt
+		}
+	}
+	return resp
+}
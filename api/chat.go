@@ -0,0 +1,107 @@
+package api
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/saeidalz13/battleship-backend/internal/clock"
+	"github.com/saeidalz13/battleship-backend/internal/ratelimit"
+)
+
+// Zero for the rate disables the chat limit of a session
+type ChatConfig struct {
+	// In characters, not bytes
+	MaxLength int
+
+	// Token bucket of the chat messages and emotes of a
+	// session, on top of RateLimitConfig
+	MessagesPerSecond float64
+	MessageBurst      int
+
+	// Masked by the default filter, case insensitive
+	BlockedWords []string
+}
+
+func DefaultChatConfig() ChatConfig {
+	return ChatConfig{
+		MaxLength:         200,
+		MessagesPerSecond: 0.5,
+		MessageBurst:      5,
+	}
+}
+
+func (cfg ChatConfig) newSessionLimiter(clk clock.Clock) *ratelimit.TokenBucket {
+	if cfg.MessagesPerSecond <= 0 || cfg.MessageBurst <= 0 {
+		return nil
+	}
+	return ratelimit.NewTokenBucket(cfg.MessagesPerSecond, cfg.MessageBurst, clk)
+}
+
+// Cleans up a chat message before the opponent gets it.
+// Plug in another one with RequestProcessor.WithProfanityFilter.
+type ProfanityFilter interface {
+	Filter(text string) string
+}
+
+// Replaces every letter of a blocked word with an asterisk.
+// Only whole words match, so "class" survives "ass".
+type WordListFilter struct {
+	words map[string]struct{}
+}
+
+var _ ProfanityFilter = (*WordListFilter)(nil)
+
+func NewWordListFilter(words []string) *WordListFilter {
+	wlf := &WordListFilter{words: make(map[string]struct{}, len(words))}
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			wlf.words[strings.ToLower(word)] = struct{}{}
+		}
+	}
+	return wlf
+}
+
+func (wlf *WordListFilter) Filter(text string) string {
+	if len(wlf.words) == 0 {
+		return text
+	}
+
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			start++
+			continue
+		}
+
+		end := start
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		if _, blocked := wlf.words[strings.ToLower(string(runes[start:end]))]; blocked {
+			for i := start; i < end; i++ {
+				runes[i] = '*'
+			}
+		}
+		start = end
+	}
+	return string(runes)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// The filter is built from the blocked words unless one was
+// plugged in with WithProfanityFilter before
+func (rp RequestProcessor) WithChatConfig(cfg ChatConfig) RequestProcessor {
+	rp.chat = cfg
+	if _, isDefault := rp.profanityFilter.(*WordListFilter); isDefault || rp.profanityFilter == nil {
+		rp.profanityFilter = NewWordListFilter(cfg.BlockedWords)
+	}
+	return rp
+}
+
+func (rp RequestProcessor) WithProfanityFilter(filter ProfanityFilter) RequestProcessor {
+	rp.profanityFilter = filter
+	return rp
+}
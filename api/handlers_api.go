@@ -1,36 +1,51 @@
 package api
 
 import (
-	"encoding/json"
+	"strings"
+	"unicode/utf8"
 
 	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	"github.com/saeidalz13/battleship-backend/internal/ratelimit"
 	mb "github.com/saeidalz13/battleship-backend/models/battleship"
 	mc "github.com/saeidalz13/battleship-backend/models/connection"
+	mt "github.com/saeidalz13/battleship-backend/models/tournament"
 )
 
 type RequestHandler interface {
 	HandleCreateGame(gm mb.GameManager, sessionId string) (*mb.Game, mb.Player, mc.Message[mc.RespCreateGame])
-	HandleReadyPlayer(gm mb.GameManager, sessionGame *mb.Game, sessionPlayer mb.Player) mc.Message[mc.NoPayload]
-	HandleJoinPlayer(gm mb.GameManager, sessionId string) (*mb.Game, mb.Player, mc.Message[mc.RespJoinGame])
+	HandleReadyPlayer(gm mb.GameManager, sessionGame *mb.Game, sessionPlayer mb.Player) mc.Message[mc.RespReady]
+	HandleJoinPlayer(gm mb.GameManager, tm mt.TournamentManager, sessionId string) (*mb.Game, mb.Player, mc.Message[mc.RespJoinGame])
 	HandleAttack(*mb.Game, mb.Player, mb.Player, mb.GameManager) mc.Message[mc.RespAttack]
-	HandleCallRematch(bgm mb.GameManager, sessionGame *mb.Game) (mc.Message[mc.NoPayload], error)
-	HandleAcceptRematchCall(bgm mb.GameManager, sessionGame *mb.Game, sessionPlayer, otherSessionPlayer mb.Player) (mc.Message[mc.RespRematch], mc.Message[mc.RespRematch], error)
+	HandleBomb(game *mb.Game, attacker, defender mb.Player, gm mb.GameManager) mc.Message[mc.RespSpecialAttack]
+	HandleTorpedo(game *mb.Game, attacker, defender mb.Player, gm mb.GameManager) mc.Message[mc.RespSpecialAttack]
+	HandleSonar(game *mb.Game, attacker, defender mb.Player, gm mb.GameManager) mc.Message[mc.RespSonar]
+	HandleCallRematch(bgm mb.GameManager, tm mt.TournamentManager, sessionGame *mb.Game) (mc.Message[mc.NoPayload], error)
+	HandleAcceptRematchCall(bgm mb.GameManager, tm mt.TournamentManager, sessionGame *mb.Game, sessionPlayer, otherSessionPlayer mb.Player) (mc.Message[mc.RespRematch], mc.Message[mc.RespRematch], error)
+	HandleReplayEvents(session *mc.Session) ([]interface{}, mc.Message[mc.RespReplayEvents])
+	HandleChat(opponent mb.Player, limiter *ratelimit.TokenBucket, maxLength int, filter ProfanityFilter) mc.Message[mc.RespChat]
+	HandleEmote(opponent mb.Player, limiter *ratelimit.TokenBucket) mc.Message[mc.RespEmote]
+	HandleMuteOpponent(sessionPlayer mb.Player) mc.Message[mc.RespMuteOpponent]
+	HandleJoinTournamentMatch(tm mt.TournamentManager, sessionId string) (mt.Seat, mc.Message[mc.RespJoinTournamentMatch])
+	HandleTournamentStandings(tm mt.TournamentManager) mc.Message[mc.RespTournamentStandings]
 }
 
 // Every incoming valid request will have this structure
 // The request then is handled in line with WsRequestHandler interface
 type Request struct {
 	payload []byte
+	codec   mc.Codec
 }
 
 // This tells the compiler that WsRequest struct must be of type of WsRequestHandler
 var _ RequestHandler = (*Request)(nil)
 
-func NewRequest(payloads ...[]byte) Request {
+// The codec is the one negotiated for the session that
+// sent the request and is used to decode its payload
+func NewRequest(codec mc.Codec, payloads ...[]byte) Request {
 	if len(payloads) > 1 {
 		panic("request cannot accept more than one payload")
 	}
-	r := Request{}
+	r := Request{codec: codec}
 	if len(payloads) == 1 {
 		r.payload = payloads[0]
 	}
@@ -41,63 +56,147 @@ func (r Request) HandleCreateGame(gm mb.GameManager, sessionId string) (*mb.Game
 	var reqCreateGame mc.Message[mc.ReqCreateGame]
 	respMsg := mc.NewMessage[mc.RespCreateGame](mc.CodeCreateGame)
 
-	if err := json.Unmarshal(r.payload, &reqCreateGame); err != nil {
-		respMsg.AddError(err.Error(), cerr.ConstErrInvalidPayload)
+	if err := r.codec.Unmarshal(r.payload, &reqCreateGame); err != nil {
+		respMsg.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
 		return nil, nil, respMsg
 	}
 
 	game, err := gm.CreateGame(reqCreateGame.Payload.GameDifficulty)
 	if err != nil {
-		respMsg.AddError(err.Error(), cerr.ConstErrCreateGame)
+		respMsg.AddError(err, cerr.ConstErrCreateGame)
 		return nil, nil, respMsg
 	}
 
-	hostPlayer := game.CreateHostPlayer(sessionId)
+	bestOf := reqCreateGame.Payload.BestOf
+	if bestOf == 0 {
+		bestOf = mb.SeriesLengthSingle
+	}
+	if err := game.SetSeriesLength(bestOf); err != nil {
+		gm.TerminateGame(game.Uuid())
+		respMsg.AddError(err, cerr.ConstErrCreateGame)
+		return nil, nil, respMsg
+	}
 
-	respMsg.AddPayload(mc.RespCreateGame{GameUuid: game.Uuid(), HostUuid: hostPlayer.Uuid()})
+	firstTurnPolicy := reqCreateGame.Payload.FirstTurn
+	if firstTurnPolicy == "" {
+		firstTurnPolicy = mb.DefaultFirstTurnPolicy(bestOf)
+	}
+	if err := game.SetFirstTurnPolicy(firstTurnPolicy); err != nil {
+		gm.TerminateGame(game.Uuid())
+		respMsg.AddError(err, cerr.ConstErrCreateGame)
+		return nil, nil, respMsg
+	}
+	ruleset := mb.Ruleset{SpecialWeapons: reqCreateGame.Payload.SpecialWeapons, Disclosure: reqCreateGame.Payload.Disclosure}
+	if err := game.SetRuleset(ruleset); err != nil {
+		gm.TerminateGame(game.Uuid())
+		respMsg.AddError(err, cerr.ConstErrCreateGame)
+		return nil, nil, respMsg
+	}
+
+	hostPlayer := game.CreateHostPlayer(sessionId)
+	gm.SaveGame(game)
+
+	respMsg.AddPayload(mc.RespCreateGame{
+		GameUuid:       game.Uuid(),
+		HostUuid:       hostPlayer.Uuid(),
+		BestOf:         bestOf,
+		FirstTurn:      firstTurnPolicy,
+		SpecialWeapons: game.Ruleset().SpecialWeapons,
+		Disclosure:     game.Ruleset().Disclosure,
+	})
 	return game, hostPlayer, respMsg
 }
 
 // Join user sends the game uuid and if this game exists,
 // a new join player is created and added to the database
-func (r Request) HandleJoinPlayer(gm mb.GameManager, sessionId string) (*mb.Game, mb.Player, mc.Message[mc.RespJoinGame]) {
+// Tournament games can only be joined with a seat token
+func (r Request) HandleJoinPlayer(gm mb.GameManager, tm mt.TournamentManager, sessionId string) (*mb.Game, mb.Player, mc.Message[mc.RespJoinGame]) {
 	var joinGameReq mc.Message[mc.ReqJoinGame]
 	respMsg := mc.NewMessage[mc.RespJoinGame](mc.CodeJoinGame)
 
-	if err := json.Unmarshal(r.payload, &joinGameReq); err != nil {
-		respMsg.AddError(err.Error(), cerr.ConstErrInvalidPayload)
+	if err := r.codec.Unmarshal(r.payload, &joinGameReq); err != nil {
+		respMsg.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
 		return nil, nil, respMsg
 	}
 
 	game, err := gm.FetchGame(joinGameReq.Payload.GameUuid)
 	if err != nil {
-		respMsg.AddError(err.Error(), cerr.ConstErrJoin)
+		respMsg.AddError(err, cerr.ConstErrJoin)
+		return nil, nil, respMsg
+	}
+	if tm.IsTournamentGame(game.Uuid()) {
+		respMsg.AddError(cerr.ErrTournamentGame(game.Uuid()), cerr.ConstErrJoin)
 		return nil, nil, respMsg
 	}
 
 	joinPlayer := game.CreateJoinPlayer(sessionId)
-
-	respMsg.AddPayload(mc.RespJoinGame{GameUuid: game.Uuid(), PlayerUuid: joinPlayer.Uuid(), GameDifficulty: game.Difficulty()})
+	gm.SaveGame(game)
+
+	respMsg.AddPayload(mc.RespJoinGame{
+		GameUuid:       game.Uuid(),
+		PlayerUuid:     joinPlayer.Uuid(),
+		GameDifficulty: game.Difficulty(),
+		BestOf:         game.Series().BestOf,
+		FirstTurn:      game.FirstTurnPolicy(),
+		SpecialWeapons: game.Ruleset().SpecialWeapons,
+		Disclosure:     game.Ruleset().Disclosure,
+	})
 	return game, joinPlayer, respMsg
 }
 
+// The node that owns the game the join request is for, if
+// that is not this one. Errors are left to HandleJoinPlayer.
+func (r Request) RemoteGameOwner(gm mb.GameManager) (string, bool) {
+	var joinGameReq mc.Message[mc.ReqJoinGame]
+	if err := r.codec.Unmarshal(r.payload, &joinGameReq); err != nil {
+		return "", false
+	}
+	if _, err := gm.FetchGame(joinGameReq.Payload.GameUuid); err == nil {
+		return "", false
+	}
+
+	ownerNodeId, err := gm.GameOwner(joinGameReq.Payload.GameUuid)
+	if err != nil || ownerNodeId == gm.NodeId() {
+		return "", false
+	}
+	return ownerNodeId, true
+}
+
 // User will choose the configurations of ships on defence grid.
-// Then the grid is sent to backend and adjustment happens accordingly.
-func (r Request) HandleReadyPlayer(bgm mb.GameManager, game *mb.Game, sessionPlayer mb.Player) mc.Message[mc.NoPayload] {
+// Then the grid, or the placements of the ships, is sent to backend
+// and adjustment happens accordingly.
+func (r Request) HandleReadyPlayer(bgm mb.GameManager, game *mb.Game, sessionPlayer mb.Player) mc.Message[mc.RespReady] {
 	var readyPlayerReq mc.Message[mc.ReqReadyPlayer]
-	resp := mc.NewMessage[mc.NoPayload](mc.CodeReady)
+	resp := mc.NewMessage[mc.RespReady](mc.CodeReady)
 
-	if err := json.Unmarshal(r.payload, &readyPlayerReq); err != nil {
-		resp.AddError(err.Error(), cerr.ConstErrInvalidPayload)
+	if err := r.codec.Unmarshal(r.payload, &readyPlayerReq); err != nil {
+		resp.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
 		return resp
 	}
 
-	// Check to see if rows and cols are equal to game's grid size
-	if err := game.SetPlayerReadyForGame(sessionPlayer, readyPlayerReq.Payload.DefenceGrid); err != nil {
-		resp.AddError(err.Error(), cerr.ConstErrReady)
+	if game == nil || sessionPlayer == nil {
+		resp.AddError(cerr.ErrGameNotExists(""), cerr.ConstErrReady)
 		return resp
 	}
 
+	defenceGrid := readyPlayerReq.Payload.DefenceGrid
+	if len(readyPlayerReq.Payload.Placements) != 0 {
+		expanded, err := game.ExpandPlacements(readyPlayerReq.Payload.Placements)
+		if err != nil {
+			resp.AddError(err, cerr.ConstErrReady)
+			return resp
+		}
+		defenceGrid = expanded
+	}
+
+	// Check to see if the grid has the game's size and a valid fleet
+	if err := game.SetPlayerReadyForGame(sessionPlayer, defenceGrid); err != nil {
+		resp.AddError(err, cerr.ConstErrReady)
+		return resp
+	}
+
+	resp.AddPayload(mc.RespReady{DefenceGrid: defenceGrid})
+	bgm.SaveGame(game)
 	return resp
 }
 
@@ -106,110 +205,452 @@ func (r Request) HandleAttack(game *mb.Game, attacker mb.Player, defender mb.Pla
 	var reqAttack mc.Message[mc.ReqAttack]
 	resp := mc.NewMessage[mc.RespAttack](mc.CodeAttack)
 
-	if err := json.Unmarshal(r.payload, &reqAttack); err != nil {
-		resp.AddError(err.Error(), cerr.ConstErrInvalidPayload)
+	if err := r.codec.Unmarshal(r.payload, &reqAttack); err != nil {
+		resp.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
 		return resp
 	}
 
 	coordinates := mb.NewCoordinates(reqAttack.Payload.X, reqAttack.Payload.Y)
 	if !game.AreAttackCoordinatesValid(coordinates) {
-		resp.AddError(cerr.ErrXorYOutOfGridBound(coordinates.X, coordinates.Y).Error(), cerr.ConstErrAttack)
+		resp.AddError(cerr.ErrXorYOutOfGridBound(coordinates.X, coordinates.Y), cerr.ConstErrAttack)
 		return resp
 	}
 
 	// Attack validity check
 	if !attacker.IsTurn() {
-		resp.AddError(cerr.ErrNotTurnForAttacker(attacker.Uuid()).Error(), cerr.ConstErrAttack)
+		resp.AddError(cerr.ErrNotTurnForAttacker(attacker.Uuid()), cerr.ConstErrAttack)
 		return resp
 	}
 
 	if !attacker.IsAttackGridEmptyInCoordinates(coordinates) {
-		resp.AddError(cerr.ErrAttackPositionAlreadyFilled(coordinates.X, coordinates.Y).Error(), cerr.ConstErrAttack)
+		resp.AddError(cerr.ErrAttackPositionAlreadyFilled(coordinates.X, coordinates.Y), cerr.ConstErrAttack)
 		return resp
 	}
 
 	if defender.IsDefenceGridAlreadyHitInCoordinates(coordinates) {
-		resp.AddError(cerr.ErrDefenceGridPositionAlreadyHit(coordinates.X, coordinates.Y).Error(), cerr.ConstErrAttack)
+		resp.AddError(cerr.ErrDefenceGridPositionAlreadyHit(coordinates.X, coordinates.Y), cerr.ConstErrAttack)
 		return resp
 	}
 
 	attacker.SetTurnFalse()
 	defender.SetTurnTrue()
+	strike := strikeCell(game, attacker, defender, coordinates)
 
-	hostPlayer := game.HostPlayer()
-	joinPlayer := game.JoinPlayer()
+	// The rules of the game decide what else the players learn
+	ruleset := game.Ruleset()
+	resp.AddPayload(mc.RespAttack{
+		X:             coordinates.X,
+		Y:             coordinates.Y,
+		PositionState: strike.positionState,
+		IsTurn:        attacker.IsTurn(),
+	})
+	if ruleset.RevealsShipType() {
+		resp.Payload.ShipCode = strike.shipCode
+	}
+	if ruleset.RevealsSinking() {
+		resp.Payload.SunkenShipsHost = game.HostPlayer().SunkenShips()
+		resp.Payload.SunkenShipsJoin = game.JoinPlayer().SunkenShips()
+		resp.Payload.DefenderSunkenShipsCoords = strike.sunkenShipCoords
+	}
+	gm.SaveGame(game)
+	return resp
+}
+
+type strike struct {
+	positionState uint8
+	// 0 for a miss
+	shipCode uint8
+	// Of the ship it sank, if any
+	sunkenShipCoords []mb.Coordinates
+}
 
+// Fires at a cell the attacker has not attacked yet. Sinking
+// the last ship wins the game.
+func strikeCell(game *mb.Game, attacker, defender mb.Player, coordinates mb.Coordinates) strike {
 	if defender.IsAttackMiss(coordinates) {
 		attacker.SetAttackGridToMiss(coordinates)
-
-		resp.AddPayload(mc.RespAttack{
-			X:               coordinates.X,
-			Y:               coordinates.Y,
-			PositionState:   mb.PositionStateAttackGridMiss,
-			SunkenShipsHost: hostPlayer.SunkenShips(),
-			SunkenShipsJoin: joinPlayer.SunkenShips(),
-			IsTurn:          attacker.IsTurn(),
-		})
-		return resp
+		return strike{positionState: mb.PositionStateAttackGridMiss}
 	}
 
 	shipCode := defender.ShipCode(coordinates)
 	defender.IncrementShipHit(shipCode, coordinates)
 	attacker.SetAttackGridToHit(coordinates)
+	if !defender.IsShipSunken(shipCode) {
+		return strike{positionState: mb.PositionStateAttackGridHit, shipCode: shipCode}
+	}
 
-	// Initialize the response payload
-	resp.AddPayload(mc.RespAttack{
-		X:             coordinates.X,
-		Y:             coordinates.Y,
-		PositionState: mb.PositionStateAttackGridHit,
-		IsTurn:        attacker.IsTurn(),
-	})
+	defender.IncrementSunkenShips()
+	// Check if this sunken ship was the last one and the attacker is lost
+	if defender.AreAllShipsSunken() {
+		defender.SetMatchStatusToLost()
+		attacker.SetMatchStatusToWon()
+		game.RecordWin(attacker.IsHost())
+	}
+	return strike{positionState: mb.PositionStateAttackGridHit, shipCode: shipCode, sunkenShipCoords: defender.ShipHitCoordinates(shipCode)}
+}
+
+func (r Request) HandleBomb(game *mb.Game, attacker, defender mb.Player, gm mb.GameManager) mc.Message[mc.RespSpecialAttack] {
+	var reqBomb mc.Message[mc.ReqBomb]
+	resp := mc.NewMessage[mc.RespSpecialAttack](mc.CodeBomb)
+
+	if err := r.codec.Unmarshal(r.payload, &reqBomb); err != nil {
+		resp.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
+		return resp
+	}
+
+	if err := checkOpponent(game, defender); err != nil {
+		resp.AddError(err, cerr.ConstErrSpecialAttack)
+		return resp
+	}
+	center := mb.NewCoordinates(reqBomb.Payload.X, reqBomb.Payload.Y)
+	if !game.AreAttackCoordinatesValid(center) {
+		resp.AddError(cerr.ErrXorYOutOfGridBound(center.X, center.Y), cerr.ConstErrSpecialAttack)
+		return resp
+	}
+
+	return fireSpecialAttack(resp, game, attacker, defender, gm, mb.WeaponBomb, game.SquareArea(center))
+}
+
+func (r Request) HandleTorpedo(game *mb.Game, attacker, defender mb.Player, gm mb.GameManager) mc.Message[mc.RespSpecialAttack] {
+	var reqTorpedo mc.Message[mc.ReqTorpedo]
+	resp := mc.NewMessage[mc.RespSpecialAttack](mc.CodeTorpedo)
+
+	if err := r.codec.Unmarshal(r.payload, &reqTorpedo); err != nil {
+		resp.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
+		return resp
+	}
+
+	if err := checkOpponent(game, defender); err != nil {
+		resp.AddError(err, cerr.ConstErrSpecialAttack)
+		return resp
+	}
+	orientation := reqTorpedo.Payload.Orientation
+	if !mb.IsTorpedoOrientationValid(orientation) {
+		resp.AddError(cerr.ErrInvalidTorpedoOrientation(orientation), cerr.ConstErrSpecialAttack)
+		return resp
+	}
+	index := reqTorpedo.Payload.Index
+	if !game.AreAttackCoordinatesValid(mb.NewCoordinates(index, index)) {
+		resp.AddError(cerr.ErrXorYOutOfGridBound(index, index), cerr.ConstErrSpecialAttack)
+		return resp
+	}
+
+	return fireSpecialAttack(resp, game, attacker, defender, gm, mb.WeaponTorpedo, game.Line(index, orientation))
+}
+
+// The weapon is only used up if it fires at something
+func fireSpecialAttack(
+	resp mc.Message[mc.RespSpecialAttack],
+	game *mb.Game,
+	attacker, defender mb.Player,
+	gm mb.GameManager,
+	weapon uint8,
+	area []mb.Coordinates,
+) mc.Message[mc.RespSpecialAttack] {
+
+	if err := checkSpecialWeapon(game, attacker, weapon); err != nil {
+		resp.AddError(err, cerr.ConstErrSpecialAttack)
+		return resp
+	}
+
+	targets := make([]mb.Coordinates, 0, len(area))
+	for _, coordinates := range area {
+		if attacker.IsAttackGridEmptyInCoordinates(coordinates) && !defender.IsDefenceGridAlreadyHitInCoordinates(coordinates) {
+			targets = append(targets, coordinates)
+		}
+	}
+	if len(targets) == 0 {
+		resp.AddError(cerr.ErrNothingToAttack(), cerr.ConstErrSpecialAttack)
+		return resp
+	}
 
-	// Check if the attack caused the ship to sink
-	if defender.IsShipSunken(shipCode) {
-		defender.IncrementSunkenShips()
-		resp.Payload.DefenderSunkenShipsCoords = defender.ShipHitCoordinates(shipCode)
+	attacker.UseWeapon(weapon)
+	attacker.SetTurnFalse()
+	defender.SetTurnTrue()
+
+	ruleset := game.Ruleset()
+	payload := mc.RespSpecialAttack{Cells: make([]mc.RespAttackCell, 0, len(targets))}
+	for _, coordinates := range targets {
+		strike := strikeCell(game, attacker, defender, coordinates)
+
+		cell := mc.RespAttackCell{X: coordinates.X, Y: coordinates.Y, PositionState: strike.positionState}
+		if ruleset.RevealsShipType() {
+			cell.ShipCode = strike.shipCode
+		}
+		payload.Cells = append(payload.Cells, cell)
+		if ruleset.RevealsSinking() {
+			payload.DefenderSunkenShipsCoords = append(payload.DefenderSunkenShipsCoords, strike.sunkenShipCoords...)
+		}
 
-		// Check if this sunken ship was the last one and the attacker is lost
-		if defender.AreAllShipsSunken() {
-			defender.SetMatchStatusToLost()
-			attacker.SetMatchStatusToWon()
+		if attacker.IsWinner() {
+			break
 		}
 	}
 
-	resp.Payload.SunkenShipsHost = hostPlayer.SunkenShips()
-	resp.Payload.SunkenShipsJoin = joinPlayer.SunkenShips()
+	payload.IsTurn = attacker.IsTurn()
+	if ruleset.RevealsSinking() {
+		payload.SunkenShipsHost = game.HostPlayer().SunkenShips()
+		payload.SunkenShipsJoin = game.JoinPlayer().SunkenShips()
+	}
+	payload.Inventory = attacker.Inventory()
+	resp.AddPayload(payload)
+
+	gm.SaveGame(game)
+	return resp
+}
+
+// A sonar ping takes the turn but damages nothing
+func (r Request) HandleSonar(game *mb.Game, attacker, defender mb.Player, gm mb.GameManager) mc.Message[mc.RespSonar] {
+	var reqSonar mc.Message[mc.ReqSonar]
+	resp := mc.NewMessage[mc.RespSonar](mc.CodeSonar)
+
+	if err := r.codec.Unmarshal(r.payload, &reqSonar); err != nil {
+		resp.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
+		return resp
+	}
+
+	if err := checkOpponent(game, defender); err != nil {
+		resp.AddError(err, cerr.ConstErrSpecialAttack)
+		return resp
+	}
+	center := mb.NewCoordinates(reqSonar.Payload.X, reqSonar.Payload.Y)
+	if !game.AreAttackCoordinatesValid(center) {
+		resp.AddError(cerr.ErrXorYOutOfGridBound(center.X, center.Y), cerr.ConstErrSpecialAttack)
+		return resp
+	}
+	if err := checkSpecialWeapon(game, attacker, mb.WeaponSonar); err != nil {
+		resp.AddError(err, cerr.ConstErrSpecialAttack)
+		return resp
+	}
+
+	attacker.UseWeapon(mb.WeaponSonar)
+	attacker.SetTurnFalse()
+	defender.SetTurnTrue()
+
+	resp.AddPayload(mc.RespSonar{
+		X:            center.X,
+		Y:            center.Y,
+		ShipDetected: defender.HasShipInArea(game.SquareArea(center)),
+		IsTurn:       attacker.IsTurn(),
+		Inventory:    attacker.Inventory(),
+	})
+	gm.SaveGame(game)
 	return resp
 }
 
-func (r Request) HandleCallRematch(bgm mb.GameManager, game *mb.Game) (mc.Message[mc.NoPayload], error) {
+// Weapons can be fired once the session has a game and an
+// opponent in it
+func checkOpponent(game *mb.Game, defender mb.Player) error {
+	if game == nil || defender == nil {
+		return cerr.ErrGameNotExists("")
+	}
+	return nil
+}
+
+func checkSpecialWeapon(game *mb.Game, attacker mb.Player, weapon uint8) error {
+	if !game.Ruleset().SpecialWeapons {
+		return cerr.ErrSpecialWeaponsDisabled(game.Uuid())
+	}
+	if !attacker.IsTurn() {
+		return cerr.ErrNotTurnForAttacker(attacker.Uuid())
+	}
+	if !attacker.Inventory().Has(weapon) {
+		return cerr.ErrWeaponUsedUp(mb.WeaponName(weapon))
+	}
+	return nil
+}
+
+// A tournament match is played only once
+func (r Request) HandleCallRematch(bgm mb.GameManager, tm mt.TournamentManager, game *mb.Game) (mc.Message[mc.NoPayload], error) {
 	respMsg := mc.NewMessage[mc.NoPayload](mc.CodeRematchCall)
 
+	if game == nil {
+		return respMsg, cerr.ErrGameNotExists("")
+	}
+	if tm.IsTournamentGame(game.Uuid()) {
+		return respMsg, cerr.ErrTournamentGame(game.Uuid())
+	}
 	if game.IsRematchAlreadyCalled() {
 		return respMsg, cerr.ErrGameAleardyRecalled()
 	}
+	if game.Series().IsOver() {
+		return respMsg, cerr.ErrSeriesOver(game.Uuid())
+	}
 
 	game.CallRematchForGame()
+	bgm.SaveGame(game)
 	return respMsg, nil
 }
 
 func (r Request) HandleAcceptRematchCall(
 	bgm mb.GameManager,
+	tm mt.TournamentManager,
 	game *mb.Game,
 	sessionPlayer, otherSessionPlayer mb.Player,
 ) (mc.Message[mc.RespRematch], mc.Message[mc.RespRematch], error) {
 
+	if game == nil {
+		return mc.NewMessage[mc.RespRematch](mc.CodeRematch), mc.NewMessage[mc.RespRematch](mc.CodeRematch), cerr.ErrGameNotExists("")
+	}
+	if tm.IsTournamentGame(game.Uuid()) {
+		return mc.NewMessage[mc.RespRematch](mc.CodeRematch), mc.NewMessage[mc.RespRematch](mc.CodeRematch), cerr.ErrTournamentGame(game.Uuid())
+	}
+	if !game.IsRematchAlreadyCalled() {
+		return mc.NewMessage[mc.RespRematch](mc.CodeRematch), mc.NewMessage[mc.RespRematch](mc.CodeRematch), cerr.ErrRematchNotCalled(game.Uuid())
+	}
+	if game.Phase() != mb.GamePhaseFinished {
+		return mc.NewMessage[mc.RespRematch](mc.CodeRematch), mc.NewMessage[mc.RespRematch](mc.CodeRematch), cerr.ErrGameNotFinished(game.Uuid())
+	}
 	if err := game.ResetRematchForGame(); err != nil {
 		return mc.NewMessage[mc.RespRematch](mc.CodeRematch), mc.NewMessage[mc.RespRematch](mc.CodeRematch), err
 	}
 
-	sessionPlayer.SetTurnFalse()
+	// The first turn policy of the game already set the turns
+	series := game.Series()
 	msgPlayer := mc.NewMessage[mc.RespRematch](mc.CodeRematch)
-	msgPlayer.AddPayload(mc.RespRematch{IsTurn: sessionPlayer.IsTurn()})
+	msgPlayer.AddPayload(mc.RespRematch{IsTurn: sessionPlayer.IsTurn(), Series: mc.NewRespSeries(series)})
 
-	otherSessionPlayer.SetTurnTrue()
 	msgOtherPlayer := mc.NewMessage[mc.RespRematch](mc.CodeRematch)
-	msgOtherPlayer.AddPayload(mc.RespRematch{IsTurn: otherSessionPlayer.IsTurn()})
+	msgOtherPlayer.AddPayload(mc.RespRematch{IsTurn: otherSessionPlayer.IsTurn(), Series: mc.NewRespSeries(series)})
 
+	bgm.SaveGame(game)
 	return msgPlayer, msgOtherPlayer, nil
 }
+
+// The client sends the last seq it has seen and every pushed
+// event after that is sent again in the original order. If the
+// log no longer holds all of them, nothing is replayed.
+func (r Request) HandleReplayEvents(session *mc.Session) ([]interface{}, mc.Message[mc.RespReplayEvents]) {
+	var reqReplay mc.Message[mc.ReqReplayEvents]
+	respMsg := mc.NewMessage[mc.RespReplayEvents](mc.CodeReplayEvents)
+
+	if err := r.codec.Unmarshal(r.payload, &reqReplay); err != nil {
+		respMsg.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
+		return nil, respMsg
+	}
+
+	events, latestSeq, ok := session.EventsSince(reqReplay.Payload.LastSeq)
+	if !ok {
+		respMsg.AddError(cerr.ErrEventsNoLongerAvailable(reqReplay.Payload.LastSeq), cerr.ConstErrReplay)
+		return nil, respMsg
+	}
+
+	respMsg.AddPayload(mc.RespReplayEvents{Replayed: uint16(len(events)), LastSeq: latestSeq})
+	return events, respMsg
+}
+
+// The text is trimmed and filtered; the limiter (nil for no
+// limit) is only charged for messages that would be sent
+func (r Request) HandleChat(opponent mb.Player, limiter *ratelimit.TokenBucket, maxLength int, filter ProfanityFilter) mc.Message[mc.RespChat] {
+	var reqChat mc.Message[mc.ReqChat]
+	respMsg := mc.NewMessage[mc.RespChat](mc.CodeChat)
+
+	if err := r.codec.Unmarshal(r.payload, &reqChat); err != nil {
+		respMsg.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
+		return respMsg
+	}
+
+	text := strings.TrimSpace(reqChat.Payload.Text)
+	switch length := utf8.RuneCountInString(text); {
+	case opponent == nil:
+		respMsg.AddError(cerr.ErrNoOpponent(), cerr.ConstErrChat)
+	case length == 0:
+		respMsg.AddError(cerr.ErrChatEmpty(), cerr.ConstErrChat)
+	case maxLength > 0 && length > maxLength:
+		respMsg.AddError(cerr.ErrChatTooLong(length, maxLength), cerr.ConstErrChat)
+	case limiter != nil && !limiter.Allow():
+		respMsg.AddError(cerr.ErrChatRateLimited(), cerr.ConstErrChat)
+	default:
+		respMsg.AddPayload(mc.RespChat{Text: filter.Filter(text)})
+	}
+	return respMsg
+}
+
+// Emotes share the limiter of the chat
+func (r Request) HandleEmote(opponent mb.Player, limiter *ratelimit.TokenBucket) mc.Message[mc.RespEmote] {
+	var reqEmote mc.Message[mc.ReqEmote]
+	respMsg := mc.NewMessage[mc.RespEmote](mc.CodeEmote)
+
+	if err := r.codec.Unmarshal(r.payload, &reqEmote); err != nil {
+		respMsg.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
+		return respMsg
+	}
+
+	emote, found := mc.FindEmote(reqEmote.Payload.EmoteId)
+	switch {
+	case opponent == nil:
+		respMsg.AddError(cerr.ErrNoOpponent(), cerr.ConstErrEmote)
+	case !found:
+		respMsg.AddError(cerr.ErrEmoteUnknown(reqEmote.Payload.EmoteId), cerr.ConstErrEmote)
+	case limiter != nil && !limiter.Allow():
+		respMsg.AddError(cerr.ErrChatRateLimited(), cerr.ConstErrEmote)
+	default:
+		respMsg.AddPayload(mc.RespEmote{EmoteId: emote.Id, Key: emote.Key})
+	}
+	return respMsg
+}
+
+// Lasts until the game ends, rematches included
+func (r Request) HandleMuteOpponent(sessionPlayer mb.Player) mc.Message[mc.RespMuteOpponent] {
+	var reqMute mc.Message[mc.ReqMuteOpponent]
+	respMsg := mc.NewMessage[mc.RespMuteOpponent](mc.CodeMuteOpponent)
+
+	if err := r.codec.Unmarshal(r.payload, &reqMute); err != nil {
+		respMsg.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
+		return respMsg
+	}
+	if sessionPlayer == nil {
+		respMsg.AddError(cerr.ErrNoOpponent(), cerr.ConstErrChat)
+		return respMsg
+	}
+
+	sessionPlayer.SetOpponentMuted(reqMute.Payload.Muted)
+	respMsg.AddPayload(mc.RespMuteOpponent{Muted: reqMute.Payload.Muted})
+	return respMsg
+}
+
+func (r Request) HandleJoinTournamentMatch(tm mt.TournamentManager, sessionId string) (mt.Seat, mc.Message[mc.RespJoinTournamentMatch]) {
+	var reqJoin mc.Message[mc.ReqJoinTournamentMatch]
+	respMsg := mc.NewMessage[mc.RespJoinTournamentMatch](mc.CodeJoinTournamentMatch)
+
+	if err := r.codec.Unmarshal(r.payload, &reqJoin); err != nil {
+		respMsg.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
+		return mt.Seat{}, respMsg
+	}
+
+	seat, err := tm.Seat(reqJoin.Payload.TournamentUuid, reqJoin.Payload.SeatToken, sessionId)
+	if err != nil {
+		respMsg.AddError(err, cerr.ConstErrTournament)
+		return mt.Seat{}, respMsg
+	}
+
+	respMsg.AddPayload(mc.RespJoinTournamentMatch{
+		TournamentUuid: seat.TournamentUuid,
+		MatchId:        seat.MatchId,
+		Round:          seat.Round,
+		Seed:           seat.Seed,
+		GameUuid:       seat.Game.Uuid(),
+		PlayerUuid:     seat.Player.Uuid(),
+		GameDifficulty: seat.Game.Difficulty(),
+		IsHost:         seat.Player.IsHost(),
+	})
+	return seat, respMsg
+}
+
+func (r Request) HandleTournamentStandings(tm mt.TournamentManager) mc.Message[mc.RespTournamentStandings] {
+	var reqStandings mc.Message[mc.ReqTournamentStandings]
+	respMsg := mc.NewMessage[mc.RespTournamentStandings](mc.CodeTournamentStandings)
+
+	if err := r.codec.Unmarshal(r.payload, &reqStandings); err != nil {
+		respMsg.AddError(cerr.ErrInvalidPayload(err), cerr.ConstErrInvalidPayload)
+		return respMsg
+	}
+
+	standings, err := tm.FetchStandings(reqStandings.Payload.TournamentUuid)
+	if err != nil {
+		respMsg.AddError(err, cerr.ConstErrTournament)
+		return respMsg
+	}
+	respMsg.AddPayload(standings)
+	return respMsg
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/saeidalz13/battleship-backend/internal/buildinfo"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+)
+
+// How long readiness waits for the database
+const dbPingTimeout = time.Second * 2
+
+const (
+	LivenessOk             = "ok"
+	ReadinessReady         = "ready"
+	ReadinessDraining      = "draining"
+	ReadinessDbUnavailable = "db_unavailable"
+)
+
+// Satisfied by *sql.DB
+type DBPinger interface {
+	PingContext(ctx context.Context) error
+}
+
+type RespHealth struct {
+	Status string `json:"status"`
+}
+
+type RespStatus struct {
+	Version         string `json:"version"`
+	Commit          string `json:"commit"`
+	UptimeSeconds   int64  `json:"uptime_seconds"`
+	ActiveSessions  int    `json:"active_sessions"`
+	ActiveGames     int    `json:"active_games"`
+	GamesInProgress int    `json:"games_in_progress"`
+	Draining        bool   `json:"draining"`
+}
+
+// Readiness pings the database only if a pinger is set
+func (rp RequestProcessor) WithDBPinger(db DBPinger) RequestProcessor {
+	rp.db = db
+	return rp
+}
+
+// Liveness; the process is up and serving HTTP
+func (rp RequestProcessor) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, RespHealth{Status: LivenessOk})
+}
+
+// Not ready while draining (so that the load balancer stops
+// sending new players) or while the database is unreachable
+func (rp RequestProcessor) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	if rp.IsDraining() {
+		writeJSON(w, http.StatusServiceUnavailable, RespHealth{Status: ReadinessDraining})
+		return
+	}
+
+	if rp.db != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), dbPingTimeout)
+		defer cancel()
+
+		if err := rp.db.PingContext(ctx); err != nil {
+			slog.Warn("readiness check failed", logging.KeyError, err)
+			writeJSON(w, http.StatusServiceUnavailable, RespHealth{Status: ReadinessDbUnavailable})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, RespHealth{Status: ReadinessReady})
+}
+
+func (rp RequestProcessor) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, RespStatus{
+		Version:         buildinfo.Version,
+		Commit:          buildinfo.BuildCommit(),
+		UptimeSeconds:   int64(rp.clock.Now().Sub(rp.startedAt).Seconds()),
+		ActiveSessions:  rp.sessionManager.SessionCount(),
+		ActiveGames:     rp.gameManager.GameCount(),
+		GamesInProgress: rp.gameManager.GamesInProgress(),
+		Draining:        rp.IsDraining(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write response", logging.KeyError, err)
+	}
+}
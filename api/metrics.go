@@ -0,0 +1,60 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/saeidalz13/battleship-backend/internal/metrics"
+)
+
+var (
+	gamesFinishedTotal = metrics.NewCounterVec(
+		"battleship_games_finished_total",
+		"Matches (including rematches) that ended with a winner, by difficulty.",
+		"difficulty",
+	)
+	rematchesTotal = metrics.NewCounter(
+		"battleship_rematches_total",
+		"Rematches accepted by both players.",
+	)
+	attacksTotal = metrics.NewCounter(
+		"battleship_attacks_total",
+		"Attacks that were carried out.",
+	)
+	messageHandlingSeconds = metrics.NewHistogramVec(
+		"battleship_message_handling_seconds",
+		"Time from reading a signal to finishing its handling, by signal code.",
+		metrics.LatencyBuckets,
+		"signal",
+	)
+	matchDurationSeconds = metrics.NewHistogram(
+		"battleship_match_duration_seconds",
+		"Time from the start of a match to its winning attack.",
+		metrics.DurationBuckets,
+	)
+	chatMessagesTotal = metrics.NewCounterVec(
+		"battleship_chat_messages_total",
+		"Chat messages and emotes delivered to the opponent, by kind.",
+		"kind",
+	)
+)
+
+// Values of the `kind` label of chatMessagesTotal
+const (
+	chatKindText  = "text"
+	chatKindEmote = "emote"
+)
+
+// Observes the handling of the signal in `signalCode` (if
+// any) and resets it for the next one
+func observeMessageHandling(signalCode *string, handlingStart time.Time) {
+	if *signalCode == "" {
+		return
+	}
+	messageHandlingSeconds.WithLabelValues(*signalCode).Observe(time.Since(handlingStart).Seconds())
+	*signalCode = ""
+}
+
+func signalLabel(code uint8) string {
+	return strconv.Itoa(int(code))
+}
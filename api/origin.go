@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Reasons an upgrade is rejected for; also used as the
+// `reason` label of the rejected upgrades metric
+const (
+	RejectReasonMissingOrigin    string = "missing_origin"
+	RejectReasonMalformedOrigin  string = "malformed_origin"
+	RejectReasonOriginNotAllowed string = "origin_not_allowed"
+	RejectReasonHandshakeFailed  string = "handshake_failed"
+	RejectReasonShuttingDown     string = "shutting_down"
+)
+
+/*
+OriginPolicy decides which browser origins may open a
+websocket connection. Patterns are one of:
+  - "https://app.example.com" exact scheme and host (and port)
+  - "https://*.example.com"   any subdomain, but not example.com itself
+  - "*"                       any origin
+
+Native clients (e.g. IOS) send no `Origin` header at all and
+are only let in if `allowNoOrigin` is set.
+*/
+type OriginPolicy struct {
+	allowAll      bool
+	allowNoOrigin bool
+	exact         map[string]bool
+
+	// scheme -> ".example.com" suffixes
+	wildcards map[string][]string
+}
+
+func NewOriginPolicy(patterns []string, allowNoOrigin bool) OriginPolicy {
+	op := OriginPolicy{
+		allowNoOrigin: allowNoOrigin,
+		exact:         make(map[string]bool, len(patterns)),
+		wildcards:     make(map[string][]string),
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), "/")
+		if pattern == "" {
+			continue
+		}
+
+		if pattern == "*" {
+			op.allowAll = true
+			continue
+		}
+
+		scheme, host, found := strings.Cut(pattern, "://")
+		if found && strings.HasPrefix(host, "*.") {
+			op.wildcards[scheme] = append(op.wildcards[scheme], host[1:])
+			continue
+		}
+		op.exact[pattern] = true
+	}
+
+	return op
+}
+
+// Returns whether the origin is allowed and if not, why
+func (op OriginPolicy) Check(origin string) (bool, string) {
+	if origin == "" {
+		if op.allowNoOrigin {
+			return true, ""
+		}
+		return false, RejectReasonMissingOrigin
+	}
+
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false, RejectReasonMalformedOrigin
+	}
+
+	if op.allowAll || op.exact[u.Scheme+"://"+u.Host] {
+		return true, ""
+	}
+
+	for _, suffix := range op.wildcards[u.Scheme] {
+		if strings.HasSuffix(u.Host, suffix) {
+			return true, ""
+		}
+	}
+
+	return false, RejectReasonOriginNotAllowed
+}
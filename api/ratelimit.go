@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/saeidalz13/battleship-backend/internal/clock"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	"github.com/saeidalz13/battleship-backend/internal/metrics"
+	"github.com/saeidalz13/battleship-backend/internal/ratelimit"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+// Names of the limits; also the `limit` label of the metric
+const (
+	RateLimitSessionMessages string = "session_messages"
+	RateLimitIpConnections   string = "ip_connections"
+	RateLimitIpNewSessions   string = "ip_new_sessions"
+)
+
+var rateLimitedTotal = metrics.NewCounterVec(
+	"battleship_rate_limited_total",
+	"Connections closed for going over a rate limit, by limit.",
+	"limit",
+)
+
+// Zero for any of the limits disables it
+type RateLimitConfig struct {
+	// Token bucket of the incoming messages of a session
+	MessagesPerSecond float64
+	MessageBurst      int
+
+	MaxConnsPerIp             int
+	NewSessionsPerMinutePerIp int
+
+	// Header set by a trusted proxy with the real client
+	// IP (e.g. `Fly-Client-IP`). Empty uses the remote addr
+	ClientIpHeader string
+}
+
+// A game is a handful of messages per minute; these are
+// generous enough to never bother a real client
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		MessagesPerSecond:         10,
+		MessageBurst:              20,
+		MaxConnsPerIp:             10,
+		NewSessionsPerMinutePerIp: 30,
+	}
+}
+
+func (cfg RateLimitConfig) newSessionLimiter(clk clock.Clock) *ratelimit.TokenBucket {
+	if cfg.MessagesPerSecond <= 0 || cfg.MessageBurst <= 0 {
+		return nil
+	}
+	return ratelimit.NewTokenBucket(cfg.MessagesPerSecond, cfg.MessageBurst, clk)
+}
+
+func (rp RequestProcessor) clientIp(r *http.Request) string {
+	if rp.rateLimits.ClientIpHeader != "" {
+		if ip := strings.TrimSpace(r.Header.Get(rp.rateLimits.ClientIpHeader)); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func rateLimitedMessage(limit string) mc.Message[mc.NoPayload] {
+	rateLimitedTotal.WithLabelValues(limit).Inc()
+
+	msg := mc.NewMessage[mc.NoPayload](mc.CodeRateLimited)
+	msg.AddError(cerr.ErrRateLimited(limit), cerr.ConstErrRateLimited)
+	return msg
+}
+
+func closeRateLimitedConn(conn *websocket.Conn, limit string) {
+	mc.CloseConn(conn, rateLimitedMessage(limit), websocket.ClosePolicyViolation, cerr.ConstErrRateLimited)
+}
+
+func closeRateLimitedSession(session *mc.Session, limit string) {
+	session.CloseWithMessage(rateLimitedMessage(limit), websocket.ClosePolicyViolation, cerr.ConstErrRateLimited)
+}
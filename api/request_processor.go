@@ -1,43 +1,51 @@
 package api
 
 import (
-	"encoding/json"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/saeidalz13/battleship-backend/db/sqlc"
+	"github.com/saeidalz13/battleship-backend/internal/clock"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+	"github.com/saeidalz13/battleship-backend/internal/ratelimit"
 	mb "github.com/saeidalz13/battleship-backend/models/battleship"
 	mc "github.com/saeidalz13/battleship-backend/models/connection"
+	mt "github.com/saeidalz13/battleship-backend/models/tournament"
 )
 
 const (
-	URLQuerySessionIDKeyword string = "sessionID"
-)
-
-var (
-	// allowedOrigins     = map[string]bool{
-	// 	"https://www.allowed_url.com": true,
-	// }
-	upgrader = websocket.Upgrader{
-
-		// good average time since this is not a high-latency operation such as video streaming
-		HandshakeTimeout: time.Second * 5,
-
-		// probably more that enough but this is a good average size
-		ReadBufferSize:  2048,
-		WriteBufferSize: 2048,
-		CheckOrigin:     func(r *http.Request) bool { return true },
-	}
+	URLQueryResumeTokenKeyword string = "resumeToken"
 )
 
 type RequestProcessor struct {
 	sessionManager mc.SessionManager
 	gameManager    mb.GameManager
+	tournaments    mt.TournamentManager
 	q              sqlc.Querier
 	ipnet          net.IPNet
+
+	// Checked by readiness, nil if there is no database
+	db        DBPinger
+	startedAt time.Time
+
+	upgrader     websocket.Upgrader
+	originPolicy OriginPolicy
+	readLimit    int64
+
+	rateLimits RateLimitConfig
+	ipLimiter  *ratelimit.IPLimiter
+
+	chat            ChatConfig
+	profanityFilter ProfanityFilter
+
+	// Shared by all the copies of the processor
+	drain *drainState
+	clock clock.Clock
 }
 
 func NewRequestProcessor(
@@ -48,13 +56,42 @@ func NewRequestProcessor(
 	rp := RequestProcessor{
 		sessionManager: sessionManager,
 		gameManager:    gameManager,
+		tournaments:    mt.NewBattleshipTournamentManager(gameManager),
 		q:              q,
+		drain:          &drainState{},
+		clock:          clock.Real(),
 	}
 
+	rp.startedAt = rp.clock.Now()
 	rp = rp.mustGetServerIpNet()
+	rp = rp.WithUpgraderConfig(DefaultUpgraderConfig())
+	rp = rp.WithRateLimitConfig(DefaultRateLimitConfig())
+	rp = rp.WithChatConfig(DefaultChatConfig())
 	return rp
 }
 
+func (rp RequestProcessor) WithUpgraderConfig(cfg UpgraderConfig) RequestProcessor {
+	rp.originPolicy = NewOriginPolicy(cfg.AllowedOrigins, cfg.AllowNoOrigin)
+	rp.upgrader = newUpgrader(cfg, rp.originPolicy)
+	rp.readLimit = cfg.ReadLimit
+	return rp
+}
+
+func (rp RequestProcessor) WithRateLimitConfig(cfg RateLimitConfig) RequestProcessor {
+	rp.rateLimits = cfg
+	rp.ipLimiter = ratelimit.NewIPLimiter(cfg.MaxConnsPerIp, cfg.NewSessionsPerMinutePerIp, rp.clock)
+	return rp
+}
+
+// Drives the rate limits, the drain of Shutdown and the
+// timestamps of the games, e.g. a fake clock in tests. The
+// uptime counts from here; set it before serving.
+func (rp RequestProcessor) WithClock(clk clock.Clock) RequestProcessor {
+	rp.clock = clk
+	rp.startedAt = clk.Now()
+	return rp.WithRateLimitConfig(rp.rateLimits)
+}
+
 func (rp RequestProcessor) mustGetServerIpNet() RequestProcessor {
 	ifaces, err := net.Interfaces()
 	if err != nil {
@@ -105,25 +142,71 @@ func (rp RequestProcessor) GetIpNet() net.IPNet {
 }
 
 func (rp RequestProcessor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// use Upgrade method to make a websocket connection
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if rp.IsDraining() && r.URL.Query().Get(URLQueryResumeTokenKeyword) == "" {
+		w.Header().Set("Retry-After", strconv.FormatInt(rp.drain.retryAfterSeconds.Load(), 10))
+		rejectUpgrade(w, r, RejectReasonShuttingDown, http.StatusServiceUnavailable)
+		return
+	}
+
+	if allowed, reason := rp.originPolicy.Check(r.Header.Get("Origin")); !allowed {
+		rejectUpgrade(w, r, reason, http.StatusForbidden)
+		return
+	}
+
+	// use Upgrade method to make a websocket connection.
+	// On failure it has already replied to the client
+	conn, err := rp.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "could not open websocket connection", http.StatusBadRequest)
+		slog.Info("websocket upgrade failed", logging.KeyRemoteAddr, r.RemoteAddr, logging.KeyError, err)
+		rejectUpgrade(w, r, RejectReasonHandshakeFailed, 0)
+		return
+	}
+	conn.SetReadLimit(rp.readLimit)
+
+	ip := rp.clientIp(r)
+	releaseIpConn, ok := rp.ipLimiter.Acquire(ip)
+	if !ok {
+		closeRateLimitedConn(conn, RateLimitIpConnections)
 		return
 	}
+	defer releaseIpConn()
 
-	sessionIdQuery := r.URL.Query().Get(URLQuerySessionIDKeyword)
-	switch sessionIdQuery {
+	resumeTokenQuery := r.URL.Query().Get(URLQueryResumeTokenKeyword)
+	switch resumeTokenQuery {
 	case "":
-		log.Println("a new connection established\tRemote Addr: ", conn.RemoteAddr().String())
-		rp.processSessionRequests(rp.sessionManager.GenerateNewSession(conn))
+		if !rp.ipLimiter.AllowNewSession(ip) {
+			closeRateLimitedConn(conn, RateLimitIpNewSessions)
+			return
+		}
+
+		session := rp.sessionManager.GenerateNewSession(conn)
+		session.Logger().Info("a new connection established")
+		rp.processSessionRequests(session)
 
 	default:
-		rp.sessionManager.ReconnectSession(sessionIdQuery, conn)
+		// Only a session of a restored game comes back without a loop
+		if session := rp.sessionManager.ReconnectSession(resumeTokenQuery, conn, rp.gameManager); session != nil {
+			rp.processSessionRequests(session)
+		}
 	}
 }
 
+// Serves the sessions that other nodes relay to this one.
+// Call it once the processor is fully configured.
+func (rp RequestProcessor) ServeMessageBus(bus mc.MessageBus) error {
+	return bus.Subscribe(rp.gameManager.NodeId(), rp.handleBusMessage)
+}
+
+func (rp RequestProcessor) handleBusMessage(msg mc.BusMessage) {
+	if msg.Kind != mc.BusKindOpen {
+		rp.sessionManager.HandleBusMessage(msg)
+		return
+	}
+
+	session := rp.sessionManager.OpenRemoteSession(msg)
+	go rp.processSessionRequests(session)
+}
+
 func (rp *RequestProcessor) processSessionRequests(session *mc.Session) {
 	var (
 		otherSessionPlayer mb.Player
@@ -132,28 +215,73 @@ func (rp *RequestProcessor) processSessionRequests(session *mc.Session) {
 
 		receiverSessionId string
 		sessionId         = session.Id()
+
+		// nil if there is no limit
+		msgLimiter  = rp.rateLimits.newSessionLimiter(rp.clock)
+		chatLimiter = rp.chat.newSessionLimiter(rp.clock)
 	)
 
 	defer func() {
+		// Leaving a tournament match loses it, unless the
+		// server is going down. A match whose game an operator
+		// ended is played again instead.
+		var (
+			forfeit   mt.Result
+			forfeited bool
+		)
 		if sessionGame != nil {
+			switch {
+			case sessionGame.IsEndedByOperator():
+				rp.tournaments.VoidMatch(sessionGame.Uuid())
+			case sessionPlayer != nil && !rp.IsDraining() && sessionGame.Phase() != mb.GamePhaseFinished:
+				forfeit, forfeited = rp.tournaments.ReportForfeit(sessionGame.Uuid(), sessionPlayer.IsHost())
+			}
 			rp.gameManager.TerminateGame(sessionGame.Uuid())
 		}
 		if session != nil && session.Conn() != nil {
 			session.Conn().Close()
 		}
 		rp.sessionManager.TerminateSession(sessionId)
+		if forfeited {
+			rp.NotifyTournamentResult(forfeit)
+		}
 	}()
 
-	resp := mc.NewMessage[mc.RespSessionId](mc.CodeSessionID)
-	resp.AddPayload(mc.RespSessionId{SessionID: sessionId})
-	if err := rp.sessionManager.WriteToSessionConn(session, resp, mc.MessageTypeJSON, receiverSessionId); err != nil {
-		return
+	// A session that reclaimed a restored game is bound to it
+	// before its loop starts
+	if gameUuid := session.GameUuid(); gameUuid != "" {
+		if game, err := rp.gameManager.FetchGame(gameUuid); err == nil {
+			sessionGame = game
+			isHost := game.HostPlayer().SessionId() == sessionId
+			sessionPlayer = game.FetchPlayer(isHost)
+			if opponent := game.FetchPlayer(!isHost); opponent != nil {
+				otherSessionPlayer = opponent
+				receiverSessionId = opponent.SessionId()
+			}
+		}
+	}
+
+	// A relayed client got its session ID from the relay and
+	// a reclaiming one already has it
+	if !session.IsRemote() && sessionGame == nil {
+		resp := mc.NewMessage[mc.RespSessionId](mc.CodeSessionID)
+		resp.AddPayload(mc.RespSessionId{SessionID: sessionId})
+		if err := rp.sessionManager.WriteToSessionConn(session, resp, mc.MessageTypeJSON, receiverSessionId); err != nil {
+			return
+		}
 	}
 
 	// serverPqtypeInet := pqtype.Inet{IPNet: rp.ipnet, Valid: true}
 
+	// The handling time is observed in the post statement of
+	// the loop so that the `continue`s are covered too
+	var (
+		handledSignal string
+		handlingStart time.Time
+	)
+
 sessionLoop:
-	for {
+	for ; ; observeMessageHandling(&handledSignal, handlingStart) {
 		// A WebSocket frame can be one of 6 types: text=1, binary=2, ping=9, pong=10, close=8 and continuation=0
 		// https://www.rfc-editor.org/rfc/rfc6455.html#section-11.8
 		_, payload, err := rp.sessionManager.ReadFromSessionConn(session, receiverSessionId)
@@ -164,16 +292,24 @@ sessionLoop:
 			break sessionLoop
 		}
 
+		if msgLimiter != nil && !msgLimiter.Allow() {
+			closeRateLimitedSession(session, RateLimitSessionMessages)
+			break sessionLoop
+		}
+
 		var signal mc.Signal
 
-		if err := json.Unmarshal(payload, &signal); err != nil {
+		if err := session.Codec().Unmarshal(payload, &signal); err != nil {
 			msg := mc.NewMessage[mc.NoPayload](mc.CodeSignalAbsent)
-			msg.AddError("incoming req payload must contain 'code' field", "")
+			msg.AddError(cerr.ErrSignalAbsent(), cerr.ConstErrInvalidPayload)
 			if err = rp.sessionManager.WriteToSessionConn(session, msg, mc.MessageTypeJSON, receiverSessionId); err != nil {
 				break sessionLoop
 			}
 			continue sessionLoop
 		}
+		handledSignal, handlingStart = signalLabel(signal.Code), time.Now()
+		logger := session.Logger().With(logging.KeySignal, signal.Code)
+		logger.Debug("handling signal")
 
 		switch signal.Code {
 
@@ -185,21 +321,38 @@ sessionLoop:
 			// 	log.Println(err)
 			// }
 
-			game, hostPlayer, respMsg := NewRequest(payload).HandleCreateGame(rp.gameManager, sessionId)
+			game, hostPlayer, respMsg := NewRequest(session.Codec(), payload).HandleCreateGame(rp.gameManager, sessionId)
 			sessionPlayer = hostPlayer
 			sessionGame = game
 
-			if err := rp.sessionManager.WriteToSessionConn(session, respMsg, mc.MessageTypeJSON, receiverSessionId); err != nil {
+			if respMsg.Error == nil {
+				respMsg.Payload.ResumeToken, _ = rp.sessionManager.BindPlayer(session, game.Uuid(), hostPlayer.Uuid())
+			}
+
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
 				break sessionLoop
 			}
 
 		// This branch handles joining a new player to an existing
 		// game.
 		case mc.CodeJoinGame:
-			req := NewRequest(payload)
-			game, joinPlayer, respMsg := req.HandleJoinPlayer(rp.gameManager, sessionId)
+			req := NewRequest(session.Codec(), payload)
+
+			// The game runs on another node; this loop only
+			// relays from now on
+			if ownerNodeId, remote := req.RemoteGameOwner(rp.gameManager); remote {
+				if err := rp.sessionManager.RelaySession(session, ownerNodeId, payload); err != nil {
+					logger.Warn("failed to relay the session", logging.KeyError, err)
+				}
+				break sessionLoop
+			}
+
+			game, joinPlayer, respMsg := req.HandleJoinPlayer(rp.gameManager, rp.tournaments, sessionId)
+			if respMsg.Error == nil {
+				respMsg.Payload.ResumeToken, _ = rp.sessionManager.BindPlayer(session, game.Uuid(), joinPlayer.Uuid())
+			}
 
-			if err := rp.sessionManager.WriteToSessionConn(session, respMsg, mc.MessageTypeJSON, receiverSessionId); err != nil {
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
 				break sessionLoop
 			}
 			if respMsg.Error != nil {
@@ -216,7 +369,7 @@ sessionLoop:
 			}
 
 			readyRespMsg := mc.NewMessage[mc.NoPayload](mc.CodeSelectGrid)
-			if err := rp.sessionManager.WriteToSessionConn(session, readyRespMsg, mc.MessageTypeJSON, receiverSessionId); err != nil {
+			if err := rp.sessionManager.WriteToSessionConn(session, readyRespMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
 				break sessionLoop
 			}
 
@@ -227,10 +380,14 @@ sessionLoop:
 		// This code means the player has selected their grid and
 		// ready to start the game
 		case mc.CodeReady:
-			req := NewRequest(payload)
+			req := NewRequest(session.Codec(), payload)
 			respMsg := req.HandleReadyPlayer(rp.gameManager, sessionGame, sessionPlayer)
 
-			if err := rp.sessionManager.WriteToSessionConn(session, respMsg, mc.MessageTypeJSON, receiverSessionId); err != nil {
+			// Only one of the loops gets to start the game, whichever
+			// sees both players ready first
+			started := respMsg.Error == nil && sessionGame.TryStart(rp.clock.Now())
+
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
 				break sessionLoop
 			}
 
@@ -243,9 +400,20 @@ sessionLoop:
 				receiverSessionId = otherSessionPlayer.SessionId()
 			}
 
-			if sessionGame.IsReadyToStart() {
-				respStartGame := mc.NewMessage[mc.NoPayload](mc.CodeStartGame)
-				if err := rp.sessionManager.WriteToSessionConn(session, respStartGame, mc.MessageTypeJSON, receiverSessionId); err != nil {
+			if started {
+				rp.gameManager.SaveGame(sessionGame)
+				starter := sessionGame.FetchPlayer(sessionGame.HostStarts())
+				respStartGame := mc.NewMessage[mc.RespStartGame](mc.CodeStartGame)
+				respStartGame.AddPayload(mc.RespStartGame{
+					FirstTurn:   sessionGame.FirstTurnPolicy(),
+					StarterUuid: starter.Uuid(),
+					HostStarts:  sessionGame.HostStarts(),
+				})
+				if sessionGame.Ruleset().SpecialWeapons {
+					inventory := mb.DefaultInventory()
+					respStartGame.Payload.Inventory = &inventory
+				}
+				if err := rp.sessionManager.WriteToSessionConn(session, respStartGame.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
 					break sessionLoop
 				}
 
@@ -258,10 +426,10 @@ sessionLoop:
 		// `SessionPlayer` checks if the attacker has won the game. if so,
 		// the game ends and a signal is sent to both players
 		case mc.CodeAttack:
-			req := NewRequest(payload)
+			req := NewRequest(session.Codec(), payload)
 			respMsg := req.HandleAttack(sessionGame, sessionPlayer, otherSessionPlayer, rp.gameManager)
 
-			if err := rp.sessionManager.WriteToSessionConn(session, respMsg, mc.MessageTypeJSON, receiverSessionId); err != nil {
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
 				break sessionLoop
 			}
 
@@ -269,6 +437,7 @@ sessionLoop:
 			if respMsg.Error != nil {
 				continue sessionLoop
 			}
+			attacksTotal.Inc()
 
 			// defender turn is set to true
 			respMsg.Payload.IsTurn = true
@@ -277,19 +446,57 @@ sessionLoop:
 			}
 
 			if sessionPlayer.IsWinner() {
-				respAttacker := mc.NewMessage[mc.RespEndGame](mc.CodeEndGame)
-				respAttacker.AddPayload(mc.RespEndGame{PlayerMatchStatus: mb.PlayerMatchStatusWon})
-				if err := rp.sessionManager.WriteToSessionConn(session, respAttacker, mc.MessageTypeJSON, receiverSessionId); err != nil {
+				if err := rp.endGame(session, sessionGame, sessionPlayer, signal.RequestId, receiverSessionId); err != nil {
 					break sessionLoop
 				}
+			}
+
+		// Bombs and torpedoes hit several cells at once; the game
+		// ends like after a plain attack
+		case mc.CodeBomb, mc.CodeTorpedo:
+			req := NewRequest(session.Codec(), payload)
+			var respMsg mc.Message[mc.RespSpecialAttack]
+			if signal.Code == mc.CodeBomb {
+				respMsg = req.HandleBomb(sessionGame, sessionPlayer, otherSessionPlayer, rp.gameManager)
+			} else {
+				respMsg = req.HandleTorpedo(sessionGame, sessionPlayer, otherSessionPlayer, rp.gameManager)
+			}
+
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+				break sessionLoop
+			}
+			if respMsg.Error != nil {
+				continue sessionLoop
+			}
+			attacksTotal.Inc()
+
+			respMsg.Payload.IsTurn = true
+			if err := rp.sessionManager.Communicate(sessionId, receiverSessionId, respMsg, mc.MessageTypeJSON); err != nil {
+				break sessionLoop
+			}
 
-				respDefender := mc.NewMessage[mc.RespEndGame](mc.CodeEndGame)
-				respDefender.AddPayload(mc.RespEndGame{PlayerMatchStatus: mb.PlayerMatchStatusLost})
-				if err := rp.sessionManager.Communicate(sessionId, receiverSessionId, respDefender, mc.MessageTypeJSON); err != nil {
+			if sessionPlayer.IsWinner() {
+				if err := rp.endGame(session, sessionGame, sessionPlayer, signal.RequestId, receiverSessionId); err != nil {
 					break sessionLoop
 				}
 			}
 
+		// The defender learns about the ping too since they know
+		// their ships anyway
+		case mc.CodeSonar:
+			respMsg := NewRequest(session.Codec(), payload).HandleSonar(sessionGame, sessionPlayer, otherSessionPlayer, rp.gameManager)
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+				break sessionLoop
+			}
+			if respMsg.Error != nil {
+				continue sessionLoop
+			}
+
+			respMsg.Payload.IsTurn = true
+			if err := rp.sessionManager.Communicate(sessionId, receiverSessionId, respMsg, mc.MessageTypeJSON); err != nil {
+				break sessionLoop
+			}
+
 		case mc.CodeRematchCall:
 			// ctx, cancel := context.WithTimeout(context.Background(), sqlc.QuerierCtxTimeout)
 			// if err := rp.q.AnalyticsIncrementRematchCalledCount(ctx, serverPqtypeInet); err != nil {
@@ -297,8 +504,12 @@ sessionLoop:
 			// 	log.Println(err)
 			// }
 
-			respMsg, err := NewRequest().HandleCallRematch(rp.gameManager, sessionGame)
+			respMsg, err := NewRequest(session.Codec()).HandleCallRematch(rp.gameManager, rp.tournaments, sessionGame)
 			if err != nil {
+				respMsg.AddError(err, cerr.ConstErrRematchCall)
+				if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+					break sessionLoop
+				}
 				continue sessionLoop
 			}
 
@@ -307,20 +518,133 @@ sessionLoop:
 			}
 
 		case mc.CodeRematchCallAccepted:
-			msgPlayer, msgOtherPlayer, err := NewRequest().HandleAcceptRematchCall(rp.gameManager, sessionGame, sessionPlayer, otherSessionPlayer)
+			msgPlayer, msgOtherPlayer, err := NewRequest(session.Codec()).HandleAcceptRematchCall(rp.gameManager, rp.tournaments, sessionGame, sessionPlayer, otherSessionPlayer)
 			if err != nil {
-				log.Println(err)
-				break sessionLoop
+				logger.Warn("failed to accept the rematch call", logging.KeyError, err)
+				msgPlayer.AddError(err, cerr.ConstErrRematchAccept)
+				if err := rp.sessionManager.WriteToSessionConn(session, msgPlayer.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+					break sessionLoop
+				}
+				continue sessionLoop
 			}
+			rematchesTotal.Inc()
 
 			if err := rp.sessionManager.Communicate(sessionId, receiverSessionId, msgOtherPlayer, mc.MessageTypeJSON); err != nil {
 				break sessionLoop
 			}
-			if err := rp.sessionManager.WriteToSessionConn(session, msgPlayer, mc.MessageTypeJSON, receiverSessionId); err != nil {
+			if err := rp.sessionManager.WriteToSessionConn(session, msgPlayer.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+				break sessionLoop
+			}
+
+		// Resend the pushed events the client missed, e.g. while
+		// its connection was down
+		case mc.CodeReplayEvents:
+			events, respMsg := NewRequest(session.Codec(), payload).HandleReplayEvents(session)
+			for _, event := range events {
+				if err := rp.sessionManager.WriteToSessionConn(session, event, mc.MessageTypeJSON, receiverSessionId); err != nil {
+					break sessionLoop
+				}
+			}
+
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+				break sessionLoop
+			}
+
+		// Chat and emotes only go to an opponent who has not
+		// muted this player; the sender cannot tell the difference.
+		// Pushed like any event, so they are in the replay log.
+		case mc.CodeChat:
+			if otherSessionPlayer == nil {
+				if otherSessionPlayer = opponentOf(sessionGame, sessionPlayer); otherSessionPlayer != nil {
+					receiverSessionId = otherSessionPlayer.SessionId()
+				}
+			}
+
+			respMsg := NewRequest(session.Codec(), payload).HandleChat(otherSessionPlayer, chatLimiter, rp.chat.MaxLength, rp.profanityFilter)
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+				break sessionLoop
+			}
+			if respMsg.Error != nil || otherSessionPlayer.IsOpponentMuted() {
+				continue sessionLoop
+			}
+
+			chatMessagesTotal.WithLabelValues(chatKindText).Inc()
+			if err := rp.sessionManager.Communicate(sessionId, receiverSessionId, respMsg, mc.MessageTypeJSON); err != nil {
+				break sessionLoop
+			}
+
+		case mc.CodeEmote:
+			if otherSessionPlayer == nil {
+				if otherSessionPlayer = opponentOf(sessionGame, sessionPlayer); otherSessionPlayer != nil {
+					receiverSessionId = otherSessionPlayer.SessionId()
+				}
+			}
+
+			respMsg := NewRequest(session.Codec(), payload).HandleEmote(otherSessionPlayer, chatLimiter)
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+				break sessionLoop
+			}
+			if respMsg.Error != nil || otherSessionPlayer.IsOpponentMuted() {
+				continue sessionLoop
+			}
+
+			chatMessagesTotal.WithLabelValues(chatKindEmote).Inc()
+			if err := rp.sessionManager.Communicate(sessionId, receiverSessionId, respMsg, mc.MessageTypeJSON); err != nil {
+				break sessionLoop
+			}
+
+		case mc.CodeMuteOpponent:
+			respMsg := NewRequest(session.Codec(), payload).HandleMuteOpponent(sessionPlayer)
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+				break sessionLoop
+			}
+
+		// Moves the session into the game of its current match,
+		// leaving its previous game if that one is over
+		case mc.CodeJoinTournamentMatch:
+			if !rp.canLeaveGame(sessionGame) {
+				respMsg := mc.NewMessage[mc.RespJoinTournamentMatch](mc.CodeJoinTournamentMatch)
+				respMsg.AddError(cerr.ErrAlreadyInGame(sessionGame.Uuid()), cerr.ConstErrTournament)
+				if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+					break sessionLoop
+				}
+				continue sessionLoop
+			}
+
+			seat, respMsg := NewRequest(session.Codec(), payload).HandleJoinTournamentMatch(rp.tournaments, sessionId)
+			if respMsg.Error == nil {
+				if sessionGame != nil {
+					rp.gameManager.TerminateGame(sessionGame.Uuid())
+				}
+				sessionGame, sessionPlayer = seat.Game, seat.Player
+				otherSessionPlayer, receiverSessionId = nil, ""
+				respMsg.Payload.ResumeToken, _ = rp.sessionManager.BindPlayer(session, seat.Game.Uuid(), seat.Player.Uuid())
+			}
+
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+				break sessionLoop
+			}
+			if respMsg.Error != nil || !seat.IsJoin {
+				continue sessionLoop
+			}
+
+			otherSessionPlayer = sessionGame.FetchPlayer(!sessionPlayer.IsHost())
+			receiverSessionId = otherSessionPlayer.SessionId()
+
+			readyRespMsg := mc.NewMessage[mc.NoPayload](mc.CodeSelectGrid)
+			if err := rp.sessionManager.WriteToSessionConn(session, readyRespMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+				break sessionLoop
+			}
+			if err := rp.sessionManager.Communicate(sessionId, receiverSessionId, readyRespMsg, mc.MessageTypeJSON); err != nil {
+				break sessionLoop
+			}
+
+		case mc.CodeTournamentStandings:
+			respMsg := NewRequest(session.Codec(), payload).HandleTournamentStandings(rp.tournaments)
+			if err := rp.sessionManager.WriteToSessionConn(session, respMsg.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
 				break sessionLoop
 			}
 
-		// Notify the other player that no rematch is wanted now
 		case mc.CodeRematchCallRejected:
 			msg := mc.NewMessage[mc.NoPayload](mc.CodeRematchCallRejected)
 			rp.sessionManager.Communicate(sessionId, receiverSessionId, msg, mc.MessageTypeJSON)
@@ -328,10 +652,47 @@ sessionLoop:
 
 		default:
 			respInvalidSignal := mc.NewMessage[mc.NoPayload](mc.CodeInvalidSignal)
-			respInvalidSignal.AddError("", "invalid code in the incoming payload")
-			if err := rp.sessionManager.WriteToSessionConn(session, respInvalidSignal, mc.MessageTypeJSON, receiverSessionId); err != nil {
+			respInvalidSignal.AddError(cerr.ErrInvalidSignal(signal.Code), cerr.ConstErrInvalidSignal)
+			if err := rp.sessionManager.WriteToSessionConn(session, respInvalidSignal.WithRequestId(signal.RequestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
 				break sessionLoop
 			}
 		}
 	}
 }
+
+// Tells both players that the winner sank the last ship. A
+// write error means the winner's connection is gone.
+func (rp RequestProcessor) endGame(session *mc.Session, game *mb.Game, winner mb.Player, requestId, receiverSessionId string) error {
+	gamesFinishedTotal.WithLabelValues(mb.DifficultyName(game.Difficulty())).Inc()
+	result, isTournamentMatch := rp.tournaments.ReportResult(game.Uuid(), winner.IsHost())
+	matchDurationSeconds.Observe(rp.clock.Now().Sub(game.StartedAt()).Seconds())
+
+	series := mc.NewRespSeries(game.Series())
+	respAttacker := mc.NewMessage[mc.RespEndGame](mc.CodeEndGame)
+	respAttacker.AddPayload(mc.RespEndGame{PlayerMatchStatus: mb.PlayerMatchStatusWon, Series: series})
+	if err := rp.sessionManager.WriteToSessionConn(session, respAttacker.WithRequestId(requestId), mc.MessageTypeJSON, receiverSessionId); err != nil {
+		return err
+	}
+
+	respDefender := mc.NewMessage[mc.RespEndGame](mc.CodeEndGame)
+	respDefender.AddPayload(mc.RespEndGame{PlayerMatchStatus: mb.PlayerMatchStatusLost, Series: series})
+	if err := rp.sessionManager.Communicate(session.Id(), receiverSessionId, respDefender, mc.MessageTypeJSON); err != nil {
+		return err
+	}
+
+	if isTournamentMatch {
+		rp.NotifyTournamentResult(result)
+	}
+	return nil
+}
+
+// nil until somebody joined the game of the player
+func opponentOf(game *mb.Game, player mb.Player) mb.Player {
+	if game == nil || player == nil {
+		return nil
+	}
+	if opponent := game.FetchPlayer(!player.IsHost()); opponent != nil {
+		return opponent
+	}
+	return nil
+}
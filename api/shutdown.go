@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+// How often the drain checks whether games are over
+const drainPollInterval = time.Millisecond * 250
+
+type ShutdownConfig struct {
+	// How long games in progress may still be played
+	DrainWindow time.Duration
+
+	// Sent to clients as a hint for when to reconnect
+	RetryAfter time.Duration
+}
+
+func DefaultShutdownConfig() ShutdownConfig {
+	return ShutdownConfig{
+		DrainWindow: time.Second * 45,
+		RetryAfter:  time.Second * 10,
+	}
+}
+
+type drainState struct {
+	draining          atomic.Bool
+	retryAfterSeconds atomic.Int64
+}
+
+func (rp RequestProcessor) IsDraining() bool {
+	return rp.drain.draining.Load()
+}
+
+/*
+Shutdown drains the server:
+ 1. new sessions are turned down (reconnections still work)
+ 2. every session is told that the server is going away
+ 3. games in progress get until the drain window is over to finish
+ 4. every conn is closed with CloseServiceRestart; the
+    snapshots of the games left are kept in the game store
+
+It returns once all the session loops are done or ctx is over.
+*/
+func (rp RequestProcessor) Shutdown(ctx context.Context, cfg ShutdownConfig) {
+	rp.drain.retryAfterSeconds.Store(int64(cfg.RetryAfter.Seconds()))
+	rp.drain.draining.Store(true)
+
+	msg := mc.NewMessage[mc.RespServerShuttingDown](mc.CodeServerShuttingDown)
+	msg.AddPayload(mc.RespServerShuttingDown{
+		DrainSeconds:      uint16(cfg.DrainWindow.Seconds()),
+		RetryAfterSeconds: uint16(cfg.RetryAfter.Seconds()),
+	})
+	rp.sessionManager.Broadcast(msg, mc.MessageTypeJSON)
+
+	ticker := rp.clock.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	drainTimer := rp.clock.NewTimer(cfg.DrainWindow)
+	defer drainTimer.Stop()
+
+drainLoop:
+	for rp.gameManager.GamesInProgress() > 0 {
+		select {
+		case <-ctx.Done():
+			slog.Warn("shutdown deadline reached while draining", "games_in_progress", rp.gameManager.GamesInProgress())
+			break drainLoop
+		case <-drainTimer.C():
+			slog.Warn("drain window is over", "games_in_progress", rp.gameManager.GamesInProgress())
+			break drainLoop
+		case <-ticker.C():
+		}
+	}
+
+	// The games left are ended by closing their sessions; the
+	// next process restores them from their snapshots
+	rp.gameManager.PreserveSnapshots()
+	rp.sessionManager.CloseAllSessions(websocket.CloseServiceRestart, "server is restarting")
+
+	for rp.sessionManager.SessionCount() > 0 {
+		select {
+		case <-ctx.Done():
+			slog.Warn("shutdown deadline reached", "sessions_left", rp.sessionManager.SessionCount())
+			return
+		case <-ticker.C():
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+	mt "github.com/saeidalz13/battleship-backend/models/tournament"
+)
+
+// Share it with the admin API so that the tournaments created
+// there can be played here
+func (rp RequestProcessor) WithTournamentManager(tm mt.TournamentManager) RequestProcessor {
+	rp.tournaments = tm
+	return rp
+}
+
+// GET /tournaments/{uuid}
+func (rp RequestProcessor) HandleTournamentStandings(w http.ResponseWriter, r *http.Request) {
+	standings, err := rp.tournaments.FetchStandings(r.PathValue("uuid"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, RespAdminError{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, standings)
+}
+
+// Pushes the result to the seated entrants. Pass it to
+// TournamentManager.ExpireMatchesPeriodically.
+func (rp RequestProcessor) NotifyTournamentResult(result mt.Result) {
+	msg := mc.NewMessage[mc.RespTournamentMatchResult](mc.CodeTournamentMatchResult)
+	msg.AddPayload(mc.RespTournamentMatchResult{
+		TournamentUuid: result.TournamentUuid,
+		MatchId:        result.MatchId,
+		Winner:         result.Winner,
+		DecidedBy:      result.DecidedBy,
+		Champion:       result.Champion,
+	})
+
+	for _, sessionId := range result.SessionIds {
+		if err := rp.sessionManager.Communicate("", sessionId, msg, mc.MessageTypeJSON); err != nil {
+			slog.Debug("failed to push the tournament result", logging.KeySession, logging.HashId(sessionId), logging.KeyError, err)
+		}
+	}
+}
+
+// A session can move on to its next match once its game is
+// over, or the tournament decided it
+func (rp RequestProcessor) canLeaveGame(game *mb.Game) bool {
+	if game == nil || game.Phase() == mb.GamePhaseFinished {
+		return true
+	}
+	if rp.tournaments.IsMatchFinished(game.Uuid()) {
+		return true
+	}
+	_, err := rp.gameManager.FetchGame(game.Uuid())
+	return err != nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+	"github.com/saeidalz13/battleship-backend/internal/metrics"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+var upgradesRejectedTotal = metrics.NewCounterVec(
+	"battleship_websocket_upgrades_rejected_total",
+	"Websocket upgrade requests that were turned down, by reason.",
+	"reason",
+)
+
+type UpgraderConfig struct {
+	// Origin patterns, see OriginPolicy
+	AllowedOrigins []string
+	AllowNoOrigin  bool
+
+	HandshakeTimeout time.Duration
+	ReadBufferSize   int
+	WriteBufferSize  int
+
+	// Max size in bytes of a single incoming message. A
+	// bigger one closes the conn with CloseMessageTooBig
+	ReadLimit int64
+}
+
+// Native clients are let in while browsers have to be
+// allowed explicitly through `AllowedOrigins`
+func DefaultUpgraderConfig() UpgraderConfig {
+	return UpgraderConfig{
+		AllowNoOrigin: true,
+
+		// good average time since this is not a high-latency operation such as video streaming
+		HandshakeTimeout: time.Second * 5,
+
+		// probably more that enough but this is a good average size
+		ReadBufferSize:  2048,
+		WriteBufferSize: 2048,
+
+		// The biggest request is a hard defence grid which
+		// is way below this, even JSON encoded
+		ReadLimit: 4096,
+	}
+}
+
+func newUpgrader(cfg UpgraderConfig, originPolicy OriginPolicy) websocket.Upgrader {
+	return websocket.Upgrader{
+		HandshakeTimeout: cfg.HandshakeTimeout,
+		ReadBufferSize:   cfg.ReadBufferSize,
+		WriteBufferSize:  cfg.WriteBufferSize,
+
+		// ServeHTTP already checks this before upgrading so it
+		// can log the reason; this is just the last line
+		CheckOrigin: func(r *http.Request) bool {
+			allowed, _ := originPolicy.Check(r.Header.Get("Origin"))
+			return allowed
+		},
+
+		// Lets the client pick a compact binary encoding
+		// through the `Sec-WebSocket-Protocol` header
+		Subprotocols: mc.Subprotocols(),
+	}
+}
+
+func rejectUpgrade(w http.ResponseWriter, r *http.Request, reason string, status int) {
+	upgradesRejectedTotal.WithLabelValues(reason).Inc()
+	slog.Info("websocket upgrade rejected", "reason", reason, "origin", r.Header.Get("Origin"), logging.KeyRemoteAddr, r.RemoteAddr)
+
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+	}
+}
@@ -1,41 +1,216 @@
 package main
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/saeidalz13/battleship-backend/api"
+	"github.com/saeidalz13/battleship-backend/db"
+	"github.com/saeidalz13/battleship-backend/db/sqlc"
+	"github.com/saeidalz13/battleship-backend/internal/buildinfo"
+	"github.com/saeidalz13/battleship-backend/internal/config"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+	"github.com/saeidalz13/battleship-backend/internal/metrics"
+	"github.com/saeidalz13/battleship-backend/internal/token"
 	mb "github.com/saeidalz13/battleship-backend/models/battleship"
 	mc "github.com/saeidalz13/battleship-backend/models/connection"
 	ms "github.com/saeidalz13/battleship-backend/models/server"
+	mt "github.com/saeidalz13/battleship-backend/models/tournament"
 )
 
+// Time the sessions get to close after the drain window
+const shutdownCloseTimeout = time.Second * 5
+
 func main() {
-	if os.Getenv("STAGE") != "prod" {
+	if os.Getenv("STAGE") != ms.ProdStageCode {
 		if err := godotenv.Load(".env"); err != nil {
 			panic(err)
 		}
 	}
-	stage := os.Getenv("STAGE")
-	if stage != ms.DevStageCode && stage != ms.ProdStageCode {
-		panic("stage must be either dev or prod")
+
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid config:", err)
+		os.Exit(2)
+	}
+
+	// Before anything else so that every logger derives from it
+	logger, err := logging.New(os.Stderr, cfg.Log)
+	if err != nil {
+		panic(err)
+	}
+	slog.SetDefault(logger)
+	slog.Info("effective config", "config", &cfg)
+
+	// Cancelled on SIGTERM (e.g. a deploy) which stops the
+	// background goroutines and starts draining the server
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	bgm := mb.NewBattleshipGameManager().WithGameConfig(cfg.Game)
+	btm := mt.NewBattleshipTournamentManager(bgm).WithTournamentConfig(cfg.Tournament)
+
+	// The database is only needed to keep the games and to
+	// connect the nodes for now
+	var psqlDb *sql.DB
+	if cfg.GameStore == mb.GameStorePostgres || cfg.MessageBus == mc.MessageBusPostgres {
+		psqlDb = db.MustConnectToDb(cfg.DatabaseUrl, cfg.DBPool)
+	}
+	if cfg.GameStore == mb.GameStorePostgres {
+		bgm.WithGameStore(db.NewPostgresGameStore(sqlc.New(psqlDb)))
+		btm.WithTournamentStore(db.NewPostgresTournamentStore(sqlc.New(psqlDb)))
+	}
+
+	// nil if this is the only node
+	var bus mc.MessageBus
+	nodeId := nodeIdOf(cfg)
+	if cfg.MessageBus == mc.MessageBusPostgres {
+		bgm.WithGameRegistry(db.NewPostgresGameRegistry(sqlc.New(psqlDb)), nodeId)
+
+		pgBus, err := db.NewPostgresBus(cfg.DatabaseUrl, sqlc.New(psqlDb))
+		if err != nil {
+			panic(err)
+		}
+		defer pgBus.Close()
+		bus = pgBus
+		slog.Info("joined the cluster", "node_id", nodeId)
+	}
+	restoreGames(ctx, bgm)
+	restoreTournaments(ctx, btm)
+
+	bsm := mc.NewBattleshipSessionManager().WithResumeTokenSigner(newResumeTokenSigner(cfg)).
+		WithSessionConfig(cfg.Session).
+		WithExpiryConfig(cfg.Expiry)
+	if bus != nil {
+		bsm.WithMessageBus(bus, nodeId)
 	}
+	go bsm.CleanupPeriodically(ctx, bgm)
 
-	port := os.Getenv("PORT")
-	// psqlUrl := os.Getenv("DATABASE_URL")
-	// psqlDb := db.MustConnectToDb(psqlUrl)
-	// querier := sqlc.New(psqlDb)
+	rp := api.NewRequestProcessor(bsm, bgm, nil).WithUpgraderConfig(cfg.Upgrader).
+		WithRateLimitConfig(cfg.RateLimit).
+		WithChatConfig(cfg.Chat).
+		WithTournamentManager(btm)
+	if psqlDb != nil {
+		rp = rp.WithDBPinger(psqlDb)
+	}
+	if bus != nil {
+		if err := rp.ServeMessageBus(bus); err != nil {
+			panic(err)
+		}
+	}
 
-	bsm := mc.NewBattleshipSessionManager()
-	go bsm.CleanupPeriodically()
+	go btm.ExpireMatchesPeriodically(ctx, rp.NotifyTournamentResult)
 
-	bgm := mb.NewBattleshipGameManager()
-	
 	mux := http.NewServeMux()
-	mux.Handle("GET /battleship", api.NewRequestProcessor(bsm, bgm, nil))
+	mux.Handle("GET /battleship", rp)
+	mux.HandleFunc("GET /healthz", rp.HandleHealthz)
+	mux.HandleFunc("GET /readyz", rp.HandleReadyz)
+	mux.HandleFunc("GET /status", rp.HandleStatus)
+	mux.HandleFunc("GET /tournaments/{uuid}", rp.HandleTournamentStandings)
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	server := &http.Server{Addr: "0.0.0.0:" + cfg.Port, Handler: mux}
+	go func() {
+		slog.Info("listening", "port", cfg.Port, "version", buildinfo.Version, "commit", buildinfo.BuildCommit())
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server failed", logging.KeyError, err)
+			os.Exit(1)
+		}
+	}()
+
+	adminServer := startAdminServer(cfg, bsm, bgm, btm)
+
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down")
 
-	log.Printf("Listening to port %s\n", port)
-	log.Fatalln(http.ListenAndServe("0.0.0.0:"+port, mux))
+	// The listener is kept open while draining so that
+	// players of the games in progress can still reconnect
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.DrainWindow+shutdownCloseTimeout)
+	defer cancel()
+
+	rp.Shutdown(shutdownCtx, cfg.Shutdown)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server shutdown failed", logging.KeyError, err)
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("admin server shutdown failed", logging.KeyError, err)
+		}
+	}
+	slog.Info("server stopped")
+}
+
+// A store that cannot be read does not stop the server; the
+// games in it are lost but new ones can be played
+func restoreGames(ctx context.Context, gameManager mb.GameManager) {
+	restoreCtx, cancel := context.WithTimeout(ctx, sqlc.QuerierCtxTimeout)
+	defer cancel()
+
+	restored, err := gameManager.RestoreGames(restoreCtx)
+	if err != nil {
+		slog.Error("failed to restore games", logging.KeyError, err)
+	}
+	slog.Info("games restored", "count", restored)
+}
+
+// Same as restoreGames; needs the games restored first
+func restoreTournaments(ctx context.Context, tournamentManager mt.TournamentManager) {
+	restoreCtx, cancel := context.WithTimeout(ctx, sqlc.QuerierCtxTimeout)
+	defer cancel()
+
+	restored, err := tournamentManager.RestoreTournaments(restoreCtx)
+	if err != nil {
+		slog.Error("failed to restore tournaments", logging.KeyError, err)
+	}
+	slog.Info("tournaments restored", "count", restored)
+}
+
+// Falls back to the hostname, which is unique per machine
+// on most platforms
+func nodeIdOf(cfg config.Config) string {
+	if cfg.NodeId != "" {
+		return cfg.NodeId
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		panic(err)
+	}
+	return hostname
+}
+
+// The admin API is off unless a token is set
+func startAdminServer(cfg config.Config, sessionManager mc.SessionManager, gameManager mb.GameManager, tournamentManager mt.TournamentManager) *http.Server {
+	if cfg.AdminToken == "" {
+		return nil
+	}
+
+	adminServer := &http.Server{Addr: cfg.AdminAddr, Handler: api.NewAdminHandler(sessionManager, gameManager, tournamentManager, cfg.AdminToken)}
+	go func() {
+		slog.Info("admin API listening", "addr", cfg.AdminAddr)
+		if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("admin server failed", logging.KeyError, err)
+			os.Exit(1)
+		}
+	}()
+	return adminServer
+}
+
+// Without a secret, tokens are signed with a random one and
+// do not survive a restart; the players of restored games
+// need theirs to get back in, see config.Validate
+func newResumeTokenSigner(cfg config.Config) *token.Signer {
+	if cfg.ResumeTokenSecret == "" {
+		return token.NewRandomSigner(cfg.ResumeTokenTTL)
+	}
+	return token.NewSigner([]byte(cfg.ResumeTokenSecret), cfg.ResumeTokenTTL)
 }
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/saeidalz13/battleship-backend/db/sqlc"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+// Keeps the owners of the games in the game_owners table
+type PostgresGameRegistry struct {
+	q sqlc.Querier
+}
+
+var _ mb.GameRegistry = (*PostgresGameRegistry)(nil)
+
+func NewPostgresGameRegistry(q sqlc.Querier) *PostgresGameRegistry {
+	return &PostgresGameRegistry{q: q}
+}
+
+func (pgr *PostgresGameRegistry) RegisterGame(ctx context.Context, gameUuid, nodeId string) error {
+	return pgr.q.UpsertGameOwner(ctx, sqlc.UpsertGameOwnerParams{GameUuid: gameUuid, NodeID: nodeId})
+}
+
+func (pgr *PostgresGameRegistry) GameOwner(ctx context.Context, gameUuid string) (string, error) {
+	nodeId, err := pgr.q.GetGameOwner(ctx, gameUuid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", cerr.ErrGameNotExists(gameUuid)
+	}
+	return nodeId, err
+}
+
+func (pgr *PostgresGameRegistry) UnregisterGame(ctx context.Context, gameUuid string) error {
+	return pgr.q.DeleteGameOwner(ctx, gameUuid)
+}
+
+const (
+	busChannel = "battleship_bus"
+
+	// Postgres rejects larger NOTIFY payloads
+	maxBusPayload = 8000
+
+	busMinReconnectInterval = time.Second
+	busMaxReconnectInterval = time.Minute
+)
+
+// Publishes with NOTIFY and receives with LISTEN on a single
+// channel. Every node gets every msg and drops the ones for
+// other nodes. Msgs sent while a node reconnects are lost.
+type PostgresBus struct {
+	q        sqlc.Querier
+	listener *pq.Listener
+
+	handlers map[string][]func(mc.BusMessage)
+	mu       sync.RWMutex
+	done     chan struct{}
+}
+
+var _ mc.MessageBus = (*PostgresBus)(nil)
+
+// The listener needs a connection of its own, hence the URL
+func NewPostgresBus(psqlUrl string, q sqlc.Querier) (*PostgresBus, error) {
+	listener := pq.NewListener(psqlUrl, busMinReconnectInterval, busMaxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("message bus listener event", "event", event, logging.KeyError, err)
+		}
+	})
+	if err := listener.Listen(busChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	pb := &PostgresBus{
+		q:        q,
+		listener: listener,
+		handlers: make(map[string][]func(mc.BusMessage), 1),
+		done:     make(chan struct{}),
+	}
+	go pb.listen()
+	return pb, nil
+}
+
+func (pb *PostgresBus) Publish(ctx context.Context, msg mc.BusMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxBusPayload {
+		return fmt.Errorf("bus message of %d bytes exceeds the limit of %d", len(payload), maxBusPayload)
+	}
+	return pb.q.NotifyBus(ctx, string(payload))
+}
+
+func (pb *PostgresBus) Subscribe(nodeId string, handler func(mc.BusMessage)) error {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	pb.handlers[nodeId] = append(pb.handlers[nodeId], handler)
+	return nil
+}
+
+func (pb *PostgresBus) Close() error {
+	select {
+	case <-pb.done:
+		return nil
+	default:
+		close(pb.done)
+	}
+	return pb.listener.Close()
+}
+
+func (pb *PostgresBus) listen() {
+	for {
+		select {
+		case <-pb.done:
+			return
+
+		case notification, ok := <-pb.listener.Notify:
+			if !ok {
+				return
+			}
+			// nil after the listener reconnected
+			if notification == nil {
+				continue
+			}
+
+			var msg mc.BusMessage
+			if err := json.Unmarshal([]byte(notification.Extra), &msg); err != nil {
+				slog.Warn("invalid message on the bus", logging.KeyError, err)
+				continue
+			}
+			pb.dispatch(msg)
+		}
+	}
+}
+
+func (pb *PostgresBus) dispatch(msg mc.BusMessage) {
+	pb.mu.RLock()
+	defer pb.mu.RUnlock()
+
+	for nodeId, handlers := range pb.handlers {
+		if msg.NodeId != "" && msg.NodeId != nodeId {
+			continue
+		}
+		for _, handler := range handlers {
+			handler(msg)
+		}
+	}
+}
@@ -2,7 +2,7 @@ package db
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -12,10 +12,6 @@ import (
 )
 
 const (
-	maxOpenConns = 300
-	maxIdleConns = 100
-	connMaxLife  = time.Minute * 15
-
 	// there is a 'SchemeFromURL' function that splits the migrationDir by ':', so db/migration will be the URL
 	migrationDir = "file:db/migration"
 
@@ -41,7 +37,7 @@ func MustMigrate(db *sql.DB) {
 	version, dirty, err := migrate.Version()
 	if err != nil {
 		if err.Error() == ErrNoMigration {
-			log.Println(err)
+			slog.Info("no migration applied yet", "err", err)
 		} else {
 			panic(err)
 		}
@@ -49,7 +45,7 @@ func MustMigrate(db *sql.DB) {
 	if dirty {
 		panic(ErrDirtyDatabase)
 	}
-	log.Println("migration version:", version)
+	slog.Info("migration version", "version", version)
 
 	if err = migrate.Up(); err != nil {
 		if err.Error() == ErrMigrationNoChange {
@@ -60,10 +56,24 @@ func MustMigrate(db *sql.DB) {
 		}
 		panic(err)
 	}
-	log.Println("migration successful...")
+	slog.Info("migration successful")
+}
+
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		MaxOpenConns:    300,
+		MaxIdleConns:    100,
+		ConnMaxLifetime: time.Minute * 15,
+	}
 }
 
-func MustConnectToDb(psqlUrl string) *sql.DB {
+func MustConnectToDb(psqlUrl string, pool PoolConfig) *sql.DB {
 
 	// open a database driver or instance
 	// Open may just validate its arguments without creating a connection to the database
@@ -78,11 +88,11 @@ func MustConnectToDb(psqlUrl string) *sql.DB {
 	}
 
 	// set db pool custom configs
-	db.SetMaxOpenConns(maxOpenConns)
-	db.SetMaxIdleConns(maxIdleConns)
-	db.SetConnMaxLifetime(connMaxLife)
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
 
 	MustMigrate(db)
-	log.Println("connected to database...")
+	slog.Info("connected to database")
 	return db
 }
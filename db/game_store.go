@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/saeidalz13/battleship-backend/db/sqlc"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+)
+
+// Keeps the snapshots as jsonb in the game_snapshots table.
+// Rows written by an older server are migrated when read,
+// see SnapshotVersion.
+type PostgresGameStore struct {
+	q sqlc.Querier
+}
+
+var _ mb.GameStore = (*PostgresGameStore)(nil)
+
+func NewPostgresGameStore(q sqlc.Querier) *PostgresGameStore {
+	return &PostgresGameStore{q: q}
+}
+
+func (pgs *PostgresGameStore) SaveGame(ctx context.Context, snapshot mb.GameSnapshot) error {
+	snapshotJson, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return pgs.q.UpsertGameSnapshot(ctx, sqlc.UpsertGameSnapshotParams{
+		GameUuid: snapshot.Uuid,
+		Phase:    snapshot.Phase,
+		Snapshot: snapshotJson,
+	})
+}
+
+func (pgs *PostgresGameStore) LoadGame(ctx context.Context, gameUuid string) (mb.GameSnapshot, error) {
+	snapshotJson, err := pgs.q.GetGameSnapshot(ctx, gameUuid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return mb.GameSnapshot{}, cerr.ErrGameNotExists(gameUuid)
+	}
+	if err != nil {
+		return mb.GameSnapshot{}, err
+	}
+
+	var snapshot mb.GameSnapshot
+	err = json.Unmarshal(snapshotJson, &snapshot)
+	return snapshot, err
+}
+
+func (pgs *PostgresGameStore) DeleteGame(ctx context.Context, gameUuid string) error {
+	return pgs.q.DeleteGameSnapshot(ctx, gameUuid)
+}
+
+func (pgs *PostgresGameStore) ListUnfinishedGames(ctx context.Context) ([]mb.GameSnapshot, error) {
+	snapshotsJson, err := pgs.q.ListUnfinishedGameSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]mb.GameSnapshot, 0, len(snapshotsJson))
+	for _, snapshotJson := range snapshotsJson {
+		var snapshot mb.GameSnapshot
+		if err := json.Unmarshal(snapshotJson, &snapshot); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS game_snapshots
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS game_snapshots (
+    game_uuid text PRIMARY KEY,
+    phase text NOT NULL,
+    snapshot jsonb NOT NULL,
+    updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS game_snapshots_phase_idx ON game_snapshots (phase);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS game_owners
\ No newline at end of file
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS game_owners (
+    game_uuid text PRIMARY KEY,
+    node_id text NOT NULL,
+    registered_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
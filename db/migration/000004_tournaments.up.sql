@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS tournaments (
+    uuid text PRIMARY KEY,
+    format text NOT NULL,
+    difficulty smallint NOT NULL,
+    status text NOT NULL,
+    champion_seed integer NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS tournaments_status_idx ON tournaments (status);
+
+CREATE TABLE IF NOT EXISTS tournament_entrants (
+    tournament_uuid text NOT NULL REFERENCES tournaments (uuid) ON DELETE CASCADE,
+    seed integer NOT NULL,
+    name text NOT NULL,
+    seat_token text NOT NULL,
+    PRIMARY KEY (tournament_uuid, seed)
+);
+
+CREATE TABLE IF NOT EXISTS tournament_matches (
+    tournament_uuid text NOT NULL REFERENCES tournaments (uuid) ON DELETE CASCADE,
+    match_id integer NOT NULL,
+    round integer NOT NULL,
+    seed_a integer NOT NULL DEFAULT 0,
+    seed_b integer NOT NULL DEFAULT 0,
+    status text NOT NULL,
+    game_uuid text NOT NULL DEFAULT '',
+    deadline timestamp,
+    host_seed integer NOT NULL DEFAULT 0,
+    join_seed integer NOT NULL DEFAULT 0,
+    winner_seed integer NOT NULL DEFAULT 0,
+    decided_by text NOT NULL DEFAULT '',
+    next_match_id integer NOT NULL DEFAULT 0,
+    next_slot integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (tournament_uuid, match_id)
+);
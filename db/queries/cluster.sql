@@ -0,0 +1,15 @@
+-- name: UpsertGameOwner :exec
+INSERT INTO game_owners (game_uuid, node_id, registered_at)
+VALUES ($1, $2, CURRENT_TIMESTAMP) ON CONFLICT (game_uuid) DO
+UPDATE
+SET node_id = EXCLUDED.node_id,
+    registered_at = CURRENT_TIMESTAMP;
+
+-- name: GetGameOwner :one
+SELECT node_id FROM game_owners WHERE game_uuid = $1;
+
+-- name: DeleteGameOwner :exec
+DELETE FROM game_owners WHERE game_uuid = $1;
+
+-- name: NotifyBus :exec
+SELECT pg_notify('battleship_bus', sqlc.arg(payload)::text);
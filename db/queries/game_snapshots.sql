@@ -0,0 +1,16 @@
+-- name: UpsertGameSnapshot :exec
+INSERT INTO game_snapshots (game_uuid, phase, snapshot, updated_at)
+VALUES ($1, $2, $3, CURRENT_TIMESTAMP) ON CONFLICT (game_uuid) DO
+UPDATE
+SET phase = EXCLUDED.phase,
+    snapshot = EXCLUDED.snapshot,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: GetGameSnapshot :one
+SELECT snapshot FROM game_snapshots WHERE game_uuid = $1;
+
+-- name: DeleteGameSnapshot :exec
+DELETE FROM game_snapshots WHERE game_uuid = $1;
+
+-- name: ListUnfinishedGameSnapshots :many
+SELECT snapshot FROM game_snapshots WHERE phase <> 'finished' ORDER BY updated_at;
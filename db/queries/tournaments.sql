@@ -0,0 +1,36 @@
+-- name: UpsertTournament :exec
+INSERT INTO tournaments (uuid, format, difficulty, status, champion_seed, created_at)
+VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (uuid) DO
+UPDATE
+SET status = EXCLUDED.status,
+    champion_seed = EXCLUDED.champion_seed;
+
+-- name: InsertTournamentEntrant :exec
+INSERT INTO tournament_entrants (tournament_uuid, seed, name, seat_token)
+VALUES ($1, $2, $3, $4) ON CONFLICT (tournament_uuid, seed) DO NOTHING;
+
+-- name: UpsertTournamentMatch :exec
+INSERT INTO tournament_matches (
+    tournament_uuid, match_id, round, seed_a, seed_b, status, game_uuid, deadline,
+    host_seed, join_seed, winner_seed, decided_by, next_match_id, next_slot
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) ON CONFLICT (tournament_uuid, match_id) DO
+UPDATE
+SET seed_a = EXCLUDED.seed_a,
+    seed_b = EXCLUDED.seed_b,
+    status = EXCLUDED.status,
+    game_uuid = EXCLUDED.game_uuid,
+    deadline = EXCLUDED.deadline,
+    host_seed = EXCLUDED.host_seed,
+    join_seed = EXCLUDED.join_seed,
+    winner_seed = EXCLUDED.winner_seed,
+    decided_by = EXCLUDED.decided_by;
+
+-- name: ListRunningTournaments :many
+SELECT * FROM tournaments WHERE status = 'running' ORDER BY created_at;
+
+-- name: ListTournamentEntrants :many
+SELECT * FROM tournament_entrants WHERE tournament_uuid = $1 ORDER BY seed;
+
+-- name: ListTournamentMatches :many
+SELECT * FROM tournament_matches WHERE tournament_uuid = $1 ORDER BY match_id;
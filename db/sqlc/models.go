@@ -5,14 +5,62 @@
 package sqlc
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/sqlc-dev/pqtype"
 )
 
+type GameOwner struct {
+	GameUuid     string    `json:"game_uuid"`
+	NodeID       string    `json:"node_id"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
 type GameServerAnalytic struct {
 	ServerIp      pqtype.Inet `json:"server_ip"`
 	GamesCreated  int64       `json:"games_created"`
 	RematchCalled int64       `json:"rematch_called"`
 	LastUpdated   time.Time   `json:"last_updated"`
 }
+
+type GameSnapshot struct {
+	GameUuid  string          `json:"game_uuid"`
+	Phase     string          `json:"phase"`
+	Snapshot  json.RawMessage `json:"snapshot"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type Tournament struct {
+	Uuid         string    `json:"uuid"`
+	Format       string    `json:"format"`
+	Difficulty   int16     `json:"difficulty"`
+	Status       string    `json:"status"`
+	ChampionSeed int32     `json:"champion_seed"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type TournamentEntrant struct {
+	TournamentUuid string `json:"tournament_uuid"`
+	Seed           int32  `json:"seed"`
+	Name           string `json:"name"`
+	SeatToken      string `json:"seat_token"`
+}
+
+type TournamentMatch struct {
+	TournamentUuid string       `json:"tournament_uuid"`
+	MatchID        int32        `json:"match_id"`
+	Round          int32        `json:"round"`
+	SeedA          int32        `json:"seed_a"`
+	SeedB          int32        `json:"seed_b"`
+	Status         string       `json:"status"`
+	GameUuid       string       `json:"game_uuid"`
+	Deadline       sql.NullTime `json:"deadline"`
+	HostSeed       int32        `json:"host_seed"`
+	JoinSeed       int32        `json:"join_seed"`
+	WinnerSeed     int32        `json:"winner_seed"`
+	DecidedBy      string       `json:"decided_by"`
+	NextMatchID    int32        `json:"next_match_id"`
+	NextSlot       int32        `json:"next_slot"`
+}
@@ -6,6 +6,7 @@ package sqlc
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/sqlc-dev/pqtype"
 )
@@ -15,6 +16,20 @@ type Querier interface {
 	AnalyticsGetRematchCalledCount(ctx context.Context, serverIp pqtype.Inet) (int64, error)
 	AnalyticsIncrementGamesCreatedCount(ctx context.Context, serverIp pqtype.Inet) error
 	AnalyticsIncrementRematchCalledCount(ctx context.Context, serverIp pqtype.Inet) error
+	DeleteGameOwner(ctx context.Context, gameUuid string) error
+	DeleteGameSnapshot(ctx context.Context, gameUuid string) error
+	GetGameOwner(ctx context.Context, gameUuid string) (string, error)
+	GetGameSnapshot(ctx context.Context, gameUuid string) (json.RawMessage, error)
+	InsertTournamentEntrant(ctx context.Context, arg InsertTournamentEntrantParams) error
+	ListRunningTournaments(ctx context.Context) ([]Tournament, error)
+	ListTournamentEntrants(ctx context.Context, tournamentUuid string) ([]TournamentEntrant, error)
+	ListTournamentMatches(ctx context.Context, tournamentUuid string) ([]TournamentMatch, error)
+	ListUnfinishedGameSnapshots(ctx context.Context) ([]json.RawMessage, error)
+	NotifyBus(ctx context.Context, payload string) error
+	UpsertGameOwner(ctx context.Context, arg UpsertGameOwnerParams) error
+	UpsertGameSnapshot(ctx context.Context, arg UpsertGameSnapshotParams) error
+	UpsertTournament(ctx context.Context, arg UpsertTournamentParams) error
+	UpsertTournamentMatch(ctx context.Context, arg UpsertTournamentMatchParams) error
 }
 
 var _ Querier = (*Queries)(nil)
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/saeidalz13/battleship-backend/db/sqlc"
+	mt "github.com/saeidalz13/battleship-backend/models/tournament"
+)
+
+// Keeps the tournaments in the tournaments, tournament_entrants
+// and tournament_matches tables. The entrants never change, so
+// they are only written once.
+type PostgresTournamentStore struct {
+	q sqlc.Querier
+}
+
+var _ mt.TournamentStore = (*PostgresTournamentStore)(nil)
+
+func NewPostgresTournamentStore(q sqlc.Querier) *PostgresTournamentStore {
+	return &PostgresTournamentStore{q: q}
+}
+
+func (pts *PostgresTournamentStore) SaveTournament(ctx context.Context, tournament mt.Tournament) error {
+	err := pts.q.UpsertTournament(ctx, sqlc.UpsertTournamentParams{
+		Uuid:         tournament.Uuid,
+		Format:       tournament.Format,
+		Difficulty:   int16(tournament.Difficulty),
+		Status:       tournament.Status,
+		ChampionSeed: int32(tournament.Champion),
+		CreatedAt:    tournament.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entrant := range tournament.Entrants {
+		err := pts.q.InsertTournamentEntrant(ctx, sqlc.InsertTournamentEntrantParams{
+			TournamentUuid: tournament.Uuid,
+			Seed:           int32(entrant.Seed),
+			Name:           entrant.Name,
+			SeatToken:      entrant.SeatToken,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, m := range tournament.Matches {
+		err := pts.q.UpsertTournamentMatch(ctx, sqlc.UpsertTournamentMatchParams{
+			TournamentUuid: tournament.Uuid,
+			MatchID:        int32(m.Id),
+			Round:          int32(m.Round),
+			SeedA:          int32(m.SeedA),
+			SeedB:          int32(m.SeedB),
+			Status:         m.Status,
+			GameUuid:       m.GameUuid,
+			Deadline:       sql.NullTime{Time: m.Deadline, Valid: !m.Deadline.IsZero()},
+			HostSeed:       int32(m.HostSeed),
+			JoinSeed:       int32(m.JoinSeed),
+			WinnerSeed:     int32(m.Winner),
+			DecidedBy:      m.DecidedBy,
+			NextMatchID:    int32(m.NextMatchId),
+			NextSlot:       int32(m.NextSlot),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pts *PostgresTournamentStore) ListRunningTournaments(ctx context.Context) ([]mt.Tournament, error) {
+	rows, err := pts.q.ListRunningTournaments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tournaments := make([]mt.Tournament, 0, len(rows))
+	for _, row := range rows {
+		tournament := mt.Tournament{
+			Uuid:       row.Uuid,
+			Format:     row.Format,
+			Difficulty: uint8(row.Difficulty),
+			Status:     row.Status,
+			Champion:   int(row.ChampionSeed),
+			CreatedAt:  row.CreatedAt,
+		}
+
+		entrants, err := pts.q.ListTournamentEntrants(ctx, row.Uuid)
+		if err != nil {
+			return nil, err
+		}
+		for _, entrant := range entrants {
+			tournament.Entrants = append(tournament.Entrants, mt.Entrant{Seed: int(entrant.Seed), Name: entrant.Name, SeatToken: entrant.SeatToken})
+		}
+
+		matches, err := pts.q.ListTournamentMatches(ctx, row.Uuid)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			tournament.Matches = append(tournament.Matches, &mt.Match{
+				Id:          int(m.MatchID),
+				Round:       int(m.Round),
+				SeedA:       int(m.SeedA),
+				SeedB:       int(m.SeedB),
+				Status:      m.Status,
+				GameUuid:    m.GameUuid,
+				Deadline:    m.Deadline.Time,
+				HostSeed:    int(m.HostSeed),
+				JoinSeed:    int(m.JoinSeed),
+				Winner:      int(m.WinnerSeed),
+				DecidedBy:   m.DecidedBy,
+				NextMatchId: int(m.NextMatchID),
+				NextSlot:    int(m.NextSlot),
+			})
+		}
+		tournaments = append(tournaments, tournament)
+	}
+	return tournaments, nil
+}
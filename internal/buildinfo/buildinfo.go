@@ -0,0 +1,34 @@
+/*
+Package buildinfo holds the version and commit the binary was
+built from. Both are set at build time, e.g.
+
+	go build -ldflags "-X github.com/saeidalz13/battleship-backend/internal/buildinfo.Version=v1.2.0 \
+		-X github.com/saeidalz13/battleship-backend/internal/buildinfo.Commit=$(git rev-parse --short HEAD)"
+*/
+package buildinfo
+
+import "runtime/debug"
+
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// Falls back to the revision the go toolchain stamps into the
+// binary when it is built inside a git checkout
+func BuildCommit() string {
+	if Commit != "" {
+		return Commit
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,70 @@
+/*
+Package clock lets the time based logic (session expiry,
+grace periods) run on a fake clock in tests instead of
+waiting for real time to pass.
+*/
+package clock
+
+import "time"
+
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	NewTimer(d time.Duration) Timer
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type Timer interface {
+	C() <-chan time.Time
+
+	// Same as time.Timer.Stop
+	Stop() bool
+}
+
+type realClock struct{}
+
+func Real() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
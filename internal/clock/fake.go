@@ -0,0 +1,151 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Time only moves on Advance. Timers and tickers fire during
+// Advance; like time.Ticker, a ticker drops the ticks the
+// receiver is not ready for.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	tickers []*fakeTicker
+	timers  []*fakeTimer
+}
+
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTicker{f: f, period: d, next: f.now.Add(d), c: make(chan time.Time, 1)}
+	f.tickers = append(f.tickers, t)
+	f.cond.Broadcast()
+	return t
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{f: f, deadline: f.now.Add(d), c: make(chan time.Time, 1)}
+	if !t.deadline.After(f.now) {
+		t.c <- f.now
+		return t
+	}
+
+	f.timers = append(f.timers, t)
+	f.cond.Broadcast()
+	return t
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+	for _, t := range f.tickers {
+		for !t.next.After(f.now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.period)
+		}
+	}
+
+	pending := f.timers[:0]
+	for _, t := range f.timers {
+		if t.deadline.After(f.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- t.deadline
+	}
+	f.timers = pending
+}
+
+// Blocks until at least n tickers and timers (including
+// sleeps) are waiting, so that a test does not advance the
+// clock before the code under test has started waiting
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.tickers)+len(f.timers) < n {
+		f.cond.Wait()
+	}
+}
+
+type fakeTicker struct {
+	f      *Fake
+	period time.Duration
+	next   time.Time
+	c      chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+
+	for i, ticker := range t.f.tickers {
+		if ticker == t {
+			t.f.tickers = append(t.f.tickers[:i], t.f.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTimer struct {
+	f        *Fake
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+
+	for i, timer := range t.f.timers {
+		if timer == t {
+			t.f.timers = append(t.f.timers[:i], t.f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
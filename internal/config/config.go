@@ -0,0 +1,196 @@
+/*
+Package config loads the settings of the server. Every setting
+has a default which can be overridden, from lowest to highest
+precedence, by:
+ 1. a YAML file (`-config` flag or CONFIG_FILE)
+ 2. its environment variable
+ 3. its command line flag
+
+The keys of the file and the names of the flags are the same,
+e.g. `session.grace_period` is
+
+	session:
+	  grace_period: 3m
+
+in the file, SESSION_GRACE_PERIOD in the environment and
+`-session.grace_period=3m` on the command line. See fields
+for the full list.
+*/
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saeidalz13/battleship-backend/api"
+	"github.com/saeidalz13/battleship-backend/db"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+	ms "github.com/saeidalz13/battleship-backend/models/server"
+	mt "github.com/saeidalz13/battleship-backend/models/tournament"
+)
+
+// Only reachable from the machine itself unless overridden
+const defaultAdminAddr = "127.0.0.1:1314"
+
+const redacted = "[REDACTED]"
+
+type Config struct {
+	Stage string
+	Port  string
+
+	Log logging.Config
+
+	// Empty DatabaseUrl means no database
+	DatabaseUrl string
+	DBPool      db.PoolConfig
+
+	Upgrader  api.UpgraderConfig
+	RateLimit api.RateLimitConfig
+	Shutdown  api.ShutdownConfig
+	Chat      api.ChatConfig
+
+	Session mc.SessionConfig
+	Expiry  mc.ExpiryConfig
+
+	// Empty secret means a random one on every start
+	ResumeTokenSecret string
+	ResumeTokenTTL    time.Duration
+
+	Game mb.GameConfig
+
+	// One of the mb.GameStore constants; postgres needs
+	// DatabaseUrl. The tournaments are kept in the same place.
+	GameStore string
+
+	Tournament mt.TournamentConfig
+
+	// One of the mc.MessageBus constants; postgres needs
+	// DatabaseUrl and also keeps the game registry there
+	NodeId     string
+	MessageBus string
+
+	// Empty token disables the admin API
+	AdminToken string
+	AdminAddr  string
+}
+
+// The defaults of each section are the ones of its package
+func Default() Config {
+	return Config{
+		Port:           "1313",
+		Log:            logging.DefaultConfig(),
+		DBPool:         db.DefaultPoolConfig(),
+		Upgrader:       api.DefaultUpgraderConfig(),
+		RateLimit:      api.DefaultRateLimitConfig(),
+		Shutdown:       api.DefaultShutdownConfig(),
+		Chat:           api.DefaultChatConfig(),
+		Session:        mc.DefaultSessionConfig(),
+		Expiry:         mc.DefaultExpiryConfig(),
+		ResumeTokenTTL: mc.DefaultResumeTokenTTL,
+		Game:           mb.DefaultGameConfig(),
+		GameStore:      mb.GameStoreMemory,
+		Tournament:     mt.DefaultTournamentConfig(),
+		MessageBus:     mc.MessageBusNone,
+		AdminAddr:      defaultAdminAddr,
+	}
+}
+
+// Returns every invalid setting at once
+func (cfg Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+		}
+	}
+
+	check(cfg.Stage == ms.DevStageCode || cfg.Stage == ms.ProdStageCode, "stage", "must be either %s or %s, got %q", ms.DevStageCode, ms.ProdStageCode, cfg.Stage)
+	port, err := strconv.Atoi(cfg.Port)
+	check(err == nil && port > 0 && port < 65536, "port", "must be a port number, got %q", cfg.Port)
+	check(cfg.Log.Format == logging.FormatText || cfg.Log.Format == logging.FormatJSON, "log.format", "must be either %s or %s, got %q", logging.FormatText, logging.FormatJSON, cfg.Log.Format)
+
+	check(cfg.DBPool.MaxOpenConns > 0, "db.max_open_conns", "must be positive")
+	check(cfg.DBPool.MaxIdleConns >= 0 && cfg.DBPool.MaxIdleConns <= cfg.DBPool.MaxOpenConns, "db.max_idle_conns", "must be between 0 and db.max_open_conns")
+	check(cfg.DBPool.ConnMaxLifetime >= 0, "db.conn_max_lifetime", "must not be negative")
+
+	check(cfg.Upgrader.HandshakeTimeout > 0, "websocket.handshake_timeout", "must be positive")
+	check(cfg.Upgrader.ReadBufferSize > 0, "websocket.read_buffer_size", "must be positive")
+	check(cfg.Upgrader.WriteBufferSize > 0, "websocket.write_buffer_size", "must be positive")
+	check(cfg.Upgrader.ReadLimit > 0, "websocket.read_limit", "must be positive")
+
+	check(cfg.RateLimit.MessagesPerSecond >= 0, "rate_limit.messages_per_second", "must not be negative")
+	check(cfg.RateLimit.MessageBurst >= 0, "rate_limit.message_burst", "must not be negative")
+	check(cfg.RateLimit.MaxConnsPerIp >= 0, "rate_limit.max_conns_per_ip", "must not be negative")
+	check(cfg.RateLimit.NewSessionsPerMinutePerIp >= 0, "rate_limit.new_sessions_per_minute_per_ip", "must not be negative")
+
+	check(cfg.Chat.MaxLength > 0, "chat.max_length", "must be positive")
+	check(cfg.Chat.MessagesPerSecond >= 0, "chat.messages_per_second", "must not be negative")
+	check(cfg.Chat.MessageBurst >= 0, "chat.message_burst", "must not be negative")
+
+	check(cfg.Shutdown.DrainWindow >= 0, "shutdown.drain_window", "must not be negative")
+	check(cfg.Shutdown.RetryAfter >= 0, "shutdown.retry_after", "must not be negative")
+
+	check(cfg.Session.GracePeriod > 0, "session.grace_period", "must be positive")
+	check(cfg.Session.RetryBackoff >= 0, "session.retry_backoff", "must not be negative")
+	check(cfg.Session.EventLogSize > 0, "session.event_log_size", "must be positive")
+	check(cfg.Expiry.IdleTimeout >= 0, "session.idle_timeout", "must not be negative")
+	check(cfg.Expiry.MaxLifetime >= 0, "session.max_lifetime", "must not be negative")
+	check(cfg.Expiry.SweepInterval > 0, "session.sweep_interval", "must be positive")
+
+	check(cfg.ResumeTokenTTL > 0, "resume_token.ttl", "must be positive")
+
+	checkGridSize := func(size uint8, key string) {
+		check(size >= mb.MinGridSize && size <= mb.MaxGridSize, key, "must be between %d and %d, got %d", mb.MinGridSize, mb.MaxGridSize, size)
+	}
+	checkGridSize(cfg.Game.GridSizeEasy, "game.grid_size_easy")
+	checkGridSize(cfg.Game.GridSizeNormal, "game.grid_size_normal")
+	checkGridSize(cfg.Game.GridSizeHard, "game.grid_size_hard")
+	check(cfg.Game.RestoreMaxAge >= 0, "game.restore_max_age", "must not be negative")
+	check(cfg.Game.RestoreClaimWindow > 0, "game.restore_claim_window", "must be positive")
+	check(cfg.GameStore == mb.GameStoreMemory || cfg.GameStore == mb.GameStorePostgres, "game.store", "must be either %s or %s, got %q", mb.GameStoreMemory, mb.GameStorePostgres, cfg.GameStore)
+	check(cfg.GameStore != mb.GameStorePostgres || cfg.DatabaseUrl != "", "game.store", "%s needs db.url", mb.GameStorePostgres)
+	check(cfg.GameStore != mb.GameStorePostgres || cfg.ResumeTokenSecret != "", "game.store", "%s needs resume_token.secret so that players can resume the restored games", mb.GameStorePostgres)
+	check(cfg.Tournament.NoShowTimeout > 0, "tournament.no_show_timeout", "must be positive")
+	check(cfg.Tournament.SweepInterval > 0, "tournament.sweep_interval", "must be positive")
+	check(cfg.MessageBus == mc.MessageBusNone || cfg.MessageBus == mc.MessageBusPostgres, "cluster.bus", "must be either %s or %s, got %q", mc.MessageBusNone, mc.MessageBusPostgres, cfg.MessageBus)
+	check(cfg.MessageBus != mc.MessageBusPostgres || cfg.DatabaseUrl != "", "cluster.bus", "%s needs db.url", mc.MessageBusPostgres)
+
+	return errors.Join(errs...)
+}
+
+// Logs as one group per section with the secrets redacted,
+// e.g. slog.Info("effective config", "config", &cfg)
+func (cfg *Config) LogValue() slog.Value {
+	var (
+		attrs    []slog.Attr
+		sections = make(map[string]int)
+	)
+	for _, f := range cfg.fields() {
+		value := f.get()
+		if f.secret && value != "" {
+			value = redacted
+		}
+
+		section, key, nested := strings.Cut(f.key, ".")
+		if !nested {
+			attrs = append(attrs, slog.String(f.key, value))
+			continue
+		}
+
+		i, ok := sections[section]
+		if !ok {
+			i = len(attrs)
+			sections[section] = i
+			attrs = append(attrs, slog.Group(section))
+		}
+		group := attrs[i].Value.Group()
+		attrs[i] = slog.Attr{Key: section, Value: slog.GroupValue(append(group, slog.String(key, value))...)}
+	}
+	return slog.GroupValue(attrs...)
+}
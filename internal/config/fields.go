@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+)
+
+// A single setting. Whatever the source, its value goes
+// through `set` as a string so that it is parsed only once.
+type field struct {
+	// Key in the file and name of the flag
+	key    string
+	env    string
+	usage  string
+	secret bool
+
+	set func(string) error
+	get func() string
+}
+
+// Every setting with its env variable. The names of the
+// variables that existed before this package are kept.
+func (cfg *Config) fields() []field {
+	return []field{
+		stringField("stage", "STAGE", "dev or prod", &cfg.Stage),
+		stringField("port", "PORT", "port of the game server", &cfg.Port),
+
+		stringField("log.format", "LOG_FORMAT", "text or json", &cfg.Log.Format),
+		levelField("log.level", "LOG_LEVEL", "debug, info, warn or error", &cfg.Log.Level),
+
+		secretField("db.url", "DATABASE_URL", "postgres connection string; empty means no database", &cfg.DatabaseUrl),
+		intField("db.max_open_conns", "DB_MAX_OPEN_CONNS", "max open connections of the pool", &cfg.DBPool.MaxOpenConns),
+		intField("db.max_idle_conns", "DB_MAX_IDLE_CONNS", "max idle connections of the pool", &cfg.DBPool.MaxIdleConns),
+		durationField("db.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", "max lifetime of a pooled connection", &cfg.DBPool.ConnMaxLifetime),
+
+		listField("websocket.allowed_origins", "ALLOWED_ORIGINS", "comma separated browser origins allowed to connect", &cfg.Upgrader.AllowedOrigins),
+		boolField("websocket.allow_no_origin", "ALLOW_NO_ORIGIN", "whether clients without an Origin header may connect", &cfg.Upgrader.AllowNoOrigin),
+		durationField("websocket.handshake_timeout", "WS_HANDSHAKE_TIMEOUT", "timeout of the websocket handshake", &cfg.Upgrader.HandshakeTimeout),
+		intField("websocket.read_buffer_size", "WS_READ_BUFFER_SIZE", "read buffer size in bytes", &cfg.Upgrader.ReadBufferSize),
+		intField("websocket.write_buffer_size", "WS_WRITE_BUFFER_SIZE", "write buffer size in bytes", &cfg.Upgrader.WriteBufferSize),
+		int64Field("websocket.read_limit", "WS_READ_LIMIT", "max size in bytes of an incoming message", &cfg.Upgrader.ReadLimit),
+
+		floatField("rate_limit.messages_per_second", "RATE_LIMIT_MESSAGES_PER_SECOND", "messages per second of a session; 0 disables", &cfg.RateLimit.MessagesPerSecond),
+		intField("rate_limit.message_burst", "RATE_LIMIT_MESSAGE_BURST", "message burst of a session; 0 disables", &cfg.RateLimit.MessageBurst),
+		intField("rate_limit.max_conns_per_ip", "RATE_LIMIT_MAX_CONNS_PER_IP", "open connections per IP; 0 disables", &cfg.RateLimit.MaxConnsPerIp),
+		intField("rate_limit.new_sessions_per_minute_per_ip", "RATE_LIMIT_NEW_SESSIONS_PER_MINUTE_PER_IP", "new sessions per minute per IP; 0 disables", &cfg.RateLimit.NewSessionsPerMinutePerIp),
+		stringField("rate_limit.client_ip_header", "CLIENT_IP_HEADER", "header with the real client IP behind a proxy", &cfg.RateLimit.ClientIpHeader),
+
+		durationField("session.grace_period", "SESSION_GRACE_PERIOD", "how long a dropped player has to reconnect", &cfg.Session.GracePeriod),
+		uint8Field("session.max_retries", "SESSION_MAX_RETRIES", "retries of a failed read or write", &cfg.Session.MaxRetries),
+		durationField("session.retry_backoff", "SESSION_RETRY_BACKOFF", "wait before the first retry, multiplied by the retry number", &cfg.Session.RetryBackoff),
+		intField("session.event_log_size", "SESSION_EVENT_LOG_SIZE", "events kept per session for replays", &cfg.Session.EventLogSize),
+		durationField("session.idle_timeout", "SESSION_IDLE_TIMEOUT", "expire sessions idle for this long; 0 disables", &cfg.Expiry.IdleTimeout),
+		durationField("session.max_lifetime", "SESSION_MAX_LIFETIME", "expire sessions open for this long; 0 disables", &cfg.Expiry.MaxLifetime),
+		durationField("session.sweep_interval", "SESSION_SWEEP_INTERVAL", "how often sessions are checked for expiry", &cfg.Expiry.SweepInterval),
+
+		secretField("resume_token.secret", "RESUME_TOKEN_SECRET", "HMAC secret of the resume tokens; random if empty", &cfg.ResumeTokenSecret),
+		durationField("resume_token.ttl", "RESUME_TOKEN_TTL", "how long a resume token is valid", &cfg.ResumeTokenTTL),
+
+		intField("chat.max_length", "CHAT_MAX_LENGTH", "max characters of a chat message", &cfg.Chat.MaxLength),
+		floatField("chat.messages_per_second", "CHAT_MESSAGES_PER_SECOND", "chat messages and emotes per second of a session; 0 disables", &cfg.Chat.MessagesPerSecond),
+		intField("chat.message_burst", "CHAT_MESSAGE_BURST", "chat messages and emotes a session may send at once", &cfg.Chat.MessageBurst),
+		listField("chat.blocked_words", "CHAT_BLOCKED_WORDS", "comma separated words masked in chat messages", &cfg.Chat.BlockedWords),
+
+		durationField("shutdown.drain_window", "SHUTDOWN_DRAIN_WINDOW", "how long games may still be played on SIGTERM", &cfg.Shutdown.DrainWindow),
+		durationField("shutdown.retry_after", "SHUTDOWN_RETRY_AFTER", "reconnect hint sent to the clients on shutdown", &cfg.Shutdown.RetryAfter),
+
+		uint8Field("game.grid_size_easy", "GAME_GRID_SIZE_EASY", "grid size of easy games", &cfg.Game.GridSizeEasy),
+		uint8Field("game.grid_size_normal", "GAME_GRID_SIZE_NORMAL", "grid size of normal games", &cfg.Game.GridSizeNormal),
+		uint8Field("game.grid_size_hard", "GAME_GRID_SIZE_HARD", "grid size of hard games", &cfg.Game.GridSizeHard),
+		stringField("game.store", "GAME_STORE", "where game snapshots are kept: memory or postgres", &cfg.GameStore),
+		durationField("game.restore_max_age", "GAME_RESTORE_MAX_AGE", "older snapshots are not restored on startup; 0 disables", &cfg.Game.RestoreMaxAge),
+		durationField("game.restore_claim_window", "GAME_RESTORE_CLAIM_WINDOW", "how long the players of a restored game have to resume it", &cfg.Game.RestoreClaimWindow),
+
+		durationField("tournament.no_show_timeout", "TOURNAMENT_NO_SHOW_TIMEOUT", "how long the entrants of a match have to take their seat", &cfg.Tournament.NoShowTimeout),
+		durationField("tournament.sweep_interval", "TOURNAMENT_SWEEP_INTERVAL", "how often the match deadlines are checked", &cfg.Tournament.SweepInterval),
+
+		stringField("cluster.node_id", "NODE_ID", "ID of this node among the ones sharing the bus; empty means the hostname", &cfg.NodeId),
+		stringField("cluster.bus", "CLUSTER_BUS", "message bus connecting the nodes: none or postgres", &cfg.MessageBus),
+
+		secretField("admin.token", "ADMIN_TOKEN", "bearer token of the admin API; empty disables it", &cfg.AdminToken),
+		stringField("admin.addr", "ADMIN_ADDR", "address the admin API listens on", &cfg.AdminAddr),
+	}
+}
+
+func stringField(key, env, usage string, p *string) field {
+	return field{
+		key: key, env: env, usage: usage,
+		set: func(s string) error { *p = s; return nil },
+		get: func() string { return *p },
+	}
+}
+
+func secretField(key, env, usage string, p *string) field {
+	f := stringField(key, env, usage, p)
+	f.secret = true
+	return f
+}
+
+// Comma separated; blanks around the commas are dropped
+func listField(key, env, usage string, p *[]string) field {
+	return field{
+		key: key, env: env, usage: usage,
+		set: func(s string) error {
+			var list []string
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			*p = list
+			return nil
+		},
+		get: func() string { return strings.Join(*p, ",") },
+	}
+}
+
+func parsedField[T any](key, env, usage string, p *T, parse func(string) (T, error), format func(T) string) field {
+	return field{
+		key: key, env: env, usage: usage,
+		set: func(s string) error {
+			v, err := parse(s)
+			if err != nil {
+				return err
+			}
+			*p = v
+			return nil
+		},
+		get: func() string { return format(*p) },
+	}
+}
+
+func boolField(key, env, usage string, p *bool) field {
+	return parsedField(key, env, usage, p, strconv.ParseBool, strconv.FormatBool)
+}
+
+func intField(key, env, usage string, p *int) field {
+	return parsedField(key, env, usage, p, strconv.Atoi, strconv.Itoa)
+}
+
+func int64Field(key, env, usage string, p *int64) field {
+	parse := func(s string) (int64, error) { return strconv.ParseInt(s, 10, 64) }
+	format := func(v int64) string { return strconv.FormatInt(v, 10) }
+	return parsedField(key, env, usage, p, parse, format)
+}
+
+func uint8Field(key, env, usage string, p *uint8) field {
+	parse := func(s string) (uint8, error) {
+		v, err := strconv.ParseUint(s, 10, 8)
+		return uint8(v), err
+	}
+	format := func(v uint8) string { return strconv.FormatUint(uint64(v), 10) }
+	return parsedField(key, env, usage, p, parse, format)
+}
+
+func floatField(key, env, usage string, p *float64) field {
+	parse := func(s string) (float64, error) { return strconv.ParseFloat(s, 64) }
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	return parsedField(key, env, usage, p, parse, format)
+}
+
+func durationField(key, env, usage string, p *time.Duration) field {
+	return parsedField(key, env, usage, p, time.ParseDuration, time.Duration.String)
+}
+
+func levelField(key, env, usage string, p *slog.Level) field {
+	format := func(l slog.Level) string { return strings.ToLower(l.String()) }
+	return parsedField(key, env, usage, p, logging.ParseLevel, format)
+}
+
+func (f field) setFrom(source, value string) error {
+	if err := f.set(value); err != nil {
+		return fmt.Errorf("invalid %s for %s: %w", source, f.key, err)
+	}
+	return nil
+}
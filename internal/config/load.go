@@ -0,0 +1,144 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Env variable with the path of the config file, if the
+// `-config` flag is not given
+const configFileEnv = "CONFIG_FILE"
+
+/*
+Load builds the config from the defaults, the optional file,
+`lookupEnv` (os.LookupEnv in main) and the command line
+`args` without the program name. Empty env variables count as
+unset. The result is validated.
+*/
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+	fields := cfg.fields()
+
+	// Flags win over the file and the env, so they are only
+	// recorded here and applied last
+	type flagValue struct {
+		f     field
+		value string
+	}
+	var flagValues []flagValue
+
+	fs := flag.NewFlagSet("battleship", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configPath := fs.String("config", "", "path of a YAML config file (env "+configFileEnv+")")
+	for _, f := range fields {
+		fs.Func(f.key, f.usage+" (env "+f.env+")", func(value string) error {
+			flagValues = append(flagValues, flagValue{f: f, value: value})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fs.SetOutput(os.Stderr)
+			fs.PrintDefaults()
+		}
+		return Config{}, err
+	}
+
+	path := *configPath
+	if path == "" {
+		path, _ = lookupEnv(configFileEnv)
+	}
+	if path != "" {
+		if err := loadFile(path, fields); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, f := range fields {
+		if value, ok := lookupEnv(f.env); ok && value != "" {
+			if err := f.setFrom("env "+f.env, value); err != nil {
+				return Config{}, err
+			}
+		}
+	}
+
+	for _, fv := range flagValues {
+		if err := fv.f.setFrom("flag", fv.value); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Unknown keys are an error so that a typo does not go
+// unnoticed
+func loadFile(path string, fields []field) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	var doc map[string]any
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	byKey := make(map[string]field, len(fields))
+	for _, f := range fields {
+		byKey[f.key] = f
+	}
+
+	values := make(map[string]string)
+	if err := flatten("", doc, values); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	for key, value := range values {
+		f, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("config file %s: unknown key %s", path, key)
+		}
+		if err := f.setFrom("value in "+path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Turns nested sections into dotted keys. Lists become
+// comma separated like in the env.
+func flatten(prefix string, node map[string]any, values map[string]string) error {
+	for name, value := range node {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		switch v := value.(type) {
+		case map[string]any:
+			if err := flatten(key, v, values); err != nil {
+				return err
+			}
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
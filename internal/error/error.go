@@ -1,6 +1,9 @@
 package error
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 const (
 	ConstErrCreateGame     = "create game operation failed"
@@ -8,95 +11,514 @@ const (
 	ConstErrReady          = "ready player operation failed"
 	ConstErrJoin           = "join player operation failed"
 	ConstErrInvalidPayload = "invalid request payload"
+	ConstErrReplay         = "replay events operation failed"
+	ConstErrRematchCall    = "rematch call operation failed"
+	ConstErrRematchAccept  = "rematch accept operation failed"
+	ConstErrInvalidSignal  = "invalid code in the incoming payload"
+	ConstErrRateLimited    = "rate limit exceeded"
+	ConstErrResumeSession  = "resume session operation failed"
+	ConstErrChat           = "chat operation failed"
+	ConstErrEmote          = "emote operation failed"
+	ConstErrTournament     = "tournament operation failed"
+	ConstErrSpecialAttack  = "special attack operation failed"
 )
 
+/*
+Error codes are part of the public API. Clients switch on
+them to localise errors, so a code must never be reused or
+renumbered; add new ones at the end of their group.
+*/
+type ErrCode uint16
+
+const (
+	// General
+	ErrCodeInternal ErrCode = 1000 + iota
+	ErrCodeInvalidPayload
+	ErrCodeSignalAbsent
+	ErrCodeInvalidSignal
+	ErrCodeNilPayload
+	ErrCodeKeyNotExists
+	ErrCodeInvalidValueType
+	ErrCodeRateLimited
+)
+
+const (
+	// Game
+	ErrCodeGameNotExists ErrCode = 1100 + iota
+	ErrCodeGameIsNil
+	ErrCodeInvalidGameDifficulty
+	ErrCodeRematchAlreadyCalled
+	ErrCodePlayerNotExist
+	ErrCodePlayerNotExistForRematch
+	ErrCodeInvalidSnapshot
+	ErrCodeSnapshotVersionUnsupported
+	ErrCodeInvalidSeriesLength
+	ErrCodeSeriesOver
+	ErrCodeInvalidFirstTurnPolicy
+	ErrCodeInvalidDisclosure
+	ErrCodeRematchNotCalled
+	ErrCodeGameNotFinished
+)
+
+const (
+	// Attack
+	ErrCodeXorYOutOfGridBound ErrCode = 1200 + iota
+	ErrCodeAttackPositionAlreadyFilled
+	ErrCodeNotTurnForAttacker
+	ErrCodeSpecialWeaponsDisabled
+	ErrCodeWeaponUsedUp
+	ErrCodeInvalidTorpedoOrientation
+	ErrCodeNothingToAttack
+)
+
+const (
+	// Defence grid
+	ErrCodeDefenceGridPositionAlreadyHit ErrCode = 1300 + iota
+	ErrCodeDefenceGridPositionEmpty
+	ErrCodeDefenceGridRowsOutOfBounds
+	ErrCodeDefenceGridColsOutOfBounds
+	ErrCodeDefenceGridInvalidPositionState
+	ErrCodeInvalidShipCode
+	ErrCodeInvalidShipOrientation
+	ErrCodeShipOutOfGridBound
+	ErrCodeShipsOverlap
+	ErrCodeShipMisplaced
+)
+
+const (
+	// Session
+	ErrCodeSessionNotFound ErrCode = 1400 + iota
+	ErrCodeSessionIsNil
+	ErrCodeEventsNoLongerAvailable
+	ErrCodeResumeTokenInvalid
+	ErrCodeResumeTokenExpired
+	ErrCodeResumeTokenReplayed
+)
+
+const (
+	// Chat
+	ErrCodeChatEmpty ErrCode = 1500 + iota
+	ErrCodeChatTooLong
+	ErrCodeChatRateLimited
+	ErrCodeEmoteUnknown
+	ErrCodeNoOpponent
+)
+
+const (
+	// Tournament
+	ErrCodeTournamentNotExists ErrCode = 1600 + iota
+	ErrCodeInvalidTournament
+	ErrCodeSeatTokenInvalid
+	ErrCodeNoTournamentMatch
+	ErrCodeAlreadyInGame
+	ErrCodeTournamentGame
+)
+
+var errCodeNames = map[ErrCode]string{
+	ErrCodeInternal:         "internal",
+	ErrCodeInvalidPayload:   "invalid_payload",
+	ErrCodeSignalAbsent:     "signal_absent",
+	ErrCodeInvalidSignal:    "invalid_signal",
+	ErrCodeNilPayload:       "nil_payload",
+	ErrCodeKeyNotExists:     "key_not_exists",
+	ErrCodeInvalidValueType: "invalid_value_type",
+	ErrCodeRateLimited:      "rate_limited",
+
+	ErrCodeGameNotExists:              "game_not_exists",
+	ErrCodeGameIsNil:                  "game_is_nil",
+	ErrCodeInvalidGameDifficulty:      "invalid_game_difficulty",
+	ErrCodeRematchAlreadyCalled:       "rematch_already_called",
+	ErrCodePlayerNotExist:             "player_not_exist",
+	ErrCodePlayerNotExistForRematch:   "player_not_exist_for_rematch",
+	ErrCodeInvalidSnapshot:            "invalid_snapshot",
+	ErrCodeSnapshotVersionUnsupported: "snapshot_version_unsupported",
+	ErrCodeInvalidSeriesLength:        "invalid_series_length",
+	ErrCodeSeriesOver:                 "series_over",
+	ErrCodeInvalidFirstTurnPolicy:     "invalid_first_turn_policy",
+	ErrCodeInvalidDisclosure:          "invalid_disclosure",
+	ErrCodeRematchNotCalled:           "rematch_not_called",
+	ErrCodeGameNotFinished:            "game_not_finished",
+
+	ErrCodeXorYOutOfGridBound:          "x_or_y_out_of_grid_bound",
+	ErrCodeAttackPositionAlreadyFilled: "attack_position_already_filled",
+	ErrCodeNotTurnForAttacker:          "not_turn_for_attacker",
+	ErrCodeSpecialWeaponsDisabled:      "special_weapons_disabled",
+	ErrCodeWeaponUsedUp:                "weapon_used_up",
+	ErrCodeInvalidTorpedoOrientation:   "invalid_torpedo_orientation",
+	ErrCodeNothingToAttack:             "nothing_to_attack",
+
+	ErrCodeDefenceGridPositionAlreadyHit:   "defence_grid_position_already_hit",
+	ErrCodeDefenceGridPositionEmpty:        "defence_grid_position_empty",
+	ErrCodeDefenceGridRowsOutOfBounds:      "defence_grid_rows_out_of_bounds",
+	ErrCodeDefenceGridColsOutOfBounds:      "defence_grid_cols_out_of_bounds",
+	ErrCodeDefenceGridInvalidPositionState: "defence_grid_invalid_position_state",
+	ErrCodeInvalidShipCode:                 "invalid_ship_code",
+	ErrCodeInvalidShipOrientation:          "invalid_ship_orientation",
+	ErrCodeShipOutOfGridBound:              "ship_out_of_grid_bound",
+	ErrCodeShipsOverlap:                    "ships_overlap",
+	ErrCodeShipMisplaced:                   "ship_misplaced",
+
+	ErrCodeSessionNotFound:         "session_not_found",
+	ErrCodeSessionIsNil:            "session_is_nil",
+	ErrCodeEventsNoLongerAvailable: "events_no_longer_available",
+	ErrCodeResumeTokenInvalid:      "resume_token_invalid",
+	ErrCodeResumeTokenExpired:      "resume_token_expired",
+	ErrCodeResumeTokenReplayed:     "resume_token_replayed",
+
+	ErrCodeChatEmpty:       "chat_empty",
+	ErrCodeChatTooLong:     "chat_too_long",
+	ErrCodeChatRateLimited: "chat_rate_limited",
+	ErrCodeEmoteUnknown:    "emote_unknown",
+	ErrCodeNoOpponent:      "no_opponent",
+
+	ErrCodeTournamentNotExists: "tournament_not_exists",
+	ErrCodeInvalidTournament:   "invalid_tournament",
+	ErrCodeSeatTokenInvalid:    "seat_token_invalid",
+	ErrCodeNoTournamentMatch:   "no_tournament_match",
+	ErrCodeAlreadyInGame:       "already_in_game",
+	ErrCodeTournamentGame:      "tournament_game",
+}
+
+// Stable snake_case name of the code, e.g. for metric labels
+func (c ErrCode) String() string {
+	if name, prs := errCodeNames[c]; prs {
+		return name
+	}
+	return fmt.Sprintf("unknown_%d", uint16(c))
+}
+
+// Optional structured details of an error so that
+// clients don't have to parse them out of the text
+type Fields struct {
+	X                *uint8  `json:"x,omitempty"`
+	Y                *uint8  `json:"y,omitempty"`
+	ExpectedGridSize *uint8  `json:"expected_grid_size,omitempty"`
+	GotGridSize      *uint8  `json:"got_grid_size,omitempty"`
+	GameUuid         string  `json:"game_uuid,omitempty"`
+	PlayerUuid       string  `json:"player_uuid,omitempty"`
+	Seq              *uint64 `json:"seq,omitempty"`
+}
+
+type Error struct {
+	code    ErrCode
+	fields  *Fields
+	message string
+}
+
+func newError(code ErrCode, format string, args ...interface{}) *Error {
+	return &Error{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) withFields(fields Fields) *Error {
+	e.fields = &fields
+	return e
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+func (e *Error) Code() ErrCode {
+	return e.code
+}
+
+func (e *Error) Fields() *Fields {
+	return e.fields
+}
+
+// Code of the first *Error in the chain of err. Errors that
+// do not come from this package are internal ones.
+func CodeOf(err error) ErrCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return ErrCodeInternal
+}
+
+func FieldsOf(err error) *Fields {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.fields
+	}
+	return nil
+}
+
+func ErrInternal(err error) error {
+	return newError(ErrCodeInternal, "%s", err)
+}
+
+// Wraps a decoding error of the incoming payload
+func ErrInvalidPayload(err error) error {
+	return newError(ErrCodeInvalidPayload, "%s", err)
+}
+
+func ErrSignalAbsent() error {
+	return newError(ErrCodeSignalAbsent, "incoming req payload must contain 'code' field")
+}
+
+func ErrInvalidSignal(code uint8) error {
+	return newError(ErrCodeInvalidSignal, "no signal with this code\tcode: %d", code)
+}
+
 func ErrGameNotExists(gameUuid string) error {
-	return fmt.Errorf("game with this uuid does not exist, uuid: %s", gameUuid)
+	return newError(ErrCodeGameNotExists, "game with this uuid does not exist, uuid: %s", gameUuid).
+		withFields(Fields{GameUuid: gameUuid})
 }
 
 func ErrGameIsNil(gameUuid string) error {
-	return fmt.Errorf("game with this uuid is nil\t uuid: %s", gameUuid)
+	return newError(ErrCodeGameIsNil, "game with this uuid is nil\t uuid: %s", gameUuid).
+		withFields(Fields{GameUuid: gameUuid})
 }
 
 func ErrPlayerNotExist(playerUuid string) error {
-	return fmt.Errorf("player with this uuid does not exist, uuid: %s", playerUuid)
+	return newError(ErrCodePlayerNotExist, "player with this uuid does not exist, uuid: %s", playerUuid).
+		withFields(Fields{PlayerUuid: playerUuid})
 }
 
 func ErrPlayerNotExistForRematch() error {
-	return fmt.Errorf("one of the players in nil. rematch cannot happen")
+	return newError(ErrCodePlayerNotExistForRematch, "one of the players in nil. rematch cannot happen")
 }
 
 func ErrNilPayload() error {
-	return fmt.Errorf("the payload is nil and is not of type map")
+	return newError(ErrCodeNilPayload, "the payload is nil and is not of type map")
 }
 
 func ErrKeyNotExists(key string) error {
-	return fmt.Errorf("the key does not exist:\t%s", key)
+	return newError(ErrCodeKeyNotExists, "the key does not exist:\t%s", key)
 }
 
 func ErrValueNotString(value interface{}) error {
-	return fmt.Errorf("the value is not of type string:\t%t", value)
+	return newError(ErrCodeInvalidValueType, "the value is not of type string:\t%t", value)
 }
 
 func ErrValueNotInt(value interface{}) error {
-	return fmt.Errorf("the value is not of type int:\t%t", value)
+	return newError(ErrCodeInvalidValueType, "the value is not of type int:\t%t", value)
 }
 
 func ErrValueNotGridInt() error {
-	return fmt.Errorf("the value is not of type GridInt")
+	return newError(ErrCodeInvalidValueType, "the value is not of type GridInt")
+}
+
+func ErrRateLimited(limit string) error {
+	return newError(ErrCodeRateLimited, "too many requests, the connection is closed\tlimit: %s", limit)
 }
 
 // Game Errors
 
 func ErrInvalidGameDifficulty() error {
-	return fmt.Errorf("invalid difficulty")
+	return newError(ErrCodeInvalidGameDifficulty, "invalid difficulty")
 }
 
 func ErrGameAleardyRecalled() error {
-	return fmt.Errorf("")
+	return newError(ErrCodeRematchAlreadyCalled, "rematch has already been called for this game")
 }
 
+// Wraps a decoding error of a game, player or ship snapshot
+func ErrInvalidSnapshot(err error) error {
+	return newError(ErrCodeInvalidSnapshot, "invalid snapshot: %s", err)
+}
 
+// Written by a newer server than this one
+func ErrSnapshotVersionUnsupported(version, latest uint16) error {
+	return newError(ErrCodeSnapshotVersionUnsupported, "snapshot version %d is newer than the latest known version %d", version, latest)
+}
+
+func ErrInvalidSeriesLength(bestOf uint8) error {
+	return newError(ErrCodeInvalidSeriesLength, "a series is best of 1, 3, 5 or 7 games, got: %d", bestOf)
+}
+
+// Someone clinched the series, so there is no rematch
+func ErrSeriesOver(gameUuid string) error {
+	return newError(ErrCodeSeriesOver, "the series is over, uuid: %s", gameUuid).
+		withFields(Fields{GameUuid: gameUuid})
+}
+
+func ErrInvalidFirstTurnPolicy(policy string) error {
+	return newError(ErrCodeInvalidFirstTurnPolicy, "the first turn goes to the host, is random, alternates or goes to the loser, got: %q", policy)
+}
+
+func ErrInvalidDisclosure(disclosure string) error {
+	return newError(ErrCodeInvalidDisclosure, "an attack discloses hide_sinking, hit or call_out, got: %q", disclosure)
+}
+
+func ErrRematchNotCalled(gameUuid string) error {
+	return newError(ErrCodeRematchNotCalled, "no rematch has been called for this game\tgame uuid: %s", gameUuid).
+		withFields(Fields{GameUuid: gameUuid})
+}
+
+// A rematch only follows a game somebody has won
+func ErrGameNotFinished(gameUuid string) error {
+	return newError(ErrCodeGameNotFinished, "the game has no winner yet\tgame uuid: %s", gameUuid).
+		withFields(Fields{GameUuid: gameUuid})
+}
 
 // Attack Errors
 
 func ErrXorYOutOfGridBound(x, y uint8) error {
-	return fmt.Errorf("incoming x or y is out of game grid bound\tx: %d\ty: %d", x, y)
+	return newError(ErrCodeXorYOutOfGridBound, "incoming x or y is out of game grid bound\tx: %d\ty: %d", x, y).
+		withFields(Fields{X: &x, Y: &y})
 }
 
 func ErrAttackPositionAlreadyFilled(x, y uint8) error {
-	return fmt.Errorf("current position in grid already taken\tx: %d\ty: %d", x, y)
+	return newError(ErrCodeAttackPositionAlreadyFilled, "current position in grid already taken\tx: %d\ty: %d", x, y).
+		withFields(Fields{X: &x, Y: &y})
 }
 
 func ErrNotTurnForAttacker(attackerId string) error {
-	return fmt.Errorf("this is not the turn to attack for player %s", attackerId)
+	return newError(ErrCodeNotTurnForAttacker, "this is not the turn to attack for player %s", attackerId).
+		withFields(Fields{PlayerUuid: attackerId})
+}
+
+func ErrSpecialWeaponsDisabled(gameUuid string) error {
+	return newError(ErrCodeSpecialWeaponsDisabled, "special weapons are not part of this game's rules, uuid: %s", gameUuid).
+		withFields(Fields{GameUuid: gameUuid})
+}
+
+func ErrWeaponUsedUp(weapon string) error {
+	return newError(ErrCodeWeaponUsedUp, "there is no %s left for this match", weapon)
+}
+
+func ErrInvalidTorpedoOrientation(orientation string) error {
+	return newError(ErrCodeInvalidTorpedoOrientation, "a torpedo goes along a row or a column, got: %q", orientation)
+}
+
+// Every cell the weapon covers was attacked before
+func ErrNothingToAttack() error {
+	return newError(ErrCodeNothingToAttack, "every cell in the area has already been attacked")
 }
 
 // DefenceGrid
 
 func ErrDefenceGridPositionAlreadyHit(x, y uint8) error {
-	return fmt.Errorf("this position is already hit by the attacker in previous rounds\tx: %d\ty: %d", x, y)
+	return newError(ErrCodeDefenceGridPositionAlreadyHit, "this position is already hit by the attacker in previous rounds\tx: %d\ty: %d", x, y).
+		withFields(Fields{X: &x, Y: &y})
 }
 
 func ErrDefenceGridPositionEmpty(x, y uint8) error {
-	return fmt.Errorf("this position in defence grid is empty\tx: %d\ty: %d", x, y)
+	return newError(ErrCodeDefenceGridPositionEmpty, "this position in defence grid is empty\tx: %d\ty: %d", x, y).
+		withFields(Fields{X: &x, Y: &y})
 }
 
 func ErrDefenceGridRowsOutOfBounds(rows, gameGridSize uint8) error {
-	return fmt.Errorf("rows of defence grid must be %d \trows: %d", gameGridSize, rows)
+	return newError(ErrCodeDefenceGridRowsOutOfBounds, "rows of defence grid must be %d \trows: %d", gameGridSize, rows).
+		withFields(Fields{ExpectedGridSize: &gameGridSize, GotGridSize: &rows})
 }
 
 func ErrDefenceGridColsOutOfBounds(cols, gameGridSize uint8) error {
-	return fmt.Errorf("cols of defence grid must be %d \tcols: %d", gameGridSize, cols)
+	return newError(ErrCodeDefenceGridColsOutOfBounds, "cols of defence grid must be %d \tcols: %d", gameGridSize, cols).
+		withFields(Fields{ExpectedGridSize: &gameGridSize, GotGridSize: &cols})
+}
+
+// Only empty cells and ships can be placed; hits come later
+func ErrDefenceGridInvalidPositionState(x, y, state uint8) error {
+	return newError(ErrCodeDefenceGridInvalidPositionState, "position state %d cannot be placed on the defence grid\tx: %d\ty: %d", state, x, y).
+		withFields(Fields{X: &x, Y: &y})
+}
+
+func ErrInvalidShipCode(shipCode uint8) error {
+	return newError(ErrCodeInvalidShipCode, "there is no ship with this code\tcode: %d", shipCode)
+}
+
+func ErrInvalidShipOrientation(orientation string) error {
+	return newError(ErrCodeInvalidShipOrientation, "a ship lies horizontal or vertical, got: %q", orientation)
+}
+
+func ErrShipOutOfGridBound(shipCode, x, y uint8) error {
+	return newError(ErrCodeShipOutOfGridBound, "ship does not fit on the grid\tcode: %d\tx: %d\ty: %d", shipCode, x, y).
+		withFields(Fields{X: &x, Y: &y})
+}
+
+func ErrShipsOverlap(x, y uint8) error {
+	return newError(ErrCodeShipsOverlap, "two ships are placed on the same cell\tx: %d\ty: %d", x, y).
+		withFields(Fields{X: &x, Y: &y})
+}
+
+// Missing, placed twice or not in a straight line
+func ErrShipMisplaced(shipCode, length uint8) error {
+	return newError(ErrCodeShipMisplaced, "ship must be placed once over %d cells in a straight line\tcode: %d", length, shipCode)
 }
 
 /*
 Session Errors
 */
 func ErrSessionNotFound(sessionId string) error {
-	return fmt.Errorf("session not found\tID: %s", sessionId)
+	return newError(ErrCodeSessionNotFound, "session not found\tID: %s", sessionId)
 }
 
 func ErrSessionIsNil(sessionId string) error {
-	return fmt.Errorf("session is nil\tID: %s", sessionId)
+	return newError(ErrCodeSessionIsNil, "session is nil\tID: %s", sessionId)
+}
+
+func ErrEventsNoLongerAvailable(lastSeq uint64) error {
+	return newError(ErrCodeEventsNoLongerAvailable, "events after this seq are no longer available\tseq: %d", lastSeq).
+		withFields(Fields{Seq: &lastSeq})
+}
+
+// Forged, malformed or bound to another player
+func ErrResumeTokenInvalid() error {
+	return newError(ErrCodeResumeTokenInvalid, "resume token is invalid")
+}
+
+func ErrResumeTokenExpired() error {
+	return newError(ErrCodeResumeTokenExpired, "resume token has expired")
+}
+
+// The token was already used to reconnect once
+func ErrResumeTokenReplayed() error {
+	return newError(ErrCodeResumeTokenReplayed, "resume token has already been used")
+}
+
+// Chat Errors
+
+func ErrChatEmpty() error {
+	return newError(ErrCodeChatEmpty, "chat message is empty")
+}
+
+func ErrChatTooLong(length, maxLength int) error {
+	return newError(ErrCodeChatTooLong, "chat message is too long\tlength: %d\tmax: %d", length, maxLength)
+}
+
+// Unlike the other rate limits this one keeps the conn open
+func ErrChatRateLimited() error {
+	return newError(ErrCodeChatRateLimited, "too many chat messages, try again later")
+}
+
+func ErrEmoteUnknown(emoteId uint8) error {
+	return newError(ErrCodeEmoteUnknown, "no emote with this id\tid: %d", emoteId)
+}
+
+// The session has no game or nobody joined it yet
+func ErrNoOpponent() error {
+	return newError(ErrCodeNoOpponent, "there is no opponent to send this to")
+}
+
+// Tournament Errors
+
+func ErrTournamentNotExists(tournamentUuid string) error {
+	return newError(ErrCodeTournamentNotExists, "tournament with this uuid does not exist, uuid: %s", tournamentUuid)
+}
+
+func ErrInvalidTournament(reason string) error {
+	return newError(ErrCodeInvalidTournament, "invalid tournament: %s", reason)
+}
+
+func ErrSeatTokenInvalid() error {
+	return newError(ErrCodeSeatTokenInvalid, "seat token is invalid")
+}
+
+// The entrant is out, done, or waits for other matches
+func ErrNoTournamentMatch() error {
+	return newError(ErrCodeNoTournamentMatch, "there is no match to play right now")
+}
+
+func ErrAlreadyInGame(gameUuid string) error {
+	return newError(ErrCodeAlreadyInGame, "the session is already in an unfinished game, uuid: %s", gameUuid).
+		withFields(Fields{GameUuid: gameUuid})
+}
+
+// Tournament games are joined with a seat token and played once
+func ErrTournamentGame(gameUuid string) error {
+	return newError(ErrCodeTournamentGame, "this game belongs to a tournament, uuid: %s", gameUuid).
+		withFields(Fields{GameUuid: gameUuid})
 }
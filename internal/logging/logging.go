@@ -0,0 +1,82 @@
+/*
+Package logging sets up log/slog for the server. Session IDs
+are never logged as they are (they identify a live session),
+and attributes that look like credentials are redacted.
+*/
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Attribute keys shared by the session and game loggers
+const (
+	KeySession    = "session"
+	KeyGame       = "game_uuid"
+	KeyPlayer     = "player_uuid"
+	KeyRemoteAddr = "remote_addr"
+	KeySignal     = "signal"
+	KeyError      = "err"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+const redacted = "[REDACTED]"
+
+// Any attribute whose key contains one of these is redacted
+var sensitiveKeys = []string{"token", "secret", "password", "authorization"}
+
+type Config struct {
+	// FormatText or FormatJSON
+	Format string
+	Level  slog.Level
+}
+
+func DefaultConfig() Config {
+	return Config{Format: FormatText, Level: slog.LevelInfo}
+}
+
+func New(w io.Writer, cfg Config) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: cfg.Level, ReplaceAttr: redact}
+
+	switch cfg.Format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %q", cfg.Format)
+	}
+}
+
+// Accepts debug, info, warn and error
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(level))
+	return l, err
+}
+
+// Short, stable stand-in for a session ID so that the log
+// lines of a session can be correlated without leaking it
+func HashId(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:6])
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	return a
+}
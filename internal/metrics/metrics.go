@@ -0,0 +1,326 @@
+// Package metrics is a small, dependency free subset of the
+// Prometheus client: metrics register themselves on creation
+// and are rendered in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type collector interface {
+	name() string
+	writeTo(w io.Writer)
+}
+
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]collector
+}
+
+var defaultRegistry = &Registry{collectors: make(map[string]collector)}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, prs := r.collectors[c.name()]; prs {
+		panic("metric registered twice: " + c.name())
+	}
+	r.collectors[c.name()] = c
+}
+
+// Writes every registered metric, sorted by name
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		r.mu.RLock()
+		c := r.collectors[name]
+		r.mu.RUnlock()
+		c.writeTo(w)
+	}
+}
+
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Serves the default registry to the Prometheus scraper
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		defaultRegistry.WriteText(w)
+	})
+}
+
+type Counter struct {
+	v atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+type Gauge struct {
+	v atomic.Int64
+}
+
+func (g *Gauge) Inc() {
+	g.v.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.v.Add(-1)
+}
+
+func (g *Gauge) Set(v int64) {
+	g.v.Store(v)
+}
+
+func (g *Gauge) Value() int64 {
+	return g.v.Load()
+}
+
+type Histogram struct {
+	// Upper bounds, sorted; +Inf is implicit
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upperBound := range h.buckets {
+		if v <= upperBound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Bucket bounds for durations in seconds
+var (
+	LatencyBuckets  = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+	DurationBuckets = []float64{30, 60, 120, 180, 300, 450, 600, 900, 1200, 1800}
+)
+
+// A family of metrics partitioned by label values
+type vec[M any] struct {
+	metricName string
+	help       string
+	metricType string
+	labelNames []string
+	newMetric  func() M
+	write      func(w io.Writer, name, labels string, labelValues []string, m M)
+
+	mu      sync.RWMutex
+	metrics map[string]*labeled[M]
+}
+
+type labeled[M any] struct {
+	labelValues []string
+	metric      M
+}
+
+func newVec[M any](name, help, metricType string, labelNames []string, newMetric func() M, write func(w io.Writer, name, labels string, labelValues []string, m M)) *vec[M] {
+	v := &vec[M]{
+		metricName: name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		newMetric:  newMetric,
+		write:      write,
+		metrics:    make(map[string]*labeled[M]),
+	}
+	defaultRegistry.register(v)
+	return v
+}
+
+func (v *vec[M]) withLabelValues(labelValues ...string) M {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.metricName, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.RLock()
+	l, prs := v.metrics[key]
+	v.mu.RUnlock()
+	if prs {
+		return l.metric
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if l, prs := v.metrics[key]; prs {
+		return l.metric
+	}
+	l = &labeled[M]{labelValues: labelValues, metric: v.newMetric()}
+	v.metrics[key] = l
+	return l.metric
+}
+
+func (v *vec[M]) name() string {
+	return v.metricName
+}
+
+func (v *vec[M]) writeTo(w io.Writer) {
+	writeHeader(w, v.metricName, v.help, v.metricType)
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	keys := make([]string, 0, len(v.metrics))
+	for key := range v.metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		l := v.metrics[key]
+		v.write(w, v.metricName, formatLabels(v.labelNames, l.labelValues), l.labelValues, l.metric)
+	}
+}
+
+type CounterVec struct {
+	*vec[*Counter]
+}
+
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", labelNames, func() *Counter { return &Counter{} },
+		func(w io.Writer, name, labels string, _ []string, c *Counter) {
+			fmt.Fprintf(w, "%s%s %d\n", name, labels, c.Value())
+		})}
+}
+
+func (cv *CounterVec) WithLabelValues(labelValues ...string) *Counter {
+	return cv.withLabelValues(labelValues...)
+}
+
+func NewCounter(name, help string) *Counter {
+	return NewCounterVec(name, help).WithLabelValues()
+}
+
+type GaugeVec struct {
+	*vec[*Gauge]
+}
+
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, "gauge", labelNames, func() *Gauge { return &Gauge{} },
+		func(w io.Writer, name, labels string, _ []string, g *Gauge) {
+			fmt.Fprintf(w, "%s%s %d\n", name, labels, g.Value())
+		})}
+}
+
+func (gv *GaugeVec) WithLabelValues(labelValues ...string) *Gauge {
+	return gv.withLabelValues(labelValues...)
+}
+
+func NewGauge(name, help string) *Gauge {
+	return NewGaugeVec(name, help).WithLabelValues()
+}
+
+type HistogramVec struct {
+	*vec[*Histogram]
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	bucketLabelNames := append(append([]string{}, labelNames...), "le")
+
+	return &HistogramVec{newVec(name, help, "histogram", labelNames, func() *Histogram { return newHistogram(buckets) },
+		func(w io.Writer, name, labels string, labelValues []string, h *Histogram) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			bucketLabelValues := append(append([]string{}, labelValues...), "")
+			for i, upperBound := range h.buckets {
+				bucketLabelValues[len(labelValues)] = formatFloat(upperBound)
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketLabelNames, bucketLabelValues), h.counts[i])
+			}
+			bucketLabelValues[len(labelValues)] = "+Inf"
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketLabelNames, bucketLabelValues), h.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+		})}
+}
+
+func (hv *HistogramVec) WithLabelValues(labelValues ...string) *Histogram {
+	return hv.withLabelValues(labelValues...)
+}
+
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return NewHistogramVec(name, help, buckets).WithLabelValues()
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, "%s=\"%s\"", name, escapeLabelValue(values[i]))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/saeidalz13/battleship-backend/internal/clock"
+)
+
+// Classic token bucket: starts full with `burst` tokens and
+// refills `rate` tokens per second. Each allowed event takes one.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	clock  clock.Clock
+}
+
+func NewTokenBucket(rate float64, burst int, clk clock.Clock) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clk.Now(),
+		clock:  clk,
+	}
+}
+
+func (tb *TokenBucket) Allow() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill()
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// A full bucket behaves exactly like a new one
+func (tb *TokenBucket) isFull() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill()
+	return tb.tokens >= tb.burst
+}
+
+func (tb *TokenBucket) refill() {
+	now := tb.clock.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+}
+
+// Buckets of IPs that have not been seen for a while are
+// dropped once the map grows beyond this
+const ipLimiterPruneThreshold int = 1024
+
+// Limits per remote IP the number of open connections and
+// how fast new sessions can be created. A zero limit is
+// treated as no limit.
+type IPLimiter struct {
+	mu                sync.Mutex
+	maxConns          int
+	sessionsPerMinute int
+	conns             map[string]int
+	sessionBuckets    map[string]*TokenBucket
+	clock             clock.Clock
+}
+
+func NewIPLimiter(maxConns, sessionsPerMinute int, clk clock.Clock) *IPLimiter {
+	return &IPLimiter{
+		maxConns:          maxConns,
+		sessionsPerMinute: sessionsPerMinute,
+		conns:             make(map[string]int),
+		sessionBuckets:    make(map[string]*TokenBucket),
+		clock:             clk,
+	}
+}
+
+// Takes a connection slot for the ip. `release` must be
+// called once the connection is closed.
+func (l *IPLimiter) Acquire(ip string) (release func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxConns > 0 && l.conns[ip] >= l.maxConns {
+		return func() {}, false
+	}
+	l.conns[ip]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.conns[ip]--
+			if l.conns[ip] <= 0 {
+				delete(l.conns, ip)
+			}
+		})
+	}, true
+}
+
+func (l *IPLimiter) AllowNewSession(ip string) bool {
+	if l.sessionsPerMinute <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	bucket, prs := l.sessionBuckets[ip]
+	if !prs {
+		if len(l.sessionBuckets) >= ipLimiterPruneThreshold {
+			l.pruneLocked()
+		}
+		bucket = NewTokenBucket(float64(l.sessionsPerMinute)/60, l.sessionsPerMinute, l.clock)
+		l.sessionBuckets[ip] = bucket
+	}
+	l.mu.Unlock()
+
+	return bucket.Allow()
+}
+
+func (l *IPLimiter) pruneLocked() {
+	for ip, bucket := range l.sessionBuckets {
+		if bucket.isFull() {
+			delete(l.sessionBuckets, ip)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Package token issues and verifies the resume tokens clients
+use to take their session back after an abnormal closure.
+
+A token is `base64url(claims JSON).base64url(HMAC-SHA256)`.
+The signature only proves the server issued it; whether it
+was already used is up to the caller, by comparing the nonce.
+*/
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/saeidalz13/battleship-backend/internal/clock"
+)
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrSignature = errors.New("invalid token signature")
+	ErrExpired   = errors.New("token expired")
+)
+
+type Claims struct {
+	SessionId  string `json:"sid"`
+	PlayerUuid string `json:"pid"`
+
+	// Changes every time a token is issued for the session
+	Nonce     string `json:"nonce"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+	clock  clock.Clock
+}
+
+func NewSigner(secret []byte, ttl time.Duration) *Signer {
+	return &Signer{secret: secret, ttl: ttl, clock: clock.Real()}
+}
+
+// Must be set before any token is issued
+func (s *Signer) WithClock(clk clock.Clock) *Signer {
+	s.clock = clk
+	return s
+}
+
+// Tokens signed with a random secret are only valid
+// until the process restarts, same as the sessions
+func NewRandomSigner(ttl time.Duration) *Signer {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return NewSigner(secret, ttl)
+}
+
+func (s *Signer) Issue(sessionId, playerUuid string) (string, Claims) {
+	claims := Claims{
+		SessionId:  sessionId,
+		PlayerUuid: playerUuid,
+		Nonce:      newNonce(),
+		ExpiresAt:  s.clock.Now().Add(s.ttl).Unix(),
+	}
+
+	// Marshalling a struct of strings and ints cannot fail
+	payload, _ := json.Marshal(claims)
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(s.sign(encodedPayload)), claims
+}
+
+func (s *Signer) Verify(token string) (Claims, error) {
+	var claims Claims
+
+	encodedPayload, encodedSig, found := strings.Cut(token, ".")
+	if !found {
+		return claims, ErrMalformed
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return claims, ErrMalformed
+	}
+	if !hmac.Equal(sig, s.sign(encodedPayload)) {
+		return claims, ErrSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return claims, ErrMalformed
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrMalformed
+	}
+
+	if s.clock.Now().Unix() >= claims.ExpiresAt {
+		return claims, ErrExpired
+	}
+	return claims, nil
+}
+
+func (s *Signer) sign(encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
+
+func newNonce() string {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(nonce)
+}
@@ -0,0 +1,56 @@
+package battleship
+
+import "math/rand/v2"
+
+// Who attacks first in each game, rematches included.
+// A single game defaults to FirstTurnHost and a series to
+// FirstTurnAlternate.
+const (
+	FirstTurnHost      = "host"
+	FirstTurnRandom    = "random"
+	FirstTurnAlternate = "alternate"
+	FirstTurnLoser     = "loser"
+)
+
+func DefaultFirstTurnPolicy(bestOf uint8) string {
+	if bestOf > SeriesLengthSingle {
+		return FirstTurnAlternate
+	}
+	return FirstTurnHost
+}
+
+func IsFirstTurnPolicyValid(policy string) bool {
+	switch policy {
+	case FirstTurnHost, FirstTurnRandom, FirstTurnAlternate, FirstTurnLoser:
+		return true
+	default:
+		return false
+	}
+}
+
+// The first game has no loser, so the host starts it
+func (g *Game) nextHostStarts(isFirstGame bool) bool {
+	switch g.firstTurnPolicy {
+	case FirstTurnRandom:
+		return g.coinFlip()
+	case FirstTurnAlternate:
+		return isFirstGame || !g.hostStarts
+	case FirstTurnLoser:
+		return isFirstGame || g.hostPlayer.MatchStatus() == PlayerMatchStatusLost
+	default:
+		return true
+	}
+}
+
+func defaultCoinFlip() bool {
+	return rand.IntN(2) == 0
+}
+
+func (g *Game) applyFirstTurn() {
+	if g.hostPlayer != nil {
+		g.hostPlayer.isTurn = g.hostStarts
+	}
+	if g.joinPlayer != nil {
+		g.joinPlayer.isTurn = !g.hostStarts
+	}
+}
@@ -1,9 +1,12 @@
 package battleship
 
 import (
+	"log/slog"
 	"sync"
+	"time"
 
 	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
 )
 
 const (
@@ -12,6 +15,14 @@ const (
 	GameDifficultyHard
 )
 
+const (
+	GamePhaseWaitingForOpponent = "waiting_for_opponent"
+	GamePhasePlacingShips       = "placing_ships"
+	GamePhaseInProgress         = "in_progress"
+	GamePhaseFinished           = "finished"
+)
+
+// Default grid sizes, see GameConfig
 const (
 	GridSizeEasy   uint8 = 6
 	GridSizeNormal uint8 = 7
@@ -20,6 +31,47 @@ const (
 	ValidLowerBound uint8 = 0
 )
 
+// The longest ship has to fit and coordinates stay small
+const (
+	MinGridSize uint8 = 4
+	MaxGridSize uint8 = 16
+)
+
+type GameConfig struct {
+	GridSizeEasy   uint8
+	GridSizeNormal uint8
+	GridSizeHard   uint8
+
+	// Older snapshots are not restored on startup; 0 disables
+	RestoreMaxAge time.Duration
+
+	// How long the players of a restored game have to resume
+	// their sessions before the game is ended
+	RestoreClaimWindow time.Duration
+}
+
+func DefaultGameConfig() GameConfig {
+	return GameConfig{
+		GridSizeEasy:   GridSizeEasy,
+		GridSizeNormal: GridSizeNormal,
+		GridSizeHard:   GridSizeHard,
+		RestoreMaxAge:  time.Minute * 10,
+
+		RestoreClaimWindow: time.Minute * 2,
+	}
+}
+
+func (cfg GameConfig) GridSize(difficulty uint8) uint8 {
+	switch difficulty {
+	case GameDifficultyEasy:
+		return cfg.GridSizeEasy
+	case GameDifficultyNormal:
+		return cfg.GridSizeNormal
+	default:
+		return cfg.GridSizeHard
+	}
+}
+
 type Game struct {
 	uuid                    string
 	hostPlayer              *BattleshipPlayer
@@ -29,25 +81,41 @@ type Game struct {
 	validUpperBound         uint8
 	rematchAlreadyRequested bool
 	mu                      sync.Mutex
+
+	// Set when an operator ends the game or kicks one of its
+	// players; nobody forfeits such a game
+	endedByOperator bool
+
+	// When the current match (or rematch) started; started
+	// is set once by TryStart and reset by a rematch
+	startedAt time.Time
+	started   bool
+
+	series Series
+
+	firstTurnPolicy string
+	// Whether the host has the first turn of the current game
+	hostStarts bool
+	coinFlip   func() bool
+
+	ruleset Ruleset
+
+	logger *slog.Logger
 }
 
-func newGame(difficulty uint8, uuid string) *Game {
+func newGame(difficulty uint8, uuid string, gridSize uint8) *Game {
 	game := &Game{
-		uuid:       uuid,
-		difficulty: difficulty,
+		uuid:            uuid,
+		difficulty:      difficulty,
+		gridSize:        gridSize,
+		validUpperBound: gridSize - 1,
+		series:          newSeries(SeriesLengthSingle),
+		firstTurnPolicy: FirstTurnHost,
+		hostStarts:      true,
+		coinFlip:        defaultCoinFlip,
+		ruleset:         DefaultRuleset(),
 	}
-
-	var newGridSize uint8
-	if difficulty == GameDifficultyEasy {
-		newGridSize = GridSizeEasy
-	} else if difficulty == GameDifficultyNormal {
-		newGridSize = GridSizeNormal
-	} else {
-		newGridSize = GridSizeHard
-	}
-
-	game.gridSize = newGridSize
-	game.validUpperBound = newGridSize - 1
+	game.logger = slog.Default().With(logging.KeyGame, uuid, "difficulty", DifficultyName(difficulty))
 
 	return game
 }
@@ -56,13 +124,27 @@ func (g *Game) Uuid() string {
 	return g.uuid
 }
 
+// Carries the uuid and the difficulty of the game
+func (g *Game) Logger() *slog.Logger {
+	return g.logger
+}
+
 func (g *Game) CreateHostPlayer(sessionId string) *BattleshipPlayer {
-	g.hostPlayer = newPlayer(true, true, sessionId, g.gridSize)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.hostPlayer = newPlayer(&g.mu, true, g.hostStarts, sessionId, g.gridSize)
 	return g.hostPlayer
 }
 
 func (g *Game) CreateJoinPlayer(sessionId string) *BattleshipPlayer {
-	g.joinPlayer = newPlayer(false, false, sessionId, g.gridSize)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.joinPlayer == nil {
+		gamesWaitingForOpponent.Dec()
+	}
+	g.joinPlayer = newPlayer(&g.mu, false, !g.hostStarts, sessionId, g.gridSize)
 	return g.joinPlayer
 }
 
@@ -70,42 +152,211 @@ func (g *Game) Difficulty() uint8 {
 	return g.difficulty
 }
 
+func (g *Game) GridSize() uint8 {
+	return g.gridSize
+}
+
+// One of the GamePhase constants. A finished game goes back
+// to placing ships on a rematch.
+func (g *Game) Phase() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.phase()
+}
+
+// The caller holds g.mu
+func (g *Game) phase() string {
+	switch {
+	case g.hostPlayer == nil || g.joinPlayer == nil:
+		return GamePhaseWaitingForOpponent
+	case !g.isReadyToStart():
+		return GamePhasePlacingShips
+	case g.isInProgress():
+		return GamePhaseInProgress
+	default:
+		return GamePhaseFinished
+	}
+}
+
 func (g *Game) HostPlayer() *BattleshipPlayer {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	return g.hostPlayer
 }
 
 func (g *Game) JoinPlayer() *BattleshipPlayer {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	return g.joinPlayer
 }
 
 func (g *Game) FetchPlayer(isHost bool) *BattleshipPlayer {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	if isHost {
 		return g.hostPlayer
 	}
-
 	return g.joinPlayer
 }
 
 func (g *Game) IsReadyToStart() bool {
-	return g.joinPlayer.IsReady() && g.hostPlayer.IsReady()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.isReadyToStart()
+}
+
+// The caller holds g.mu
+func (g *Game) isReadyToStart() bool {
+	return g.hostPlayer != nil && g.joinPlayer != nil && g.hostPlayer.isReady && g.joinPlayer.isReady
+}
+
+// Read by the status endpoint and the shutdown drain, so it
+// is safe to call from outside the loops of the game
+func (g *Game) IsInProgress() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.isInProgress()
+}
+
+// The caller holds g.mu
+func (g *Game) isInProgress() bool {
+	if !g.isReadyToStart() {
+		return false
+	}
+	return g.hostPlayer.MatchStatus() == PlayerMatchStatusUndefined && g.joinPlayer.MatchStatus() == PlayerMatchStatusUndefined
+}
+
+// Starts the match once both players are ready. Both loops
+// may call it; only one of them gets true and starts it.
+func (g *Game) TryStart(startedAt time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.started || !g.isReadyToStart() {
+		return false
+	}
+	g.started = true
+	g.startedAt = startedAt
+	return true
+}
+
+func (g *Game) StartedAt() time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.startedAt
+}
+
+// Chosen by the host when the game is created
+func (g *Game) SetSeriesLength(bestOf uint8) error {
+	if !IsSeriesLengthValid(bestOf) {
+		return cerr.ErrInvalidSeriesLength(bestOf)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.series = newSeries(bestOf)
+	return nil
+}
+
+// Chosen by the host when the game is created; decides the
+// first turn of the first game right away
+func (g *Game) SetFirstTurnPolicy(policy string) error {
+	if !IsFirstTurnPolicyValid(policy) {
+		return cerr.ErrInvalidFirstTurnPolicy(policy)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.firstTurnPolicy = policy
+	g.hostStarts = g.nextHostStarts(true)
+	g.applyFirstTurn()
+	return nil
+}
+
+func (g *Game) FirstTurnPolicy() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.firstTurnPolicy
+}
+
+func (g *Game) HostStarts() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.hostStarts
+}
+
+func (g *Game) Series() Series {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.series
+}
+
+// Counts the finished game towards the series
+func (g *Game) RecordWin(hostWon bool) Series {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if hostWon {
+		g.series.HostWins++
+	} else {
+		g.series.JoinWins++
+	}
+	return g.series
+}
+
+func (g *Game) EndByOperator() {
+	g.mu.Lock()
+	g.endedByOperator = true
+	g.mu.Unlock()
+}
+
+func (g *Game) IsEndedByOperator() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.endedByOperator
 }
 
 func (g *Game) IsRematchAlreadyCalled() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	return g.rematchAlreadyRequested
 }
 
+// The next game of the series; the first turn policy picks
+// who starts it
 func (g *Game) ResetRematchForGame() error {
 	g.mu.Lock()
-	g.rematchAlreadyRequested = false
-	g.mu.Unlock()
+	defer g.mu.Unlock()
 
-	for _, player := range []*BattleshipPlayer{g.hostPlayer, g.joinPlayer} {
-		if player == nil {
-			return cerr.ErrPlayerNotExistForRematch()
-		}
-		player.PrepareForRematch(g.gridSize)
+	if g.hostPlayer == nil || g.joinPlayer == nil {
+		return cerr.ErrPlayerNotExistForRematch()
 	}
 
+	if g.series.IsOver() {
+		return cerr.ErrSeriesOver(g.uuid)
+	}
+	g.rematchAlreadyRequested = false
+	g.started = false
+	g.series.Game++
+	g.hostStarts = g.nextHostStarts(false)
+
+	g.hostPlayer.prepareForRematch(g.gridSize)
+	g.joinPlayer.prepareForRematch(g.gridSize)
+	g.applyFirstTurn()
 	return nil
 }
 
@@ -120,16 +371,12 @@ func (g *Game) AreAttackCoordinatesValid(coordinates Coordinates) bool {
 }
 
 func (g *Game) SetPlayerReadyForGame(player Player, selectedGrid Grid) error {
-	rows := uint8(len(selectedGrid))
-	if rows != g.gridSize {
-		return cerr.ErrDefenceGridRowsOutOfBounds(rows, g.gridSize)
-	}
-	cols := uint8(len(selectedGrid[0]))
-	if cols != g.gridSize {
-		return cerr.ErrDefenceGridColsOutOfBounds(cols, g.gridSize)
+	if err := g.ValidateDefenceGrid(selectedGrid); err != nil {
+		return err
 	}
 
-	player.SetReady(selectedGrid)
+	// The caller may still send the grid back to the client
+	player.SetReady(selectedGrid.clone())
 
 	return nil
 }
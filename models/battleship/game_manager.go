@@ -1,41 +1,164 @@
 package battleship
 
 import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/google/uuid"
+	"github.com/saeidalz13/battleship-backend/internal/clock"
 	cerr "github.com/saeidalz13/battleship-backend/internal/error"
-
-	"sync"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
 )
 
+// How long a single call to the game store or registry may take
+const gameStoreTimeout = time.Second * 5
+
 type GameManager interface {
 	CreateGame(difficulty uint8) (*Game, error)
 	FetchGame(gameUuid string) (*Game, error)
 	TerminateGame(gameUuid string)
+	GamesInProgress() int
+	GameCount() int
+	ListGames() []*Game
+
+	SaveGame(game *Game)
+	RestoreGames(ctx context.Context) (int, error)
+	PreserveSnapshots()
+	ClaimRestoredGame(playerUuid, sessionId string) (*Game, error)
+	ExpireUnclaimedGames(now time.Time) []string
+
+	NodeId() string
+	GameOwner(gameUuid string) (string, error)
 
 	isDifficultyValid(uint8) bool
 }
 
 type BattleshipGameManager struct {
+	cfg   GameConfig
+	clock clock.Clock
 	games map[string]*Game
 	mu    sync.RWMutex
+
+	store GameStore
+
+	registry GameRegistry
+	nodeId   string
+
+	// Set on shutdown so that terminating the games does
+	// not delete their snapshots
+	preserveSnapshots atomic.Bool
+
+	// Restored games some of whose players have not resumed
+	// their sessions yet. Guarded by mu.
+	unclaimed map[string]*unclaimedGame
+
+	// Decides the first turns of FirstTurnRandom games
+	rng   *rand.Rand
+	rngMu sync.Mutex
 }
 
 var _ GameManager = (*BattleshipGameManager)(nil)
 
 func NewBattleshipGameManager() *BattleshipGameManager {
 	return &BattleshipGameManager{
+		cfg:   DefaultGameConfig(),
+		clock: clock.Real(),
 		games: make(map[string]*Game, 10),
+		store: NewMemoryGameStore(),
+
+		unclaimed: make(map[string]*unclaimedGame),
+
+		registry: NewMemoryGameRegistry(),
+		nodeId:   LocalNodeId,
+
+		rng: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
 	}
 }
+
+// Makes the random first turns reproducible, e.g. in tests
+func (bgm *BattleshipGameManager) WithRandSeed(seed uint64) *BattleshipGameManager {
+	bgm.rng = rand.New(rand.NewPCG(seed, seed))
+	return bgm
+}
+
+func (bgm *BattleshipGameManager) coinFlip() bool {
+	bgm.rngMu.Lock()
+	defer bgm.rngMu.Unlock()
+
+	return bgm.rng.IntN(2) == 0
+}
+
+// Must be set before any game is saved or restored
+func (bgm *BattleshipGameManager) WithClock(clk clock.Clock) *BattleshipGameManager {
+	bgm.clock = clk
+	return bgm
+}
+
+// Must be set before any game is created
+func (bgm *BattleshipGameManager) WithGameStore(store GameStore) *BattleshipGameManager {
+	bgm.store = store
+	return bgm
+}
+
+// Must be set before any game is created. Nodes that share
+// a registry need distinct IDs.
+func (bgm *BattleshipGameManager) WithGameRegistry(registry GameRegistry, nodeId string) *BattleshipGameManager {
+	bgm.registry = registry
+	bgm.nodeId = nodeId
+	return bgm
+}
+
+// Applies to the games created afterwards
+func (bgm *BattleshipGameManager) WithGameConfig(cfg GameConfig) *BattleshipGameManager {
+	bgm.cfg = cfg
+	return bgm
+}
+
 func (bgm *BattleshipGameManager) CreateGame(difficulty uint8) (*Game, error) {
 	if !bgm.isDifficultyValid(difficulty) {
 		return nil, cerr.ErrInvalidGameDifficulty()
 	}
 
 	gameUuid := uuid.NewString()[:6]
-	bgm.games[gameUuid] = newGame(difficulty, gameUuid)
+	game := newGame(difficulty, gameUuid, bgm.cfg.GridSize(difficulty))
+	game.coinFlip = bgm.coinFlip
+
+	bgm.mu.Lock()
+	bgm.games[gameUuid] = game
+	bgm.mu.Unlock()
+
+	difficultyName := DifficultyName(difficulty)
+	gamesCreatedTotal.WithLabelValues(difficultyName).Inc()
+	gamesActive.WithLabelValues(difficultyName).Inc()
+	gamesWaitingForOpponent.Inc()
+
+	bgm.registerGame(game)
+	game.Logger().Info("game created")
+	return game, nil
+}
+
+// A failed registration is only logged; the game can still
+// be joined on this node
+func (bgm *BattleshipGameManager) registerGame(game *Game) {
+	ctx, cancel := context.WithTimeout(context.Background(), gameStoreTimeout)
+	defer cancel()
+	if err := bgm.registry.RegisterGame(ctx, game.uuid, bgm.nodeId); err != nil {
+		game.Logger().Warn("failed to register the game", logging.KeyError, err)
+	}
+}
+
+func (bgm *BattleshipGameManager) NodeId() string {
+	return bgm.nodeId
+}
 
-	return bgm.games[gameUuid], nil
+// ID of the node that owns the game, which may be this one
+func (bgm *BattleshipGameManager) GameOwner(gameUuid string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gameStoreTimeout)
+	defer cancel()
+	return bgm.registry.GameOwner(ctx, gameUuid)
 }
 
 func (bgm *BattleshipGameManager) FetchGame(gameUuid string) (*Game, error) {
@@ -50,10 +173,179 @@ func (bgm *BattleshipGameManager) FetchGame(gameUuid string) (*Game, error) {
 }
 
 func (bgm *BattleshipGameManager) TerminateGame(gameUuid string) {
+	bgm.mu.Lock()
+	game, prs := bgm.games[gameUuid]
+	if !prs {
+		bgm.mu.Unlock()
+		return
+	}
+	delete(bgm.games, gameUuid)
+	delete(bgm.unclaimed, gameUuid)
+	bgm.mu.Unlock()
+
+	gamesActive.WithLabelValues(DifficultyName(game.difficulty)).Dec()
+	if game.JoinPlayer() == nil {
+		gamesWaitingForOpponent.Dec()
+	}
+	game.Logger().Info("game terminated")
+
+	ctx, cancel := context.WithTimeout(context.Background(), gameStoreTimeout)
+	defer cancel()
+	if err := bgm.registry.UnregisterGame(ctx, gameUuid); err != nil {
+		game.Logger().Warn("failed to unregister the game", logging.KeyError, err)
+	}
+
+	if bgm.preserveSnapshots.Load() {
+		return
+	}
+	if err := bgm.store.DeleteGame(ctx, gameUuid); err != nil {
+		game.Logger().Warn("failed to delete the game snapshot", logging.KeyError, err)
+	}
+}
+
+// Writes a snapshot of the game to the store. A failed write
+// is only logged; the game goes on in memory.
+func (bgm *BattleshipGameManager) SaveGame(game *Game) {
+	snapshot := game.Snapshot()
+	snapshot.SavedAt = bgm.clock.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), gameStoreTimeout)
+	defer cancel()
+	if err := bgm.store.SaveGame(ctx, snapshot); err != nil {
+		game.Logger().Warn("failed to save the game snapshot", logging.KeyError, err)
+	}
+}
+
+// Brings back the unfinished games of the store. Snapshots
+// older than GameConfig.RestoreMaxAge are deleted instead
+// since their players are long gone. Returns the number of
+// restored games.
+func (bgm *BattleshipGameManager) RestoreGames(ctx context.Context) (int, error) {
+	snapshots, err := bgm.store.ListUnfinishedGames(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, snapshot := range snapshots {
+		if bgm.cfg.RestoreMaxAge > 0 && bgm.clock.Now().Sub(snapshot.SavedAt) > bgm.cfg.RestoreMaxAge {
+			if err := bgm.store.DeleteGame(ctx, snapshot.Uuid); err != nil {
+				return restored, err
+			}
+			continue
+		}
+
+		game := RestoreGame(snapshot)
+		game.coinFlip = bgm.coinFlip
+		bgm.mu.Lock()
+		bgm.games[game.uuid] = game
+		bgm.unclaimed[game.uuid] = newUnclaimedGame(game, bgm.clock.Now())
+		bgm.mu.Unlock()
+
+		gamesActive.WithLabelValues(DifficultyName(game.difficulty)).Inc()
+		if game.JoinPlayer() == nil {
+			gamesWaitingForOpponent.Inc()
+		}
+		bgm.registerGame(game)
+		game.Logger().Info("game restored", "phase", snapshot.Phase)
+		restored++
+	}
+	return restored, nil
+}
+
+// The sessions of a restored game are gone with the process
+// that saved it; its players still hold resume tokens of them
+type unclaimedGame struct {
+	restoredAt time.Time
+
+	// Session ID by player UUID, as in the snapshot
+	sessionIds map[string]string
+}
+
+func newUnclaimedGame(game *Game, restoredAt time.Time) *unclaimedGame {
+	ug := &unclaimedGame{restoredAt: restoredAt, sessionIds: make(map[string]string, 2)}
+	for _, player := range []*BattleshipPlayer{game.hostPlayer, game.joinPlayer} {
+		if player != nil {
+			ug.sessionIds[player.uuid] = player.sessionID
+		}
+	}
+	return ug
+}
+
+// Hands a restored game back to the player whose session
+// the snapshot names. Every player can claim it only once.
+func (bgm *BattleshipGameManager) ClaimRestoredGame(playerUuid, sessionId string) (*Game, error) {
 	bgm.mu.Lock()
 	defer bgm.mu.Unlock()
 
-	delete(bgm.games, gameUuid)
+	for gameUuid, ug := range bgm.unclaimed {
+		if ug.sessionIds[playerUuid] != sessionId {
+			continue
+		}
+
+		delete(ug.sessionIds, playerUuid)
+		if len(ug.sessionIds) == 0 {
+			delete(bgm.unclaimed, gameUuid)
+		}
+		return bgm.games[gameUuid], nil
+	}
+	return nil, cerr.ErrSessionNotFound(sessionId)
+}
+
+// Returns the restored games that some player has not
+// claimed within GameConfig.RestoreClaimWindow. They are
+// no longer claimable; ending them is up to the caller.
+func (bgm *BattleshipGameManager) ExpireUnclaimedGames(now time.Time) []string {
+	bgm.mu.Lock()
+	defer bgm.mu.Unlock()
+
+	var expired []string
+	for gameUuid, ug := range bgm.unclaimed {
+		if now.Sub(ug.restoredAt) > bgm.cfg.RestoreClaimWindow {
+			expired = append(expired, gameUuid)
+			delete(bgm.unclaimed, gameUuid)
+		}
+	}
+	return expired
+}
+
+// Called on shutdown; the games are still terminated but the
+// next process can restore them
+func (bgm *BattleshipGameManager) PreserveSnapshots() {
+	bgm.preserveSnapshots.Store(true)
+}
+
+// Every game, including the ones waiting for an opponent
+func (bgm *BattleshipGameManager) GameCount() int {
+	bgm.mu.RLock()
+	defer bgm.mu.RUnlock()
+
+	return len(bgm.games)
+}
+
+func (bgm *BattleshipGameManager) ListGames() []*Game {
+	bgm.mu.RLock()
+	defer bgm.mu.RUnlock()
+
+	games := make([]*Game, 0, len(bgm.games))
+	for _, game := range bgm.games {
+		games = append(games, game)
+	}
+	return games
+}
+
+// Number of games that have started and nobody has won yet
+func (bgm *BattleshipGameManager) GamesInProgress() int {
+	bgm.mu.RLock()
+	defer bgm.mu.RUnlock()
+
+	inProgress := 0
+	for _, game := range bgm.games {
+		if game.IsInProgress() {
+			inProgress++
+		}
+	}
+	return inProgress
 }
 
 func (bgm *BattleshipGameManager) isDifficultyValid(difficulty uint8) bool {
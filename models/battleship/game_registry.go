@@ -0,0 +1,61 @@
+package battleship
+
+import (
+	"context"
+	"sync"
+
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+)
+
+// Node ID of a game manager that runs on its own
+const LocalNodeId = "local"
+
+// Records which node owns each game, i.e. keeps it in memory
+// and runs the loops of its sessions. A node that is asked
+// for a game it does not own relays the client to the owner.
+type GameRegistry interface {
+	RegisterGame(ctx context.Context, gameUuid, nodeId string) error
+
+	// cerr.ErrGameNotExists if no node owns the game
+	GameOwner(ctx context.Context, gameUuid string) (string, error)
+	UnregisterGame(ctx context.Context, gameUuid string) error
+}
+
+// Shared by the nodes of one process, e.g. in tests
+type MemoryGameRegistry struct {
+	owners map[string]string
+	mu     sync.RWMutex
+}
+
+var _ GameRegistry = (*MemoryGameRegistry)(nil)
+
+func NewMemoryGameRegistry() *MemoryGameRegistry {
+	return &MemoryGameRegistry{owners: make(map[string]string, 10)}
+}
+
+func (mgr *MemoryGameRegistry) RegisterGame(ctx context.Context, gameUuid, nodeId string) error {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	mgr.owners[gameUuid] = nodeId
+	return nil
+}
+
+func (mgr *MemoryGameRegistry) GameOwner(ctx context.Context, gameUuid string) (string, error) {
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	nodeId, prs := mgr.owners[gameUuid]
+	if !prs {
+		return "", cerr.ErrGameNotExists(gameUuid)
+	}
+	return nodeId, nil
+}
+
+func (mgr *MemoryGameRegistry) UnregisterGame(ctx context.Context, gameUuid string) error {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	delete(mgr.owners, gameUuid)
+	return nil
+}
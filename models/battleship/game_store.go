@@ -0,0 +1,82 @@
+package battleship
+
+import (
+	"context"
+	"sync"
+
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+)
+
+// Values of the `game.store` setting
+const (
+	GameStoreMemory   = "memory"
+	GameStorePostgres = "postgres"
+)
+
+// Keeps the snapshots of the games so that they outlive the
+// process. The game manager writes one after every state
+// transition and restores the unfinished ones on startup.
+type GameStore interface {
+	SaveGame(ctx context.Context, snapshot GameSnapshot) error
+	LoadGame(ctx context.Context, gameUuid string) (GameSnapshot, error)
+	DeleteGame(ctx context.Context, gameUuid string) error
+
+	// Every game that is not in GamePhaseFinished
+	ListUnfinishedGames(ctx context.Context) ([]GameSnapshot, error)
+}
+
+// Lives as long as the process, so it only survives a
+// restart of the game manager. Useful for tests and for
+// running without a database.
+type MemoryGameStore struct {
+	snapshots map[string]GameSnapshot
+	mu        sync.RWMutex
+}
+
+var _ GameStore = (*MemoryGameStore)(nil)
+
+func NewMemoryGameStore() *MemoryGameStore {
+	return &MemoryGameStore{snapshots: make(map[string]GameSnapshot, 10)}
+}
+
+// Snapshots share no memory with their game, so they are
+// kept as they are
+func (mgs *MemoryGameStore) SaveGame(ctx context.Context, snapshot GameSnapshot) error {
+	mgs.mu.Lock()
+	defer mgs.mu.Unlock()
+
+	mgs.snapshots[snapshot.Uuid] = snapshot
+	return nil
+}
+
+func (mgs *MemoryGameStore) LoadGame(ctx context.Context, gameUuid string) (GameSnapshot, error) {
+	mgs.mu.RLock()
+	defer mgs.mu.RUnlock()
+
+	snapshot, prs := mgs.snapshots[gameUuid]
+	if !prs {
+		return GameSnapshot{}, cerr.ErrGameNotExists(gameUuid)
+	}
+	return snapshot, nil
+}
+
+func (mgs *MemoryGameStore) DeleteGame(ctx context.Context, gameUuid string) error {
+	mgs.mu.Lock()
+	defer mgs.mu.Unlock()
+
+	delete(mgs.snapshots, gameUuid)
+	return nil
+}
+
+func (mgs *MemoryGameStore) ListUnfinishedGames(ctx context.Context) ([]GameSnapshot, error) {
+	mgs.mu.RLock()
+	defer mgs.mu.RUnlock()
+
+	snapshots := make([]GameSnapshot, 0, len(mgs.snapshots))
+	for _, snapshot := range mgs.snapshots {
+		if snapshot.Phase != GamePhaseFinished {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
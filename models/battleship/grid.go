@@ -1,5 +1,12 @@
 package battleship
 
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
 type Coordinates struct {
 	X uint8 `json:"x"`
 	Y uint8 `json:"y"`
@@ -21,3 +28,70 @@ func NewGrid(gridSize uint8) Grid {
 	}
 	return grid
 }
+
+// Deep copy; a nil grid stays nil
+func (g Grid) clone() Grid {
+	if g == nil {
+		return nil
+	}
+
+	clone := make(Grid, len(g))
+	for i, row := range g {
+		clone[i] = append([]uint8{}, row...)
+	}
+	return clone
+}
+
+// A Grid as rows of numbers in JSON. encoding/json writes
+// every []uint8 row of a Grid as a base64 string which
+// nobody can read when inspecting a snapshot.
+type SnapshotGrid [][]uint8
+
+func (sg SnapshotGrid) MarshalJSON() ([]byte, error) {
+	if sg == nil {
+		return []byte("null"), nil
+	}
+
+	buf := make([]byte, 0, len(sg)*(len(sg)*2+2)+2)
+	buf = append(buf, '[')
+	for i, row := range sg {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '[')
+		for j, cell := range row {
+			if j > 0 {
+				buf = append(buf, ',')
+			}
+			buf = strconv.AppendUint(buf, uint64(cell), 10)
+		}
+		buf = append(buf, ']')
+	}
+	return append(buf, ']'), nil
+}
+
+// Only rows of numbers; base64 rows of older snapshots are
+// converted by their migration
+func (sg *SnapshotGrid) UnmarshalJSON(data []byte) error {
+	var rows [][]uint16
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+	if rows == nil {
+		*sg = nil
+		return nil
+	}
+
+	grid := make(SnapshotGrid, len(rows))
+	for i, row := range rows {
+		grid[i] = make([]uint8, len(row))
+		for j, cell := range row {
+			if cell > math.MaxUint8 {
+				return fmt.Errorf("grid cell %d,%d out of range: %d", i, j, cell)
+			}
+			grid[i][j] = uint8(cell)
+		}
+	}
+	*sg = grid
+	return nil
+}
@@ -0,0 +1,34 @@
+package battleship
+
+import "github.com/saeidalz13/battleship-backend/internal/metrics"
+
+var (
+	gamesCreatedTotal = metrics.NewCounterVec(
+		"battleship_games_created_total",
+		"Games created, by difficulty.",
+		"difficulty",
+	)
+	gamesActive = metrics.NewGaugeVec(
+		"battleship_games_active",
+		"Games currently held by the game manager, by difficulty.",
+		"difficulty",
+	)
+	gamesWaitingForOpponent = metrics.NewGauge(
+		"battleship_games_waiting_for_opponent",
+		"Games whose host is still waiting for a player to join.",
+	)
+)
+
+// Label value of the difficulty in the metrics
+func DifficultyName(difficulty uint8) string {
+	switch difficulty {
+	case GameDifficultyEasy:
+		return "easy"
+	case GameDifficultyNormal:
+		return "normal"
+	case GameDifficultyHard:
+		return "hard"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,103 @@
+package battleship
+
+import cerr "github.com/saeidalz13/battleship-backend/internal/error"
+
+const (
+	// Along row X, from Y to the right
+	ShipHorizontal = "horizontal"
+	// Along column Y, from X downwards
+	ShipVertical = "vertical"
+)
+
+// A ship as the client places it: its code, the cell of its
+// bow and the direction it extends in
+type Placement struct {
+	ShipCode    uint8  `json:"ship_code"`
+	X           uint8  `json:"x"`
+	Y           uint8  `json:"y"`
+	Orientation string `json:"orientation"`
+}
+
+// Expands the placements into a defence grid of the game.
+// The grid goes through ValidateDefenceGrid like one sent by
+// the client, so both formats are held to the same fleet rules
+func (g *Game) ExpandPlacements(placements []Placement) (Grid, error) {
+	grid := NewGrid(g.gridSize)
+
+	for _, placement := range placements {
+		length, prs := shipLengths[placement.ShipCode]
+		if !prs {
+			return nil, cerr.ErrInvalidShipCode(placement.ShipCode)
+		}
+		if placement.Orientation != ShipHorizontal && placement.Orientation != ShipVertical {
+			return nil, cerr.ErrInvalidShipOrientation(placement.Orientation)
+		}
+
+		for i := uint8(0); i < length; i++ {
+			x, y := int(placement.X), int(placement.Y)+int(i)
+			if placement.Orientation == ShipVertical {
+				x, y = int(placement.X)+int(i), int(placement.Y)
+			}
+			if x >= int(g.gridSize) || y >= int(g.gridSize) {
+				return nil, cerr.ErrShipOutOfGridBound(placement.ShipCode, placement.X, placement.Y)
+			}
+			if grid[x][y] != PositionStateDefenceGridEmpty {
+				return nil, cerr.ErrShipsOverlap(uint8(x), uint8(y))
+			}
+			grid[x][y] = placement.ShipCode
+		}
+	}
+
+	if err := g.ValidateDefenceGrid(grid); err != nil {
+		return nil, err
+	}
+	return grid, nil
+}
+
+// A defence grid is valid when it has the size of the game and
+// holds every ship exactly once, each in a straight unbroken line
+func (g *Game) ValidateDefenceGrid(grid Grid) error {
+	rows := uint8(len(grid))
+	if rows != g.gridSize {
+		return cerr.ErrDefenceGridRowsOutOfBounds(rows, g.gridSize)
+	}
+
+	shipCells := make(map[uint8][]Coordinates, len(shipCodes))
+	for x, row := range grid {
+		cols := uint8(len(row))
+		if cols != g.gridSize {
+			return cerr.ErrDefenceGridColsOutOfBounds(cols, g.gridSize)
+		}
+
+		for y, state := range row {
+			if state == PositionStateDefenceGridEmpty {
+				continue
+			}
+			if _, prs := shipLengths[state]; !prs {
+				return cerr.ErrDefenceGridInvalidPositionState(uint8(x), uint8(y), state)
+			}
+			shipCells[state] = append(shipCells[state], NewCoordinates(uint8(x), uint8(y)))
+		}
+	}
+
+	for _, code := range shipCodes {
+		if !isStraightLine(shipCells[code], shipLengths[code]) {
+			return cerr.ErrShipMisplaced(code, shipLengths[code])
+		}
+	}
+	return nil
+}
+
+// Cells come in row-major order, so a line starts at the first one
+func isStraightLine(cells []Coordinates, length uint8) bool {
+	if len(cells) != int(length) {
+		return false
+	}
+
+	horizontal, vertical := true, true
+	for i, cell := range cells {
+		horizontal = horizontal && cell == NewCoordinates(cells[0].X, cells[0].Y+uint8(i))
+		vertical = vertical && cell == NewCoordinates(cells[0].X+uint8(i), cells[0].Y)
+	}
+	return horizontal || vertical
+}
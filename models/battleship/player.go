@@ -1,6 +1,9 @@
 package battleship
 
 import (
+	"sync"
+	"sync/atomic"
+
 	"github.com/google/uuid"
 )
 
@@ -51,32 +54,53 @@ type Player interface {
 
 	IsReady() bool
 	IsTurn() bool
+	AttackGrid() Grid
+
+	SetOpponentMuted(muted bool)
+	IsOpponentMuted() bool
+
+	Inventory() Inventory
+	UseWeapon(weapon uint8) bool
+	HasShipInArea(cells []Coordinates) bool
 }
 
 type BattleshipPlayer struct {
+	// The lock of the game. Both loops of the game and the admin
+	// view touch the state below, so every access holds it.
+	mu *sync.Mutex
+
 	isTurn      bool
 	isHost      bool
 	isReady     bool
-	matchStatus uint8
 	sunkenShips uint8
 	uuid        string
 	sessionID   string
 	attackGrid  Grid
 	defenceGrid Grid
 	ships       map[uint8]*Ship
+	inventory   Inventory
+
+	// One of the PlayerMatchStatus constants. Set by the
+	// attacker's loop and read by both.
+	matchStatus atomic.Uint32
+
+	// Set by the player's loop and read by the opponent's. A
+	// preference of the client, so not part of the snapshot.
+	opponentMuted atomic.Bool
 }
 
-func newPlayer(isHost, isTurn bool, sessionID string, gridSize uint8) *BattleshipPlayer {
+func newPlayer(mu *sync.Mutex, isHost, isTurn bool, sessionID string, gridSize uint8) *BattleshipPlayer {
 	return &BattleshipPlayer{
+		mu:          mu,
 		isTurn:      isTurn,
 		isHost:      isHost,
 		isReady:     false,
-		matchStatus: PlayerMatchStatusUndefined,
 		sunkenShips: 0,
 		uuid:        uuid.NewString()[:10],
 		attackGrid:  NewGrid(gridSize),
 		defenceGrid: NewGrid(gridSize),
 		ships:       NewShipsMap(),
+		inventory:   DefaultInventory(),
 		sessionID:   sessionID,
 	}
 }
@@ -90,90 +114,155 @@ func (bp *BattleshipPlayer) Uuid() string {
 }
 
 func (bp *BattleshipPlayer) IsAttackGridEmptyInCoordinates(coordinates Coordinates) bool {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	return bp.attackGrid[coordinates.X][coordinates.Y] == PositionStateAttackGridEmpty
 }
 
 func (bp *BattleshipPlayer) IsDefenceGridAlreadyHitInCoordinates(coordinates Coordinates) bool {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	return bp.defenceGrid[coordinates.X][coordinates.Y] == PositionStateDefenceGridHit
 }
 
 func (bp *BattleshipPlayer) IsAttackMiss(coordinates Coordinates) bool {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	return bp.defenceGrid[coordinates.X][coordinates.Y] == PositionStateDefenceGridEmpty
 }
 
 func (bp *BattleshipPlayer) SetAttackGridToMiss(coordinates Coordinates) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	bp.attackGrid[coordinates.X][coordinates.Y] = PositionStateAttackGridMiss
 }
 
 func (bp *BattleshipPlayer) SetAttackGridToHit(coordinates Coordinates) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	bp.attackGrid[coordinates.X][coordinates.Y] = PositionStateAttackGridHit
 }
 
 func (bp *BattleshipPlayer) IncrementShipHit(code uint8, coordinates Coordinates) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	bp.defenceGrid[coordinates.X][coordinates.Y] = PositionStateDefenceGridHit
 	bp.ships[code].GotHit()
 	bp.ships[code].hitCoordinates = append(bp.ships[code].hitCoordinates, coordinates)
 }
 
 func (bp *BattleshipPlayer) SetMatchStatusToWon() {
-	bp.matchStatus = PlayerMatchStatusWon
+	bp.matchStatus.Store(uint32(PlayerMatchStatusWon))
 }
 
 func (bp *BattleshipPlayer) SetMatchStatusToLost() {
-	bp.matchStatus = PlayerMatchStatusLost
+	bp.matchStatus.Store(uint32(PlayerMatchStatusLost))
 }
 
 func (bp *BattleshipPlayer) ShipCode(coordinates Coordinates) uint8 {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	return bp.defenceGrid[coordinates.X][coordinates.Y]
 }
 
 func (bp *BattleshipPlayer) ShipHitCoordinates(shipCode uint8) []Coordinates {
-	return bp.ships[shipCode].HitCoordinates()
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return append([]Coordinates{}, bp.ships[shipCode].HitCoordinates()...)
 }
 
 func (bp *BattleshipPlayer) AreAllShipsSunken() bool {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	return bp.sunkenShips == sunkenShipsToLose
 }
 
 func (bp *BattleshipPlayer) IsShipSunken(shipCode uint8) bool {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	return bp.ships[shipCode].IsSunk()
 }
 
 func (bp *BattleshipPlayer) SetAttackGrid(newGrid Grid) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	bp.attackGrid = newGrid
 }
 
 func (bp *BattleshipPlayer) SetReady(newGrid Grid) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	bp.defenceGrid = newGrid
 	bp.isReady = true
 }
 
 func (bp *BattleshipPlayer) IncrementSunkenShips() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	bp.sunkenShips++
 }
 
 func (bp *BattleshipPlayer) IsWinner() bool {
-	return bp.matchStatus == PlayerMatchStatusWon
+	return bp.MatchStatus() == PlayerMatchStatusWon
+}
+
+func (bp *BattleshipPlayer) SetOpponentMuted(muted bool) {
+	bp.opponentMuted.Store(muted)
+}
+
+func (bp *BattleshipPlayer) IsOpponentMuted() bool {
+	return bp.opponentMuted.Load()
 }
 
 func (bp *BattleshipPlayer) PrepareForRematch(gridSize uint8) {
-	bp.matchStatus = PlayerMatchStatusUndefined
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	bp.prepareForRematch(gridSize)
+}
+
+// The caller holds the lock of the game
+func (bp *BattleshipPlayer) prepareForRematch(gridSize uint8) {
+	bp.matchStatus.Store(uint32(PlayerMatchStatusUndefined))
 	bp.isReady = false
 	bp.ships = NewShipsMap()
 	bp.sunkenShips = 0
 	bp.attackGrid = NewGrid(gridSize)
 	bp.defenceGrid = NewGrid(gridSize)
+	bp.inventory = DefaultInventory()
 }
 
 func (bp *BattleshipPlayer) SetTurnTrue() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	bp.isTurn = true
 }
 
 func (bp *BattleshipPlayer) SetTurnFalse() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	bp.isTurn = false
 }
 
 func (bp *BattleshipPlayer) IsTurn() bool {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	return bp.isTurn
 }
 
@@ -182,15 +271,64 @@ func (bp *BattleshipPlayer) IsHost() bool {
 }
 
 func (bp *BattleshipPlayer) MatchStatus() uint8 {
-	return bp.matchStatus
+	return uint8(bp.matchStatus.Load())
 }
 
 func (bp *BattleshipPlayer) IsReady() bool {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	return bp.isReady
 }
 
+// Only the hits and misses of the player, so it is safe to
+// show; the defence grid reveals the ships
+func (bp *BattleshipPlayer) AttackGrid() Grid {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return bp.attackGrid.clone()
+}
+
 func (bp *BattleshipPlayer) SunkenShips() uint8 {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	return bp.sunkenShips
 }
 
+func (bp *BattleshipPlayer) Inventory() Inventory {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return bp.inventory
+}
+
+// false if the player has none of the weapon left
+func (bp *BattleshipPlayer) UseWeapon(weapon uint8) bool {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	count := bp.inventory.count(weapon)
+	if *count == 0 {
+		return false
+	}
+	*count--
+	return true
+}
+
+// Only ship cells that were not hit yet count; the attacker
+// knows about the others already
+func (bp *BattleshipPlayer) HasShipInArea(cells []Coordinates) bool {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	for _, cell := range cells {
+		if bp.defenceGrid[cell.X][cell.Y] >= PositionStateDefenceDestroyer {
+			return true
+		}
+	}
+	return false
+}
+
 var _ Player = (*BattleshipPlayer)(nil)
@@ -0,0 +1,68 @@
+package battleship
+
+import cerr "github.com/saeidalz13/battleship-backend/internal/error"
+
+// What an attack tells the players besides hit or miss
+const (
+	// Not even that a ship sank; the end of the game is the
+	// only news
+	DisclosureHideSinking = "hide_sinking"
+	// Sunken ships and their coordinates, but not which ship
+	// a hit belongs to
+	DisclosureHit = "hit"
+	// Every hit is called out with the type of the ship
+	DisclosureCallOut = "call_out"
+)
+
+func IsDisclosureValid(disclosure string) bool {
+	switch disclosure {
+	case DisclosureHideSinking, DisclosureHit, DisclosureCallOut:
+		return true
+	default:
+		return false
+	}
+}
+
+// Optional rules chosen by the host when the game is created;
+// the zero value is the classic game
+type Ruleset struct {
+	// Bombs, torpedoes and sonar pings next to the plain attacks
+	SpecialWeapons bool
+
+	// One of the Disclosure constants; empty is DisclosureHit
+	Disclosure string
+}
+
+func DefaultRuleset() Ruleset {
+	return Ruleset{Disclosure: DisclosureHit}
+}
+
+func (r Ruleset) RevealsSinking() bool {
+	return r.Disclosure != DisclosureHideSinking
+}
+
+func (r Ruleset) RevealsShipType() bool {
+	return r.Disclosure == DisclosureCallOut
+}
+
+func (g *Game) SetRuleset(ruleset Ruleset) error {
+	if ruleset.Disclosure == "" {
+		ruleset.Disclosure = DisclosureHit
+	}
+	if !IsDisclosureValid(ruleset.Disclosure) {
+		return cerr.ErrInvalidDisclosure(ruleset.Disclosure)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.ruleset = ruleset
+	return nil
+}
+
+func (g *Game) Ruleset() Ruleset {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.ruleset
+}
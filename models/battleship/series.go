@@ -0,0 +1,42 @@
+package battleship
+
+// Best-of lengths a game creator can choose from; 1 is a
+// single game that can be rematched as often as wanted
+const (
+	SeriesLengthSingle uint8 = 1
+	SeriesLengthMax    uint8 = 7
+)
+
+func IsSeriesLengthValid(bestOf uint8) bool {
+	return bestOf >= SeriesLengthSingle && bestOf <= SeriesLengthMax && bestOf%2 == 1
+}
+
+// The score of a game and its rematches
+type Series struct {
+	BestOf   uint8
+	HostWins uint8
+	JoinWins uint8
+
+	// Starts at 1 and goes up with every rematch
+	Game uint8
+}
+
+func newSeries(bestOf uint8) Series {
+	return Series{BestOf: bestOf, Game: 1}
+}
+
+func (s Series) IsSingleGame() bool {
+	return s.BestOf <= SeriesLengthSingle
+}
+
+func (s Series) WinsNeeded() uint8 {
+	return s.BestOf/2 + 1
+}
+
+// A single game is never over; it may always be rematched
+func (s Series) IsOver() bool {
+	if s.IsSingleGame() {
+		return false
+	}
+	return s.HostWins >= s.WinsNeeded() || s.JoinWins >= s.WinsNeeded()
+}
@@ -12,6 +12,16 @@ const (
 	sunkenShipsToLose uint8 = 3
 )
 
+// Every ship of a player, in a fixed order
+var shipCodes = []uint8{PositionStateDefenceDestroyer, PositionStateDefenceCruiser, PositionStateDefenceBattleship}
+
+// How many cells each ship covers
+var shipLengths = map[uint8]uint8{
+	PositionStateDefenceDestroyer:  2,
+	PositionStateDefenceCruiser:    3,
+	PositionStateDefenceBattleship: 4,
+}
+
 type Ship struct {
 	Code           uint8
 	length         uint8
@@ -30,9 +40,9 @@ func NewShip(code, length uint8) *Ship {
 
 func NewShipsMap() map[uint8]*Ship {
 	ships := make(map[uint8]*Ship, sunkenShipsToLose)
-	ships[PositionStateDefenceDestroyer] = NewShip(PositionStateDefenceDestroyer, 2)
-	ships[PositionStateDefenceCruiser] = NewShip(PositionStateDefenceCruiser, 3)
-	ships[PositionStateDefenceBattleship] = NewShip(PositionStateDefenceBattleship, 4)
+	for _, code := range shipCodes {
+		ships[code] = NewShip(code, shipLengths[code])
+	}
 
 	return ships
 }
@@ -0,0 +1,198 @@
+package battleship
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+)
+
+// Everything needed to rebuild a game, e.g. after a restart.
+// The defence grids reveal the ships, so a snapshot must never
+// be sent to a client.
+type GameSnapshot struct {
+	Uuid                    string    `json:"uuid"`
+	Difficulty              uint8     `json:"difficulty"`
+	GridSize                uint8     `json:"grid_size"`
+	RematchAlreadyRequested bool      `json:"rematch_already_requested"`
+	StartedAt               time.Time `json:"started_at"`
+
+	BestOf     uint8 `json:"best_of"`
+	HostWins   uint8 `json:"host_wins"`
+	JoinWins   uint8 `json:"join_wins"`
+	SeriesGame uint8 `json:"series_game"`
+
+	FirstTurn  string `json:"first_turn"`
+	HostStarts bool   `json:"host_starts"`
+
+	SpecialWeapons bool   `json:"special_weapons"`
+	Disclosure     string `json:"disclosure"`
+
+	// Derived from the players; kept so that stores can
+	// filter on it without decoding the players
+	Phase string `json:"phase"`
+
+	HostPlayer *PlayerSnapshot `json:"host_player,omitempty"`
+	JoinPlayer *PlayerSnapshot `json:"join_player,omitempty"`
+
+	SavedAt time.Time `json:"saved_at"`
+}
+
+type PlayerSnapshot struct {
+	Uuid        string         `json:"uuid"`
+	SessionId   string         `json:"session_id"`
+	IsHost      bool           `json:"is_host"`
+	IsTurn      bool           `json:"is_turn"`
+	IsReady     bool           `json:"is_ready"`
+	MatchStatus uint8          `json:"match_status"`
+	SunkenShips uint8          `json:"sunken_ships"`
+	AttackGrid  SnapshotGrid   `json:"attack_grid"`
+	DefenceGrid SnapshotGrid   `json:"defence_grid"`
+	Ships       []ShipSnapshot `json:"ships"`
+	Inventory   Inventory      `json:"inventory"`
+}
+
+type ShipSnapshot struct {
+	Code           uint8         `json:"code"`
+	Length         uint8         `json:"length"`
+	Hits           uint8         `json:"hits"`
+	HitCoordinates []Coordinates `json:"hit_coordinates"`
+}
+
+// The snapshot shares no memory with the game, so the game
+// can go on while the snapshot is written somewhere. It is
+// taken under the lock of the game, so it is consistent.
+func (g *Game) Snapshot() GameSnapshot {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	snapshot := GameSnapshot{
+		Uuid:                    g.uuid,
+		Difficulty:              g.difficulty,
+		GridSize:                g.gridSize,
+		RematchAlreadyRequested: g.rematchAlreadyRequested,
+		StartedAt:               g.startedAt,
+		BestOf:                  g.series.BestOf,
+		HostWins:                g.series.HostWins,
+		JoinWins:                g.series.JoinWins,
+		SeriesGame:              g.series.Game,
+		FirstTurn:               g.firstTurnPolicy,
+		HostStarts:              g.hostStarts,
+		SpecialWeapons:          g.ruleset.SpecialWeapons,
+		Disclosure:              g.ruleset.Disclosure,
+		Phase:                   g.phase(),
+	}
+	if g.hostPlayer != nil {
+		hostSnapshot := g.hostPlayer.snapshot()
+		snapshot.HostPlayer = &hostSnapshot
+	}
+	if g.joinPlayer != nil {
+		joinSnapshot := g.joinPlayer.snapshot()
+		snapshot.JoinPlayer = &joinSnapshot
+	}
+	return snapshot
+}
+
+// Rebuilds the game of a snapshot taken by Game.Snapshot
+func RestoreGame(snapshot GameSnapshot) *Game {
+	game := &Game{}
+	game.restore(snapshot)
+	return game
+}
+
+func (g *Game) restore(snapshot GameSnapshot) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.uuid = snapshot.Uuid
+	g.difficulty = snapshot.Difficulty
+	g.gridSize = snapshot.GridSize
+	g.validUpperBound = snapshot.GridSize - 1
+	g.rematchAlreadyRequested = snapshot.RematchAlreadyRequested
+	g.startedAt = snapshot.StartedAt
+	g.series = Series{BestOf: snapshot.BestOf, HostWins: snapshot.HostWins, JoinWins: snapshot.JoinWins, Game: snapshot.SeriesGame}
+	g.firstTurnPolicy = snapshot.FirstTurn
+	g.hostStarts = snapshot.HostStarts
+	g.ruleset = Ruleset{SpecialWeapons: snapshot.SpecialWeapons, Disclosure: snapshot.Disclosure}
+	if g.coinFlip == nil {
+		g.coinFlip = defaultCoinFlip
+	}
+	g.logger = slog.Default().With(logging.KeyGame, snapshot.Uuid, "difficulty", DifficultyName(snapshot.Difficulty))
+
+	g.hostPlayer, g.joinPlayer = nil, nil
+	if snapshot.HostPlayer != nil {
+		g.hostPlayer = &BattleshipPlayer{}
+		g.hostPlayer.restore(&g.mu, *snapshot.HostPlayer)
+	}
+	if snapshot.JoinPlayer != nil {
+		g.joinPlayer = &BattleshipPlayer{}
+		g.joinPlayer.restore(&g.mu, *snapshot.JoinPlayer)
+	}
+	g.started = snapshot.HostPlayer != nil && snapshot.HostPlayer.IsReady && snapshot.JoinPlayer != nil && snapshot.JoinPlayer.IsReady
+}
+
+// The caller holds the lock of the game
+func (bp *BattleshipPlayer) snapshot() PlayerSnapshot {
+	ships := make([]ShipSnapshot, 0, len(bp.ships))
+	for _, code := range shipCodes {
+		if ship, prs := bp.ships[code]; prs {
+			ships = append(ships, ship.snapshot())
+		}
+	}
+
+	return PlayerSnapshot{
+		Uuid:        bp.uuid,
+		SessionId:   bp.sessionID,
+		IsHost:      bp.isHost,
+		IsTurn:      bp.isTurn,
+		IsReady:     bp.isReady,
+		MatchStatus: bp.MatchStatus(),
+		SunkenShips: bp.sunkenShips,
+		AttackGrid:  SnapshotGrid(bp.attackGrid.clone()),
+		DefenceGrid: SnapshotGrid(bp.defenceGrid.clone()),
+		Ships:       ships,
+		Inventory:   bp.inventory,
+	}
+}
+
+// mu is the lock of the game, or a lock of its own for a
+// player decoded without one
+func (bp *BattleshipPlayer) restore(mu *sync.Mutex, snapshot PlayerSnapshot) {
+	ships := make(map[uint8]*Ship, len(snapshot.Ships))
+	for _, shipSnapshot := range snapshot.Ships {
+		ship := &Ship{}
+		ship.restore(shipSnapshot)
+		ships[ship.Code] = ship
+	}
+
+	*bp = BattleshipPlayer{
+		mu:          mu,
+		isTurn:      snapshot.IsTurn,
+		isHost:      snapshot.IsHost,
+		isReady:     snapshot.IsReady,
+		sunkenShips: snapshot.SunkenShips,
+		uuid:        snapshot.Uuid,
+		sessionID:   snapshot.SessionId,
+		attackGrid:  Grid(snapshot.AttackGrid).clone(),
+		defenceGrid: Grid(snapshot.DefenceGrid).clone(),
+		ships:       ships,
+		inventory:   snapshot.Inventory,
+	}
+	bp.matchStatus.Store(uint32(snapshot.MatchStatus))
+}
+
+func (sh *Ship) snapshot() ShipSnapshot {
+	return ShipSnapshot{
+		Code:           sh.Code,
+		Length:         sh.length,
+		Hits:           sh.hits,
+		HitCoordinates: append([]Coordinates{}, sh.hitCoordinates...),
+	}
+}
+
+func (sh *Ship) restore(snapshot ShipSnapshot) {
+	*sh = *NewShip(snapshot.Code, snapshot.Length)
+	sh.hits = snapshot.Hits
+	sh.hitCoordinates = append(sh.hitCoordinates, snapshot.HitCoordinates...)
+}
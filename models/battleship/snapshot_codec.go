@@ -0,0 +1,360 @@
+package battleship
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+)
+
+/*
+Snapshots are versioned so that a server can read what an
+older one wrote, e.g. the game store after a deploy.
+
+	1: the plain JSON of GameSnapshot, grid rows as base64
+	2: JSON envelope with the version; grid rows as numbers.
+	   Binary is the version (big endian uint16) followed by
+	   the MessagePack of the snapshot.
+	3: games carry the score of their best-of series
+	4: games carry their first turn policy
+	5: the special weapons rule and what the players have left
+	6: what an attack discloses
+
+Changing the snapshot structs means a new version and a
+migration from the previous one in every table below.
+*/
+const SnapshotVersion uint16 = 6
+
+// Brings a decoded snapshot document of version n to n+1.
+// nil means the document did not change.
+type snapshotMigration func(doc map[string]any) error
+
+// Indexed by the version they migrate from
+var (
+	gameSnapshotMigrations = [SnapshotVersion]snapshotMigration{
+		1: migrateGameSnapshotV1,
+		2: migrateGameSnapshotV2,
+		3: migrateGameSnapshotV3,
+		4: migrateGameSnapshotV4,
+		5: migrateGameSnapshotV5,
+	}
+	playerSnapshotMigrations = [SnapshotVersion]snapshotMigration{
+		1: migratePlayerSnapshotV1,
+		2: nil,
+		3: nil,
+		4: migratePlayerSnapshotV4,
+		5: nil,
+	}
+	shipSnapshotMigrations = [SnapshotVersion]snapshotMigration{
+		1: nil,
+		2: nil,
+		3: nil,
+		4: nil,
+		5: nil,
+	}
+)
+
+type snapshotEnvelope[T any] struct {
+	Version  uint16 `json:"version"`
+	Snapshot T      `json:"snapshot"`
+}
+
+// The snapshot structs themselves have no methods so that
+// nested players and ships are not wrapped in envelopes
+type gameSnapshotData GameSnapshot
+
+func (s GameSnapshot) MarshalJSON() ([]byte, error) {
+	return marshalSnapshotJSON(gameSnapshotData(s))
+}
+
+func (s *GameSnapshot) UnmarshalJSON(data []byte) error {
+	return unmarshalSnapshotJSON(data, (*gameSnapshotData)(s), gameSnapshotMigrations)
+}
+
+func (s GameSnapshot) MarshalBinary() ([]byte, error) {
+	return marshalSnapshotBinary(gameSnapshotData(s))
+}
+
+func (s *GameSnapshot) UnmarshalBinary(data []byte) error {
+	return unmarshalSnapshotBinary(data, (*gameSnapshotData)(s), gameSnapshotMigrations)
+}
+
+// Game, BattleshipPlayer and Ship are encoded as their
+// snapshots. Both formats reveal the ships; never send
+// them to a client.
+
+func (g *Game) MarshalJSON() ([]byte, error) {
+	return g.Snapshot().MarshalJSON()
+}
+
+func (g *Game) UnmarshalJSON(data []byte) error {
+	var snapshot GameSnapshot
+	if err := snapshot.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	g.restore(snapshot)
+	return nil
+}
+
+func (g *Game) MarshalBinary() ([]byte, error) {
+	return g.Snapshot().MarshalBinary()
+}
+
+func (g *Game) UnmarshalBinary(data []byte) error {
+	var snapshot GameSnapshot
+	if err := snapshot.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	g.restore(snapshot)
+	return nil
+}
+
+func (bp *BattleshipPlayer) MarshalJSON() ([]byte, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return marshalSnapshotJSON(bp.snapshot())
+}
+
+func (bp *BattleshipPlayer) UnmarshalJSON(data []byte) error {
+	var snapshot PlayerSnapshot
+	if err := unmarshalSnapshotJSON(data, &snapshot, playerSnapshotMigrations); err != nil {
+		return err
+	}
+	bp.restore(&sync.Mutex{}, snapshot)
+	return nil
+}
+
+func (bp *BattleshipPlayer) MarshalBinary() ([]byte, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return marshalSnapshotBinary(bp.snapshot())
+}
+
+func (bp *BattleshipPlayer) UnmarshalBinary(data []byte) error {
+	var snapshot PlayerSnapshot
+	if err := unmarshalSnapshotBinary(data, &snapshot, playerSnapshotMigrations); err != nil {
+		return err
+	}
+	bp.restore(&sync.Mutex{}, snapshot)
+	return nil
+}
+
+func (sh *Ship) MarshalJSON() ([]byte, error) {
+	return marshalSnapshotJSON(sh.snapshot())
+}
+
+func (sh *Ship) UnmarshalJSON(data []byte) error {
+	var snapshot ShipSnapshot
+	if err := unmarshalSnapshotJSON(data, &snapshot, shipSnapshotMigrations); err != nil {
+		return err
+	}
+	sh.restore(snapshot)
+	return nil
+}
+
+func (sh *Ship) MarshalBinary() ([]byte, error) {
+	return marshalSnapshotBinary(sh.snapshot())
+}
+
+func (sh *Ship) UnmarshalBinary(data []byte) error {
+	var snapshot ShipSnapshot
+	if err := unmarshalSnapshotBinary(data, &snapshot, shipSnapshotMigrations); err != nil {
+		return err
+	}
+	sh.restore(snapshot)
+	return nil
+}
+
+func marshalSnapshotJSON[T any](snapshot T) ([]byte, error) {
+	return json.Marshal(snapshotEnvelope[T]{Version: SnapshotVersion, Snapshot: snapshot})
+}
+
+// Documents without a version are the bare snapshots of
+// version 1
+func unmarshalSnapshotJSON[T any](data []byte, snapshot *T, migrations [SnapshotVersion]snapshotMigration) error {
+	var envelope snapshotEnvelope[json.RawMessage]
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return cerr.ErrInvalidSnapshot(err)
+	}
+	if envelope.Version == 0 {
+		envelope = snapshotEnvelope[json.RawMessage]{Version: 1, Snapshot: data}
+	}
+
+	return decodeSnapshotJSON(envelope, snapshot, migrations)
+}
+
+func marshalSnapshotBinary[T any](snapshot T) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(binary.BigEndian.AppendUint16(nil, SnapshotVersion))
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(snapshot); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Older versions go through the migrations of the JSON
+// documents since that is where they are written
+func unmarshalSnapshotBinary[T any](data []byte, snapshot *T, migrations [SnapshotVersion]snapshotMigration) error {
+	if len(data) < 2 {
+		return cerr.ErrInvalidSnapshot(errors.New("missing version"))
+	}
+	version := binary.BigEndian.Uint16(data)
+
+	dec := msgpack.NewDecoder(bytes.NewReader(data[2:]))
+	dec.SetCustomStructTag("json")
+
+	if version == SnapshotVersion {
+		if err := dec.Decode(snapshot); err != nil {
+			return cerr.ErrInvalidSnapshot(err)
+		}
+		return nil
+	}
+
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return cerr.ErrInvalidSnapshot(err)
+	}
+	docJson, err := json.Marshal(doc)
+	if err != nil {
+		return cerr.ErrInvalidSnapshot(err)
+	}
+	return decodeSnapshotJSON(snapshotEnvelope[json.RawMessage]{Version: version, Snapshot: docJson}, snapshot, migrations)
+}
+
+// Unknown fields are an error so that a change of the
+// structs without a new version does not go unnoticed
+func decodeSnapshotJSON[T any](envelope snapshotEnvelope[json.RawMessage], snapshot *T, migrations [SnapshotVersion]snapshotMigration) error {
+	if envelope.Version > SnapshotVersion {
+		return cerr.ErrSnapshotVersionUnsupported(envelope.Version, SnapshotVersion)
+	}
+
+	snapshotJson := []byte(envelope.Snapshot)
+	if envelope.Version < SnapshotVersion {
+		var doc map[string]any
+		if err := json.Unmarshal(snapshotJson, &doc); err != nil {
+			return cerr.ErrInvalidSnapshot(err)
+		}
+		for version := envelope.Version; version < SnapshotVersion; version++ {
+			if migrate := migrations[version]; migrate != nil {
+				if err := migrate(doc); err != nil {
+					return cerr.ErrInvalidSnapshot(fmt.Errorf("migrating from version %d: %w", version, err))
+				}
+			}
+		}
+
+		var err error
+		if snapshotJson, err = json.Marshal(doc); err != nil {
+			return cerr.ErrInvalidSnapshot(err)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(snapshotJson))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(snapshot); err != nil {
+		return cerr.ErrInvalidSnapshot(err)
+	}
+	return nil
+}
+
+func migrateGameSnapshotV1(doc map[string]any) error {
+	for _, key := range []string{"host_player", "join_player"} {
+		player, ok := doc[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		if err := migratePlayerSnapshotV1(player); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Every game was a single game. Numbers are float64 like
+// the ones of the decoded document.
+func migrateGameSnapshotV2(doc map[string]any) error {
+	doc["best_of"] = float64(SeriesLengthSingle)
+	doc["series_game"] = float64(1)
+	return nil
+}
+
+// The host started the odd games of a series and every
+// single game
+func migrateGameSnapshotV3(doc map[string]any) error {
+	bestOf, _ := doc["best_of"].(float64)
+	seriesGame, _ := doc["series_game"].(float64)
+
+	doc["first_turn"] = DefaultFirstTurnPolicy(uint8(bestOf))
+	doc["host_starts"] = bestOf <= float64(SeriesLengthSingle) || int(seriesGame)%2 == 1
+	return nil
+}
+
+// No game had special weapons. The players get the full
+// inventory of a new player.
+func migrateGameSnapshotV4(doc map[string]any) error {
+	doc["special_weapons"] = false
+	for _, key := range []string{"host_player", "join_player"} {
+		if player, ok := doc[key].(map[string]any); ok {
+			if err := migratePlayerSnapshotV4(player); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func migratePlayerSnapshotV4(doc map[string]any) error {
+	inventory := DefaultInventory()
+	doc["inventory"] = map[string]any{
+		"bombs":     float64(inventory.Bombs),
+		"torpedoes": float64(inventory.Torpedoes),
+		"sonars":    float64(inventory.Sonars),
+	}
+	return nil
+}
+
+// Every attack disclosed the hit and the sunken ships
+func migrateGameSnapshotV5(doc map[string]any) error {
+	doc["disclosure"] = DisclosureHit
+	return nil
+}
+
+// Grid rows were base64 strings
+func migratePlayerSnapshotV1(doc map[string]any) error {
+	for _, key := range []string{"attack_grid", "defence_grid"} {
+		rows, ok := doc[key].([]any)
+		if !ok {
+			continue
+		}
+
+		for i, row := range rows {
+			encodedRow, ok := row.(string)
+			if !ok {
+				continue
+			}
+			decodedRow, err := base64.StdEncoding.DecodeString(encodedRow)
+			if err != nil {
+				return fmt.Errorf("%s row %d: %w", key, i, err)
+			}
+
+			cells := make([]any, len(decodedRow))
+			for j, cell := range decodedRow {
+				cells[j] = cell
+			}
+			rows[i] = cells
+		}
+	}
+	return nil
+}
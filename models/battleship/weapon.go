@@ -0,0 +1,87 @@
+package battleship
+
+// Special weapons of the Ruleset.SpecialWeapons games
+const (
+	// Hits the 3x3 square around a cell
+	WeaponBomb uint8 = iota
+	// Hits a whole row or column
+	WeaponTorpedo
+	// Tells whether a ship lies in the 3x3 square around a
+	// cell without damaging it
+	WeaponSonar
+)
+
+const (
+	TorpedoRow    = "row"
+	TorpedoColumn = "column"
+)
+
+// The special weapons a player has left in the current match
+type Inventory struct {
+	Bombs     uint8 `json:"bombs"`
+	Torpedoes uint8 `json:"torpedoes"`
+	Sonars    uint8 `json:"sonars"`
+}
+
+// Refilled for every rematch
+func DefaultInventory() Inventory {
+	return Inventory{Bombs: 1, Torpedoes: 1, Sonars: 2}
+}
+
+func (inv *Inventory) count(weapon uint8) *uint8 {
+	switch weapon {
+	case WeaponBomb:
+		return &inv.Bombs
+	case WeaponTorpedo:
+		return &inv.Torpedoes
+	default:
+		return &inv.Sonars
+	}
+}
+
+func (inv Inventory) Has(weapon uint8) bool {
+	return *inv.count(weapon) > 0
+}
+
+func WeaponName(weapon uint8) string {
+	switch weapon {
+	case WeaponBomb:
+		return "bomb"
+	case WeaponTorpedo:
+		return "torpedo"
+	default:
+		return "sonar"
+	}
+}
+
+func IsTorpedoOrientationValid(orientation string) bool {
+	return orientation == TorpedoRow || orientation == TorpedoColumn
+}
+
+// The cells of the 3x3 square around the center that lie on
+// the grid, row by row
+func (g *Game) SquareArea(center Coordinates) []Coordinates {
+	cells := make([]Coordinates, 0, 9)
+	for x := int(center.X) - 1; x <= int(center.X)+1; x++ {
+		for y := int(center.Y) - 1; y <= int(center.Y)+1; y++ {
+			if x < int(ValidLowerBound) || y < int(ValidLowerBound) || x > int(g.validUpperBound) || y > int(g.validUpperBound) {
+				continue
+			}
+			cells = append(cells, NewCoordinates(uint8(x), uint8(y)))
+		}
+	}
+	return cells
+}
+
+// Every cell of row (X) or column (Y) index
+func (g *Game) Line(index uint8, orientation string) []Coordinates {
+	cells := make([]Coordinates, 0, g.gridSize)
+	for i := uint8(0); i < g.gridSize; i++ {
+		if orientation == TorpedoRow {
+			cells = append(cells, NewCoordinates(index, i))
+		} else {
+			cells = append(cells, NewCoordinates(i, index))
+		}
+	}
+	return cells
+}
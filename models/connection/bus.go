@@ -0,0 +1,138 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Values of the `cluster.bus` setting
+const (
+	MessageBusNone     = "none"
+	MessageBusPostgres = "postgres"
+)
+
+// Kinds of the messages nodes send each other
+const (
+	// A msg for a session that is not on the sending node,
+	// see Communicate
+	BusKindEvent = "event"
+
+	// A node hands a client over to the node that owns the
+	// game it wants to join, see RelaySession
+	BusKindOpen = "open"
+
+	// A websocket frame of a relayed client, either from the
+	// client to the owner or the other way round
+	BusKindFrame = "frame"
+
+	// The relayed client or its session on the owner is gone
+	BusKindClose = "close"
+)
+
+var ErrBusClosed = errors.New("message bus is closed")
+
+type BusMessage struct {
+	Kind string `json:"kind"`
+
+	// The node the msg is for; empty means every node
+	NodeId     string `json:"node_id,omitempty"`
+	FromNodeId string `json:"from_node_id"`
+	SessionId  string `json:"session_id"`
+
+	Payload []byte `json:"payload,omitempty"`
+
+	// Only for BusKindOpen
+	Subprotocol string `json:"subprotocol,omitempty"`
+	RemoteAddr  string `json:"remote_addr,omitempty"`
+
+	// Only for BusKindClose
+	CloseCode   int    `json:"close_code,omitempty"`
+	CloseReason string `json:"close_reason,omitempty"`
+}
+
+// Connects the nodes of a cluster so that the sessions of
+// one game can live on different nodes. Messages from one
+// node to another arrive in the order they were published.
+type MessageBus interface {
+	Publish(ctx context.Context, msg BusMessage) error
+
+	// The handler gets the msgs for the node and the ones for
+	// every node, one at a time
+	Subscribe(nodeId string, handler func(BusMessage)) error
+	Close() error
+}
+
+// Connects the nodes of one process. Useful for tests and
+// for running more than one node without a database.
+type InProcessBus struct {
+	subscribers map[string][]chan BusMessage
+	closed      bool
+	mu          sync.RWMutex
+}
+
+var _ MessageBus = (*InProcessBus)(nil)
+
+// Messages a node has not handled yet before Publish blocks
+const inProcessBusBuffer = 256
+
+func NewInProcessBus() *InProcessBus {
+	return &InProcessBus{subscribers: make(map[string][]chan BusMessage, 2)}
+}
+
+func (b *InProcessBus) Publish(ctx context.Context, msg BusMessage) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrBusClosed
+	}
+
+	for nodeId, subscribers := range b.subscribers {
+		if msg.NodeId != "" && msg.NodeId != nodeId {
+			continue
+		}
+		for _, subscriber := range subscribers {
+			select {
+			case subscriber <- msg:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+func (b *InProcessBus) Subscribe(nodeId string, handler func(BusMessage)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBusClosed
+	}
+
+	subscriber := make(chan BusMessage, inProcessBusBuffer)
+	b.subscribers[nodeId] = append(b.subscribers[nodeId], subscriber)
+	go func() {
+		for msg := range subscriber {
+			handler(msg)
+		}
+	}()
+	return nil
+}
+
+func (b *InProcessBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for _, subscribers := range b.subscribers {
+		for _, subscriber := range subscribers {
+			close(subscriber)
+		}
+	}
+	return nil
+}
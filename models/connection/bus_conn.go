@@ -0,0 +1,145 @@
+package connection
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// How long a single publish to the bus may take
+const busPublishTimeout = time.Second * 5
+
+// Frames of a relayed client not read by its loop yet
+const busConnBuffer = 64
+
+// The conn of a session whose client is connected to
+// another node (the relay). Frames go over the bus in both
+// directions; the relay writes them to the real conn.
+type busConn struct {
+	bus         MessageBus
+	nodeId      string
+	relayNodeId string
+	sessionId   string
+	subprotocol string
+	remoteAddr  busAddr
+
+	incoming  chan BusMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// The relay closes the client's conn on the first close
+	// it gets; Close only sends one if none was sent before
+	closeSent atomic.Bool
+}
+
+var _ Conn = (*busConn)(nil)
+
+func newBusConn(bus MessageBus, nodeId string, open BusMessage) *busConn {
+	return &busConn{
+		bus:         bus,
+		nodeId:      nodeId,
+		relayNodeId: open.FromNodeId,
+		sessionId:   open.SessionId,
+		subprotocol: open.Subprotocol,
+		remoteAddr:  busAddr(open.RemoteAddr),
+		incoming:    make(chan BusMessage, busConnBuffer),
+		closed:      make(chan struct{}),
+	}
+}
+
+// A close from the relay is returned the way websocket.Conn
+// returns a close frame so that the session loop handles it
+// like one of a local client
+func (bc *busConn) ReadMessage() (int, []byte, error) {
+	select {
+	case msg := <-bc.incoming:
+		if msg.Kind == BusKindClose {
+			return -1, nil, &websocket.CloseError{Code: msg.CloseCode, Text: msg.CloseReason}
+		}
+		return CodecForSubprotocol(bc.subprotocol).FrameType(), msg.Payload, nil
+
+	case <-bc.closed:
+		return -1, nil, net.ErrClosed
+	}
+}
+
+func (bc *busConn) WriteMessage(_ int, data []byte) error {
+	select {
+	case <-bc.closed:
+		return net.ErrClosed
+	default:
+	}
+
+	return bc.publish(BusMessage{Kind: BusKindFrame, Payload: data})
+}
+
+// Only close frames are relayed; pings are the business of
+// the node the client is connected to
+func (bc *busConn) WriteControl(messageType int, data []byte, _ time.Time) error {
+	if messageType != websocket.CloseMessage {
+		return nil
+	}
+
+	closeCode, reason := websocket.CloseNoStatusReceived, ""
+	if len(data) >= 2 {
+		closeCode, reason = int(binary.BigEndian.Uint16(data)), string(data[2:])
+	}
+	bc.closeSent.Store(true)
+	return bc.publish(BusMessage{Kind: BusKindClose, CloseCode: closeCode, CloseReason: reason})
+}
+
+func (bc *busConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (bc *busConn) Close() error {
+	bc.closeOnce.Do(func() {
+		close(bc.closed)
+		if !bc.closeSent.Load() {
+			_ = bc.publish(BusMessage{Kind: BusKindClose, CloseCode: websocket.CloseNormalClosure})
+		}
+	})
+	return nil
+}
+
+func (bc *busConn) RemoteAddr() net.Addr {
+	return bc.remoteAddr
+}
+
+func (bc *busConn) Subprotocol() string {
+	return bc.subprotocol
+}
+
+// Called by the bus handler with the frames of the client
+func (bc *busConn) deliver(msg BusMessage) {
+	select {
+	case bc.incoming <- msg:
+	case <-bc.closed:
+	}
+}
+
+func (bc *busConn) publish(msg BusMessage) error {
+	msg.NodeId = bc.relayNodeId
+	msg.FromNodeId = bc.nodeId
+	msg.SessionId = bc.sessionId
+
+	ctx, cancel := context.WithTimeout(context.Background(), busPublishTimeout)
+	defer cancel()
+	return bc.bus.Publish(ctx, msg)
+}
+
+// The address of the client as seen by the relay
+type busAddr string
+
+func (a busAddr) Network() string {
+	return "bus"
+}
+
+func (a busAddr) String() string {
+	return string(a)
+}
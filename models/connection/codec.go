@@ -0,0 +1,93 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Websocket subprotocols a client can ask for in the
+// `Sec-WebSocket-Protocol` header. No header means JSON.
+const (
+	SubprotocolJSON    string = "battleship.json"
+	SubprotocolMsgpack string = "battleship.msgpack"
+)
+
+// Codec decides how messages of a session are put on the
+// wire. It is chosen once per connection during the upgrade.
+type Codec interface {
+	Subprotocol() string
+	FrameType() int
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// The order matters; the upgrader picks the first one
+// the client also supports.
+func Subprotocols() []string {
+	return []string{SubprotocolMsgpack, SubprotocolJSON}
+}
+
+func CodecForSubprotocol(subprotocol string) Codec {
+	switch subprotocol {
+	case SubprotocolMsgpack:
+		return MsgpackCodec{}
+	default:
+		return JSONCodec{}
+	}
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Subprotocol() string {
+	return SubprotocolJSON
+}
+
+func (JSONCodec) FrameType() int {
+	return websocket.TextMessage
+}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// MessagePack reuses the json tags so both codecs
+// agree on field names and omitempty rules
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Subprotocol() string {
+	return SubprotocolMsgpack
+}
+
+func (MsgpackCodec) FrameType() int {
+	return websocket.BinaryMessage
+}
+
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+var (
+	_ Codec = JSONCodec{}
+	_ Codec = MsgpackCodec{}
+)
@@ -0,0 +1,38 @@
+package connection
+
+// A fixed reaction; clients show it in the player's language
+// by its key
+type Emote struct {
+	Id  uint8  `json:"id"`
+	Key string `json:"key"`
+}
+
+/*
+The catalogue is part of the public API like the error codes:
+an ID must never be reused or renumbered and new emotes are
+added at the end.
+*/
+var emotes = []Emote{
+	{Id: 1, Key: "good_game"},
+	{Id: 2, Key: "well_played"},
+	{Id: 3, Key: "nice_shot"},
+	{Id: 4, Key: "oops"},
+	{Id: 5, Key: "thinking"},
+	{Id: 6, Key: "hurry_up"},
+	{Id: 7, Key: "thanks"},
+	{Id: 8, Key: "rematch"},
+}
+
+// Copy of the catalogue in the order of the IDs
+func Emotes() []Emote {
+	return append([]Emote(nil), emotes...)
+}
+
+func FindEmote(emoteId uint8) (Emote, bool) {
+	for _, emote := range emotes {
+		if emote.Id == emoteId {
+			return emote, true
+		}
+	}
+	return Emote{}, false
+}
@@ -0,0 +1,27 @@
+package connection
+
+import "time"
+
+const (
+	ExpiryReasonIdle        string = "idle"
+	ExpiryReasonMaxLifetime string = "max_lifetime"
+)
+
+type ExpiryConfig struct {
+	// Since the last message from the client; 0 disables
+	IdleTimeout time.Duration
+
+	// Since the session was created; 0 disables
+	MaxLifetime time.Duration
+
+	// How often the sessions are checked
+	SweepInterval time.Duration
+}
+
+func DefaultExpiryConfig() ExpiryConfig {
+	return ExpiryConfig{
+		IdleTimeout:   time.Minute * 10,
+		MaxLifetime:   time.Hour * 2,
+		SweepInterval: time.Minute,
+	}
+}
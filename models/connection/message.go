@@ -2,7 +2,16 @@ package connection
 
 type NoPayload bool
 type Message[T any] struct {
-	Code    uint8      `json:"code"`
+	Code uint8 `json:"code"`
+
+	// Echo of the `request_id` of the incoming signal
+	// this message responds to (direct responses only)
+	RequestId string `json:"request_id,omitempty"`
+
+	// Server-assigned sequence number of pushed events.
+	// Zero for direct responses
+	Seq uint64 `json:"seq,omitempty"`
+
 	Payload T        `json:"payload,omitempty"`
 	Error   *RespErr `json:"error,omitempty"`
 }
@@ -15,6 +24,29 @@ func (m *Message[T]) AddPayload(payload T) {
 	m.Payload = payload
 }
 
-func (m *Message[T]) AddError(errorDetails, message string) {
-	m.Error = NewRespErr(errorDetails, message)
+// The code and fields of the error are taken from the
+// typed errors of internal/error when err is one of them
+func (m *Message[T]) AddError(err error, message string) {
+	m.Error = NewRespErr(err, message)
+	errorsTotal.WithLabelValues(m.Error.Code.String()).Inc()
+}
+
+// Returns a copy of the message carrying the request ID
+// of the signal it is a response to. The original is not
+// touched so the same message can still be pushed to the
+// other player without leaking the ID.
+func (m Message[T]) WithRequestId(requestId string) Message[T] {
+	m.RequestId = requestId
+	return m
+}
+
+// Every Message[T] satisfies this so that a session can
+// stamp the pushed events without knowing about T
+type sequenced interface {
+	withSeq(seq uint64) interface{}
+}
+
+func (m Message[T]) withSeq(seq uint64) interface{} {
+	m.Seq = seq
+	return m
 }
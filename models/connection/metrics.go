@@ -0,0 +1,28 @@
+package connection
+
+import "github.com/saeidalz13/battleship-backend/internal/metrics"
+
+var (
+	sessionsActive = metrics.NewGauge(
+		"battleship_sessions_active",
+		"Sessions currently held by the session manager, including the ones in their grace period.",
+	)
+	reconnectsTotal = metrics.NewCounter(
+		"battleship_reconnects_total",
+		"Sessions resumed on a new conn.",
+	)
+	gracePeriodExpiriesTotal = metrics.NewCounter(
+		"battleship_grace_period_expiries_total",
+		"Sessions that did not reconnect within the grace period.",
+	)
+	sessionsExpiredTotal = metrics.NewCounterVec(
+		"battleship_sessions_expired_total",
+		"Sessions closed by the sweeper, by reason.",
+		"reason",
+	)
+	errorsTotal = metrics.NewCounterVec(
+		"battleship_errors_total",
+		"Error responses sent to the clients, by error code.",
+		"code",
+	)
+)
@@ -6,12 +6,28 @@ import (
 
 type ReqCreateGame struct {
 	GameDifficulty uint8 `json:"game_difficulty"`
+
+	// 3, 5 or 7 for a best-of series; a single game if omitted
+	BestOf uint8 `json:"best_of,omitempty"`
+
+	// One of the battleship.FirstTurn policies; "host" for a
+	// single game and "alternate" for a series if omitted
+	FirstTurn string `json:"first_turn,omitempty"`
+
+	SpecialWeapons bool `json:"special_weapons,omitempty"`
+
+	// One of the battleship.Disclosure rules; "hit" if omitted
+	Disclosure string `json:"disclosure,omitempty"`
 }
 
 type ReqReadyPlayer struct {
 	GameUuid    string `json:"game_uuid"`
 	PlayerUuid  string `json:"player_uuid"`
 	DefenceGrid b.Grid `json:"defence_grid"`
+
+	// Alternative to DefenceGrid; the server expands them
+	// into the grid. Takes precedence if both are sent
+	Placements []b.Placement `json:"placements,omitempty"`
 }
 
 type ReqJoinGame struct {
@@ -21,6 +37,49 @@ type ReqJoinGame struct {
 type ReqAttack struct {
 	GameUuid   string `json:"game_uuid"`
 	PlayerUuid string `json:"player_uuid"`
-	X          uint8    `json:"x"`
-	Y          uint8    `json:"y"`
+	X          uint8  `json:"x"`
+	Y          uint8  `json:"y"`
+}
+
+// The center of the 3x3 square
+type ReqBomb struct {
+	X uint8 `json:"x"`
+	Y uint8 `json:"y"`
+}
+
+// The row (X) or column (Y) at index
+type ReqTorpedo struct {
+	Index       uint8  `json:"index"`
+	Orientation string `json:"orientation"`
+}
+
+// The center of the 3x3 square
+type ReqSonar struct {
+	X uint8 `json:"x"`
+	Y uint8 `json:"y"`
+}
+
+type ReqReplayEvents struct {
+	LastSeq uint64 `json:"last_seq"`
+}
+
+type ReqChat struct {
+	Text string `json:"text"`
+}
+
+type ReqEmote struct {
+	EmoteId uint8 `json:"emote_id"`
+}
+
+type ReqMuteOpponent struct {
+	Muted bool `json:"muted"`
+}
+
+type ReqJoinTournamentMatch struct {
+	TournamentUuid string `json:"tournament_uuid"`
+	SeatToken      string `json:"seat_token"`
+}
+
+type ReqTournamentStandings struct {
+	TournamentUuid string `json:"tournament_uuid"`
 }
@@ -1,28 +1,90 @@
 package connection
 
 import (
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
 	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mt "github.com/saeidalz13/battleship-backend/models/tournament"
 )
 
 type RespJoinGame struct {
 	GameUuid       string `json:"game_uuid"`
 	PlayerUuid     string `json:"player_uuid"`
-	GameDifficulty uint8    `json:"game_difficulty"`
+	GameDifficulty uint8  `json:"game_difficulty"`
+	BestOf         uint8  `json:"best_of"`
+	FirstTurn      string `json:"first_turn"`
+	SpecialWeapons bool   `json:"special_weapons"`
+	Disclosure     string `json:"disclosure"`
+	ResumeToken    string `json:"resume_token,omitempty"`
 }
 
 type RespCreateGame struct {
-	GameUuid string `json:"game_uuid"`
-	HostUuid string `json:"host_uuid"`
+	GameUuid       string `json:"game_uuid"`
+	HostUuid       string `json:"host_uuid"`
+	BestOf         uint8  `json:"best_of"`
+	FirstTurn      string `json:"first_turn"`
+	SpecialWeapons bool   `json:"special_weapons"`
+	Disclosure     string `json:"disclosure"`
+	ResumeToken    string `json:"resume_token,omitempty"`
 }
 
+// What is disclosed besides the position state depends on the
+// battleship.Ruleset of the game. The sunken ship counts stay 0
+// if sinking is hidden.
 type RespAttack struct {
-	X                         uint8              `json:"x"`
-	Y                         uint8              `json:"y"`
-	PositionState             uint8              `json:"position_state"`
+	X                         uint8            `json:"x"`
+	Y                         uint8            `json:"y"`
+	PositionState             uint8            `json:"position_state"`
 	IsTurn                    bool             `json:"is_turn"`
-	SunkenShipsHost           uint8              `json:"sunken_ships_host"`
-	SunkenShipsJoin           uint8              `json:"sunken_ships_join"`
+	SunkenShipsHost           uint8            `json:"sunken_ships_host"`
+	SunkenShipsJoin           uint8            `json:"sunken_ships_join"`
 	DefenderSunkenShipsCoords []mb.Coordinates `json:"defender_sunken_ships_coords,omitempty"`
+
+	// The ship that was hit, only for call-outs
+	ShipCode uint8 `json:"ship_code,omitempty"`
+}
+
+// The defence grid the server accepted, in the canonical
+// form no matter how the ships were sent
+type RespReady struct {
+	DefenceGrid mb.Grid `json:"defence_grid"`
+}
+
+// Sent to both players so that they agree on who starts
+type RespStartGame struct {
+	FirstTurn   string `json:"first_turn"`
+	StarterUuid string `json:"starter_uuid"`
+	HostStarts  bool   `json:"host_starts"`
+
+	// What each player has; only with special weapons
+	Inventory *mb.Inventory `json:"inventory,omitempty"`
+}
+
+type RespAttackCell struct {
+	X             uint8 `json:"x"`
+	Y             uint8 `json:"y"`
+	PositionState uint8 `json:"position_state"`
+	ShipCode      uint8 `json:"ship_code,omitempty"`
+}
+
+// A bomb or torpedo. Cells that were attacked before are
+// left out; after the winning hit the rest are too.
+type RespSpecialAttack struct {
+	Cells                     []RespAttackCell `json:"cells"`
+	IsTurn                    bool             `json:"is_turn"`
+	SunkenShipsHost           uint8            `json:"sunken_ships_host"`
+	SunkenShipsJoin           uint8            `json:"sunken_ships_join"`
+	DefenderSunkenShipsCoords []mb.Coordinates `json:"defender_sunken_ships_coords,omitempty"`
+
+	// What the attacker has left
+	Inventory mb.Inventory `json:"inventory"`
+}
+
+type RespSonar struct {
+	X            uint8        `json:"x"`
+	Y            uint8        `json:"y"`
+	ShipDetected bool         `json:"ship_detected"`
+	IsTurn       bool         `json:"is_turn"`
+	Inventory    mb.Inventory `json:"inventory"`
 }
 
 type RespSessionId struct {
@@ -30,21 +92,128 @@ type RespSessionId struct {
 }
 
 type RespEndGame struct {
-	PlayerMatchStatus uint8 `json:"player_match_status"`
+	PlayerMatchStatus uint8       `json:"player_match_status"`
+	Series            *RespSeries `json:"series,omitempty"`
+}
+
+// The running score of a best-of series
+type RespSeries struct {
+	BestOf   uint8 `json:"best_of"`
+	Game     uint8 `json:"game"`
+	HostWins uint8 `json:"host_wins"`
+	JoinWins uint8 `json:"join_wins"`
+
+	// Someone clinched it; there is no rematch
+	IsOver bool `json:"is_over"`
+}
+
+// nil for a single game
+func NewRespSeries(series mb.Series) *RespSeries {
+	if series.IsSingleGame() {
+		return nil
+	}
+	return &RespSeries{
+		BestOf:   series.BestOf,
+		Game:     series.Game,
+		HostWins: series.HostWins,
+		JoinWins: series.JoinWins,
+		IsOver:   series.IsOver(),
+	}
 }
 
 type RespErr struct {
-	ErrorDetails string `json:"error_details,omitempty"`
-	Message      string `json:"message,omitempty"`
+	// Stable code from the catalogue in internal/error;
+	// clients should switch on this instead of the texts
+	Code         cerr.ErrCode `json:"code"`
+	Fields       *cerr.Fields `json:"fields,omitempty"`
+	ErrorDetails string       `json:"error_details,omitempty"`
+	Message      string       `json:"message,omitempty"`
 }
 
 type RespRematch struct {
-	IsTurn bool `json:"is_turn"`
+	IsTurn bool        `json:"is_turn"`
+	Series *RespSeries `json:"series,omitempty"`
 }
 
-func NewRespErr(errorDetails, message string) *RespErr {
+type RespServerShuttingDown struct {
+	// Games in progress may be played until then
+	DrainSeconds uint16 `json:"drain_seconds"`
+
+	// When to reconnect after the conn is closed
+	RetryAfterSeconds uint16 `json:"retry_after_seconds"`
+}
+
+type RespSessionResumed struct {
+	// Pass this as the `resumeToken` query param to reconnect
+	ResumeToken string `json:"resume_token"`
+
+	// Unix seconds
+	ExpiresAt int64 `json:"expires_at"`
+
+	// Seq of the latest pushed event; replay from the last
+	// seq the client got if it is behind
+	LastSeq uint64 `json:"last_seq"`
+}
+
+type RespSessionExpired struct {
+	// "idle" or "max_lifetime"
+	Reason string `json:"reason"`
+}
+
+// Payload of both CodeSessionKicked and CodeGameTerminated
+type RespAdminAction struct {
+	Reason string `json:"reason"`
+}
+
+type RespReplayEvents struct {
+	Replayed uint16 `json:"replayed"`
+	LastSeq  uint64 `json:"last_seq"`
+}
+
+// The text after the profanity filter
+type RespChat struct {
+	Text string `json:"text"`
+}
+
+// The key is what clients localise, see Emotes
+type RespEmote struct {
+	EmoteId uint8  `json:"emote_id"`
+	Key     string `json:"key"`
+}
+
+type RespMuteOpponent struct {
+	Muted bool `json:"muted"`
+}
+
+type RespJoinTournamentMatch struct {
+	TournamentUuid string `json:"tournament_uuid"`
+	MatchId        int    `json:"match_id"`
+	Round          int    `json:"round"`
+	Seed           int    `json:"seed"`
+	GameUuid       string `json:"game_uuid"`
+	PlayerUuid     string `json:"player_uuid"`
+	GameDifficulty uint8  `json:"game_difficulty"`
+	IsHost         bool   `json:"is_host"`
+	ResumeToken    string `json:"resume_token,omitempty"`
+}
+
+// Winner and champion are seeds; 0 if there is none
+type RespTournamentMatchResult struct {
+	TournamentUuid string `json:"tournament_uuid"`
+	MatchId        int    `json:"match_id"`
+	Winner         int    `json:"winner,omitempty"`
+	DecidedBy      string `json:"decided_by"`
+	Champion       int    `json:"champion,omitempty"`
+}
+
+// Same as over HTTP
+type RespTournamentStandings = mt.Standings
+
+func NewRespErr(err error, message string) *RespErr {
 	return &RespErr{
-		ErrorDetails: errorDetails,
+		Code:         cerr.CodeOf(err),
+		Fields:       cerr.FieldsOf(err),
+		ErrorDetails: err.Error(),
 		Message:      message,
 	}
 }
@@ -1,79 +1,341 @@
 package connection
 
 import (
-	"log"
+	"log/slog"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
-)
 
-const (
-	maxWriteWsRetries uint8         = 2
-	backOffFactor     uint8         = 2
-	gracePeriod       time.Duration = time.Minute * 2
+	"github.com/saeidalz13/battleship-backend/internal/clock"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
 )
 
+// How long closing a conn may block on a slow client
+const closeWriteTimeout time.Duration = time.Second
+
+type SessionConfig struct {
+	// How long a dropped player has to reconnect
+	GracePeriod time.Duration
+
+	// Retries of a failed read or write; the n-th retry
+	// waits n times RetryBackoff
+	MaxRetries   uint8
+	RetryBackoff time.Duration
+
+	// Number of pushed events kept per session so that
+	// they can be replayed to a reconnecting client
+	EventLogSize int
+}
+
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		GracePeriod:  time.Minute * 2,
+		MaxRetries:   2,
+		RetryBackoff: time.Second * 2,
+		EventLogSize: 64,
+	}
+}
+
+// MessageTypeJSON is any Message[T]; it is encoded with the
+// codec of the session which is JSON unless the client has
+// negotiated another one. MessageTypeBytes is written as is.
 const (
 	MessageTypeBytes uint8 = iota
 	MessageTypeJSON
 )
 
 type ConnectionHandler interface {
-	reconnectionAfterAbnormalClosure(conn *websocket.Conn)
+	resume(conn *websocket.Conn)
 	handleReadFromConnErr(err error, retries uint8) uint8
 	writeToConnWithRetry(msg interface{}, msgType uint8) error
 	onConnErr(err error) uint8
 }
 
+// What a session needs of its conn. Satisfied by
+// *websocket.Conn and by the conns of sessions relayed
+// from another node (see busConn).
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+	RemoteAddr() net.Addr
+	Subprotocol() string
+}
+
+var _ Conn = (*websocket.Conn)(nil)
+
+// A reconnecting conn on its way to the loop of the session
+type handoff struct {
+	conn *websocket.Conn
+
+	// The loop replies once it reads from the new conn
+	result chan error
+}
+
 type Session struct {
-	id                     string
-	conn                   *websocket.Conn
-	reconnectionSignalChan chan bool
-	createdAt              time.Time
+	id        string
+	conn      Conn
+	codec     Codec
+	clock     clock.Clock
+	cfg       SessionConfig
+	createdAt time.Time
+
+	// Unix nanoseconds of the last message from the client
+	lastActivity atomic.Int64
+
+	// Carries the hashed ID, the remote address and, once
+	// bound, the game and player of the session
+	logger atomic.Pointer[slog.Logger]
+
+	// Holds at most one reconnecting conn until the session
+	// loop picks it up. `done` is closed once the loop ends.
+	handoffChan chan handoff
+	done        chan struct{}
+	doneOnce    sync.Once
+
+	// gorilla/websocket allows only one concurrent writer and
+	// both players' loops can write to the same conn. It also
+	// guards swapping the conn on resume.
+	writeMu sync.Mutex
+
+	eventsMu sync.Mutex
+	lastSeq  uint64
+	events   []interface{}
+
+	// Game and player the session is bound to and the nonce
+	// of the only resume token that is accepted
+	bindingMu   sync.Mutex
+	gameUuid    string
+	playerUuid  string
+	resumeNonce string
 }
 
-func NewSession(id string, conn *websocket.Conn) *Session {
-	return &Session{
-		id:                     id,
-		conn:                   conn,
-		reconnectionSignalChan: make(chan bool),
-		createdAt:              time.Now(),
+func NewSession(id string, conn Conn, clk clock.Clock, cfg SessionConfig) *Session {
+	s := &Session{
+		id:          id,
+		conn:        conn,
+		codec:       CodecForSubprotocol(conn.Subprotocol()),
+		clock:       clk,
+		cfg:         cfg,
+		createdAt:   clk.Now(),
+		handoffChan: make(chan handoff, 1),
+		done:        make(chan struct{}),
 	}
+	s.lastActivity.Store(s.createdAt.UnixNano())
+	s.refreshLogger(conn.RemoteAddr().String())
+	return s
 }
 
 func (s *Session) Id() string {
 	return s.id
 }
 
-func (s *Session) Conn() *websocket.Conn {
+func (s *Session) Conn() Conn {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
 	return s.conn
 }
 
+// The client is connected to another node that relays its
+// frames, see BattleshipSessionManager.RelaySession
+func (s *Session) IsRemote() bool {
+	_, ok := s.Conn().(*busConn)
+	return ok
+}
+
+func (s *Session) Codec() Codec {
+	return s.codec
+}
+
+func (s *Session) Logger() *slog.Logger {
+	return s.logger.Load()
+}
+
+func (s *Session) refreshLogger(remoteAddr string) {
+	s.bindingMu.Lock()
+	gameUuid, playerUuid := s.gameUuid, s.playerUuid
+	s.bindingMu.Unlock()
+
+	attrs := []any{logging.KeySession, logging.HashId(s.id), logging.KeyRemoteAddr, remoteAddr}
+	if gameUuid != "" {
+		attrs = append(attrs, logging.KeyGame, gameUuid, logging.KeyPlayer, playerUuid)
+	}
+	s.logger.Store(slog.Default().With(attrs...))
+}
+
+// Assigns the next sequence number to a pushed event and
+// keeps it in the event log for replay. Anything that is
+// not a Message[T] is returned untouched.
+func (s *Session) stampEvent(msg interface{}) interface{} {
+	seqMsg, ok := msg.(sequenced)
+	if !ok {
+		return msg
+	}
+
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+
+	s.lastSeq++
+	stamped := seqMsg.withSeq(s.lastSeq)
+
+	s.events = append(s.events, stamped)
+	if len(s.events) > s.cfg.EventLogSize {
+		s.events = s.events[len(s.events)-s.cfg.EventLogSize:]
+	}
+	return stamped
+}
+
+// Returns the pushed events with a seq greater than `lastSeq`
+// along with the latest seq of this session. `ok` is false if
+// some of those events are already dropped from the log.
+func (s *Session) EventsSince(lastSeq uint64) (events []interface{}, latestSeq uint64, ok bool) {
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+
+	if lastSeq >= s.lastSeq {
+		return nil, s.lastSeq, true
+	}
+
+	oldestSeq := s.lastSeq - uint64(len(s.events)) + 1
+	if lastSeq+1 < oldestSeq {
+		return nil, s.lastSeq, false
+	}
+
+	missed := s.events[lastSeq+1-oldestSeq:]
+	events = make([]interface{}, len(missed))
+	copy(events, missed)
+	return events, s.lastSeq, true
+}
+
+// What the admin API shows of a session. The ID is hashed
+// like in the logs; the durations are measured on the clock
+// of the session.
+type SessionInfo struct {
+	Id         string
+	RemoteAddr string
+	Age        time.Duration
+	Idle       time.Duration
+	GameUuid   string
+	PlayerUuid string
+}
+
+func (s *Session) Info() SessionInfo {
+	s.bindingMu.Lock()
+	gameUuid, playerUuid := s.gameUuid, s.playerUuid
+	s.bindingMu.Unlock()
+
+	now := s.clock.Now()
+	return SessionInfo{
+		Id:         logging.HashId(s.id),
+		RemoteAddr: s.Conn().RemoteAddr().String(),
+		Age:        now.Sub(s.createdAt),
+		Idle:       now.Sub(time.Unix(0, s.lastActivity.Load())),
+		GameUuid:   gameUuid,
+		PlayerUuid: playerUuid,
+	}
+}
+
+func (s *Session) GameUuid() string {
+	s.bindingMu.Lock()
+	defer s.bindingMu.Unlock()
+
+	return s.gameUuid
+}
+
+func (s *Session) touch() {
+	s.lastActivity.Store(s.clock.Now().UnixNano())
+}
+
+// Returns why the session has expired at `now`, if it has
+func (s *Session) expiryReason(now time.Time, cfg ExpiryConfig) (string, bool) {
+	if cfg.MaxLifetime > 0 && now.Sub(s.createdAt) > cfg.MaxLifetime {
+		return ExpiryReasonMaxLifetime, true
+	}
+	if cfg.IdleTimeout > 0 && now.Sub(time.Unix(0, s.lastActivity.Load())) > cfg.IdleTimeout {
+		return ExpiryReasonIdle, true
+	}
+	return "", false
+}
+
+func (s *Session) latestSeq() uint64 {
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+
+	return s.lastSeq
+}
+
+// Only sessions bound to a player can be resumed
+func (s *Session) isResumable() bool {
+	s.bindingMu.Lock()
+	defer s.bindingMu.Unlock()
+
+	return s.playerUuid != ""
+}
+
+func (s *Session) bind(gameUuid, playerUuid string) {
+	s.bindingMu.Lock()
+	s.gameUuid = gameUuid
+	s.playerUuid = playerUuid
+	s.bindingMu.Unlock()
+
+	s.refreshLogger(s.Conn().RemoteAddr().String())
+}
+
+func (s *Session) setResumeNonce(nonce string) {
+	s.bindingMu.Lock()
+	defer s.bindingMu.Unlock()
+
+	s.resumeNonce = nonce
+}
+
+// Checks the claims of a resume token against the session
+// and uses up the nonce so that the token cannot be replayed
+func (s *Session) consumeResumeNonce(playerUuid, nonce string) error {
+	s.bindingMu.Lock()
+	defer s.bindingMu.Unlock()
+
+	if s.playerUuid == "" || s.playerUuid != playerUuid {
+		return cerr.ErrResumeTokenInvalid()
+	}
+	if s.resumeNonce == "" || s.resumeNonce != nonce {
+		return cerr.ErrResumeTokenReplayed()
+	}
+
+	s.resumeNonce = ""
+	return nil
+}
+
 func (s *Session) onConnErr(err error) uint8 {
 	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-		log.Println("timeout error:", err)
+		s.Logger().Warn("timeout error", logging.KeyError, err)
 		return ConnLoopRetry
 	}
 
 	if websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
-		log.Println("high server load/traffic error:", err)
+		s.Logger().Warn("high server load/traffic error", logging.KeyError, err)
 		return ConnLoopRetry
 	}
 
 	// Happens if the IOS client goes to background
 	if websocket.IsCloseError(err, websocket.CloseAbnormalClosure) {
-		log.Println("abnormal closure error:", err)
+		s.Logger().Info("abnormal closure error", logging.KeyError, err)
 		return ConnLoopAbnormalClosureRetry
 	}
 
 	if websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
-		log.Println("close error:", err)
+		s.Logger().Info("close error", logging.KeyError, err)
 		return ConnLoopBreak
 	}
 
 	if websocket.IsCloseError(err, websocket.CloseProtocolError, websocket.CloseInternalServerErr, websocket.CloseTLSHandshake, websocket.CloseMandatoryExtension) {
-		log.Println("critical error:", err)
+		s.Logger().Error("critical error", logging.KeyError, err)
 		return ConnLoopBreak
 	}
 
@@ -91,14 +353,70 @@ func (s *Session) onConnErr(err error) uint8 {
 		- Server closes the connection with CloseInvalidFramePayloadData because the payload data is invalid.
 	*/
 	if websocket.IsCloseError(err, websocket.CloseInvalidFramePayloadData, websocket.CloseUnsupportedData, websocket.CloseMessageTooBig, websocket.ClosePolicyViolation, websocket.CloseServiceRestart, websocket.CloseNoStatusReceived) {
-		log.Println("non-critical error:", err)
+		s.Logger().Info("non-critical error", logging.KeyError, err)
 		return ConnLoopBreak
 	}
 
-	log.Println("unexpected error:", err)
+	s.Logger().Warn("unexpected error", logging.KeyError, err)
 	return ConnLoopBreak
 }
 
+// A single write attempt. The lock keeps concurrent
+// writers from interleaving frames on the same conn.
+func (s *Session) writeToConn(msg interface{}, msgType uint8) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	switch msgType {
+	case MessageTypeJSON:
+		respBytes, err := s.codec.Marshal(msg)
+		if err != nil {
+			return NewConnErr(ConnInvalidMsgType).AddDesc("failed to encode msg: " + err.Error())
+		}
+		return s.conn.WriteMessage(s.codec.FrameType(), respBytes)
+
+	case MessageTypeBytes:
+		respBytes, ok := msg.([]byte)
+		if !ok {
+			return NewConnErr(ConnInvalidMsgType).AddDesc("msg type expected: []byte got invalid")
+		}
+		return s.conn.WriteMessage(s.codec.FrameType(), respBytes)
+
+	default:
+		return NewConnErr(ConnInvalidMsgType).AddDesc("invalid meessage type to write with retry")
+	}
+}
+
+// Sends `msg` (if not nil) and a close frame with the given
+// code and reason, then closes the conn. Reading from the
+// conn fails afterwards which ends the session loop.
+func (s *Session) CloseWithMessage(msg interface{}, closeCode int, reason string) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	closeConn(s.conn, s.codec, msg, closeCode, reason)
+}
+
+// Same as Session.CloseWithMessage for conns that do not
+// belong to a session (yet)
+func CloseConn(conn *websocket.Conn, msg interface{}, closeCode int, reason string) {
+	closeConn(conn, CodecForSubprotocol(conn.Subprotocol()), msg, closeCode, reason)
+}
+
+// Deadlines are enforced by the network stack, so they are
+// always based on the real time and not the session clock
+func closeConn(conn Conn, codec Codec, msg interface{}, closeCode int, reason string) {
+	if msg != nil {
+		if respBytes, err := codec.Marshal(msg); err == nil {
+			_ = conn.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+			_ = conn.WriteMessage(codec.FrameType(), respBytes)
+		}
+	}
+
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason), time.Now().Add(closeWriteTimeout))
+	_ = conn.Close()
+}
+
 // Writes to the connection of that session. It also
 // handles the abnormal or other types of errors of
 // writing to a websocket connection.
@@ -107,35 +425,22 @@ func (s *Session) writeToConnWithRetry(msg interface{}, msgType uint8) error {
 
 writeJsonLoop:
 	for {
-		var err error
-
-		switch msgType {
-		case MessageTypeJSON:
-			err = s.conn.WriteJSON(msg)
-
-		case MessageTypeBytes:
-			respBytes, ok := msg.([]byte)
-			if ok {
-				err = s.conn.WriteMessage(websocket.TextMessage, respBytes)
-			} else {
-				return NewConnErr(ConnInvalidMsgType).AddDesc("msg type expected: []byte got invalid")
-			}
-
-		default:
-			return NewConnErr(ConnInvalidMsgType).AddDesc("invalid meessage type to write with retry")
+		err := s.writeToConn(msg, msgType)
+		if connErr, ok := err.(ConnErr); ok {
+			return connErr
 		}
 
 		if err != nil {
 			switch s.onConnErr(err) {
 			case ConnLoopRetry:
-				if retries < maxWriteWsRetries {
+				if retries < s.cfg.MaxRetries {
 					retries++
-					log.Printf("writing json failed to ws [%s]; retrying... (retry no. %d)\n", s.conn.RemoteAddr().String(), retries)
-					time.Sleep(time.Duration(retries*backOffFactor) * time.Second)
+					s.Logger().Warn("writing to ws conn failed; retrying...", "retry", retries)
+					s.clock.Sleep(time.Duration(retries) * s.cfg.RetryBackoff)
 					continue writeJsonLoop
 
 				} else {
-					log.Printf("max retries reached for writing to ws [%s]:%s", s.conn.RemoteAddr().String(), err)
+					s.Logger().Warn("max retries reached for writing to ws conn", logging.KeyError, err)
 					return NewConnErr(ConnLoopBreak)
 				}
 
@@ -159,9 +464,9 @@ func (s *Session) handleReadFromConnErr(err error, retries uint8) uint8 {
 		return ConnLoopAbnormalClosureRetry
 
 	case ConnLoopRetry:
-		if retries < maxWriteWsRetries {
-			log.Printf("failed to read from ws conn [%s]; retrying... (retry no. %d)\n", s.conn.RemoteAddr().String(), retries)
-			time.Sleep(time.Duration(retries*backOffFactor) * time.Second)
+		if retries < s.cfg.MaxRetries {
+			s.Logger().Warn("failed to read from ws conn; retrying...", "retry", retries)
+			s.clock.Sleep(time.Duration(retries) * s.cfg.RetryBackoff)
 			return ConnLoopContinue
 
 		} else {
@@ -169,7 +474,7 @@ func (s *Session) handleReadFromConnErr(err error, retries uint8) uint8 {
 		}
 
 	case ConnLoopBreak:
-		log.Printf("break ws conn loop [%s] due to: %s\n", s.conn.RemoteAddr().String(), err)
+		s.Logger().Info("break ws conn loop", logging.KeyError, err)
 		return ConnLoopBreak
 
 		// will never reach this
@@ -178,13 +483,49 @@ func (s *Session) handleReadFromConnErr(err error, retries uint8) uint8 {
 	}
 }
 
-func (s *Session) reconnectionAfterAbnormalClosure(conn *websocket.Conn) {
-	// Signal for reconnection
-	close(s.reconnectionSignalChan)
-
-	// Setting the new fields for the session
+// Called by the session loop once it picks up a handoff.
+// The client may have negotiated a different codec this time.
+func (s *Session) resume(conn *websocket.Conn) {
+	s.writeMu.Lock()
 	s.conn = conn
-	s.reconnectionSignalChan = make(chan bool)
+	s.codec = CodecForSubprotocol(conn.Subprotocol())
+	s.writeMu.Unlock()
+
+	s.refreshLogger(conn.RemoteAddr().String())
+}
+
+// Passes the conn to the session loop and waits until the
+// loop reads from it or the session ends
+func (s *Session) handOff(conn *websocket.Conn) error {
+	h := handoff{conn: conn, result: make(chan error, 1)}
+	oldConn := s.Conn()
+
+	select {
+	case s.handoffChan <- h:
+	case <-s.done:
+		return cerr.ErrSessionNotFound(s.id)
+	}
+
+	// The old conn may still look alive to the server, e.g.
+	// if the client lost its network. Closing it makes the
+	// loop's blocked read fail so that it sees the handoff.
+	oldConn.Close()
+
+	select {
+	case err := <-h.result:
+		return err
+	case <-s.done:
+		return cerr.ErrSessionNotFound(s.id)
+	}
+}
+
+func (s *Session) hasPendingHandoff() bool {
+	return len(s.handoffChan) > 0
+}
+
+// Marks the end of the session loop; safe to call more than once
+func (s *Session) terminate() {
+	s.doneOnce.Do(func() { close(s.done) })
 }
 
 var _ ConnectionHandler = (*Session)(nil)
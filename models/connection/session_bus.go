@@ -0,0 +1,185 @@
+package connection
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+)
+
+var ErrNoMessageBus = errors.New("no message bus is configured")
+
+// A session whose client is connected to this node while its
+// game runs on another one
+type relay struct {
+	session   *Session
+	fromOwner chan BusMessage
+}
+
+// Applies to the sessions generated afterwards. Without a
+// bus every session of a game must be on the same node.
+func (bsm *BattleshipSessionManager) WithMessageBus(bus MessageBus, nodeId string) *BattleshipSessionManager {
+	bsm.bus = bus
+	bsm.nodeId = nodeId
+	return bsm
+}
+
+// Takes the msgs the other nodes sent to this one, except
+// BusKindOpen which needs a session loop, see OpenRemoteSession
+func (bsm *BattleshipSessionManager) HandleBusMessage(msg BusMessage) {
+	switch msg.Kind {
+	case BusKindEvent:
+		bsm.deliverEvent(msg)
+
+	case BusKindFrame, BusKindClose:
+		bsm.mu.RLock()
+		conn, isRemote := bsm.remoteConns[msg.SessionId]
+		r, isRelay := bsm.relays[msg.SessionId]
+		bsm.mu.RUnlock()
+
+		switch {
+		case isRemote:
+			conn.deliver(msg)
+		case isRelay:
+			select {
+			case r.fromOwner <- msg:
+			case <-r.session.done:
+			}
+		}
+	}
+}
+
+// Generates the session of a client that another node
+// relays to this one. It keeps the ID the relay gave it.
+func (bsm *BattleshipSessionManager) OpenRemoteSession(open BusMessage) *Session {
+	conn := newBusConn(bsm.bus, bsm.nodeId, open)
+	session := NewSession(open.SessionId, conn, bsm.clock, bsm.session)
+
+	bsm.mu.Lock()
+	bsm.sessions[session.id] = session
+	bsm.remoteConns[session.id] = conn
+	bsm.mu.Unlock()
+	sessionsActive.Inc()
+
+	session.Logger().Info("relayed session opened", "relay_node", open.FromNodeId)
+	return session
+}
+
+// Hands the client of the session over to the node that owns
+// its game, starting with the payload the session loop has
+// already read. From then on this node only passes frames
+// back and forth. Returns once either side is gone.
+func (bsm *BattleshipSessionManager) RelaySession(session *Session, ownerNodeId string, firstPayload []byte) error {
+	if bsm.bus == nil {
+		return ErrNoMessageBus
+	}
+
+	r := relay{session: session, fromOwner: make(chan BusMessage, busConnBuffer)}
+	bsm.mu.Lock()
+	bsm.relays[session.id] = r
+	bsm.mu.Unlock()
+	defer func() {
+		bsm.mu.Lock()
+		delete(bsm.relays, session.id)
+		bsm.mu.Unlock()
+	}()
+
+	publish := func(msg BusMessage) error {
+		msg.NodeId = ownerNodeId
+		msg.FromNodeId = bsm.nodeId
+		msg.SessionId = session.id
+
+		ctx, cancel := context.WithTimeout(context.Background(), busPublishTimeout)
+		defer cancel()
+		return bsm.bus.Publish(ctx, msg)
+	}
+
+	open := BusMessage{Kind: BusKindOpen, Subprotocol: session.Codec().Subprotocol(), RemoteAddr: session.Conn().RemoteAddr().String()}
+	if err := publish(open); err != nil {
+		return err
+	}
+	if err := publish(BusMessage{Kind: BusKindFrame, Payload: firstPayload}); err != nil {
+		return err
+	}
+	session.Logger().Info("session relayed", "owner_node", ownerNodeId)
+
+	// The session loop is blocked here, so this is the only reader
+	clientGone := make(chan struct{})
+	go func() {
+		defer close(clientGone)
+		for {
+			_, payload, err := session.Conn().ReadMessage()
+			if err != nil {
+				closeCode := websocket.CloseAbnormalClosure
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) {
+					closeCode = closeErr.Code
+				}
+				_ = publish(BusMessage{Kind: BusKindClose, CloseCode: closeCode})
+				return
+			}
+			session.touch()
+
+			if err := publish(BusMessage{Kind: BusKindFrame, Payload: payload}); err != nil {
+				session.Logger().Warn("failed to relay a frame", logging.KeyError, err)
+				_ = session.Conn().Close()
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-clientGone:
+			return nil
+
+		case msg := <-r.fromOwner:
+			if msg.Kind == BusKindClose {
+				session.CloseWithMessage(nil, msg.CloseCode, msg.CloseReason)
+				<-clientGone
+				return nil
+			}
+
+			// Already encoded with the codec of the client
+			if err := session.writeToConnWithRetry(msg.Payload, MessageTypeBytes); err != nil {
+				session.Logger().Warn("failed to write a relayed frame", logging.KeyError, err)
+				_ = session.Conn().Close()
+			}
+		}
+	}
+}
+
+// Sends the msg to every node; the one with the session
+// writes it. The msg is lost if no node has it.
+func (bsm *BattleshipSessionManager) publishEvent(receiverSessionId string, msg interface{}) error {
+	payload, err := MsgpackCodec{}.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), busPublishTimeout)
+	defer cancel()
+	return bsm.bus.Publish(ctx, BusMessage{Kind: BusKindEvent, FromNodeId: bsm.nodeId, SessionId: receiverSessionId, Payload: payload})
+}
+
+// Relayed sessions are skipped; their events come from the
+// loop on the owner, which keeps the log to replay them from
+func (bsm *BattleshipSessionManager) deliverEvent(msg BusMessage) {
+	bsm.mu.RLock()
+	session, prs := bsm.sessions[msg.SessionId]
+	_, isRelay := bsm.relays[msg.SessionId]
+	bsm.mu.RUnlock()
+	if !prs || isRelay {
+		return
+	}
+
+	var event Message[any]
+	if err := (MsgpackCodec{}).Unmarshal(msg.Payload, &event); err != nil {
+		session.Logger().Warn("invalid event from the bus", "from_node", msg.FromNodeId, logging.KeyError, err)
+		return
+	}
+	if err := session.writeToConnWithRetry(session.stampEvent(event), MessageTypeJSON); err != nil {
+		session.Logger().Info("failed to deliver event", "from_node", msg.FromNodeId, logging.KeyError, err)
+	}
+}
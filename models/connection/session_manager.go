@@ -1,51 +1,114 @@
 package connection
 
 import (
+	"context"
 	"encoding/base64"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 
+	"github.com/saeidalz13/battleship-backend/internal/clock"
 	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+	"github.com/saeidalz13/battleship-backend/internal/token"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
 )
 
+// Long enough to outlive any session; rotating on every
+// reconnect is what keeps a leaked token from being useful
+const DefaultResumeTokenTTL time.Duration = time.Hour
+
 type SessionManager interface {
 	GenerateNewSession(conn *websocket.Conn) *Session
-	CleanupPeriodically()
+	CleanupPeriodically(ctx context.Context, gameManager mb.GameManager)
 	FindSession(sessionId string) (*Session, error)
+	SessionCount() int
+	Broadcast(msg interface{}, msgType uint8)
+	CloseAllSessions(closeCode int, reason string)
 
 	TerminateSession(sessionId string)
-	ReconnectSession(sessionId string, conn *websocket.Conn)
+	ListSessions() []SessionInfo
+	KickSession(hashedSessionId, reason string, gameManager mb.GameManager) error
+	EndGame(gameUuid, reason string, gameManager mb.GameManager) error
+	BindPlayer(session *Session, gameUuid, playerUuid string) (string, int64)
+	ReconnectSession(resumeToken string, conn *websocket.Conn, gameManager mb.GameManager) *Session
 	Communicate(senderSessionId, receiverSessionId string, msg interface{}, msgType uint8) error
 
+	HandleBusMessage(msg BusMessage)
+	OpenRemoteSession(open BusMessage) *Session
+	RelaySession(session *Session, ownerNodeId string, firstPayload []byte) error
+
 	HandleAbnormalClosureSession(session *Session, otherSessionId string) error
 	WriteToSessionConn(session *Session, msg interface{}, msgType uint8, otherSessonId string) error
 	ReadFromSessionConn(session *Session, otherSessionId string) (int, []byte, error)
 }
 
 type BattleshipSessionManager struct {
-	cleanupInterval time.Duration
-	sessions        map[string]*Session
-	mu              sync.RWMutex
+	session      SessionConfig
+	expiry       ExpiryConfig
+	clock        clock.Clock
+	sessions     map[string]*Session
+	mu           sync.RWMutex
+	resumeTokens *token.Signer
+
+	// nil if this is the only node, see WithMessageBus
+	bus         MessageBus
+	nodeId      string
+	remoteConns map[string]*busConn
+	relays      map[string]relay
 }
 
 func NewBattleshipSessionManager() *BattleshipSessionManager {
 	initMapSize := 10
 
 	return &BattleshipSessionManager{
-		sessions:        make(map[string]*Session, initMapSize),
-		cleanupInterval: time.Minute * 20,
+		sessions:     make(map[string]*Session, initMapSize),
+		remoteConns:  make(map[string]*busConn),
+		relays:       make(map[string]relay),
+		session:      DefaultSessionConfig(),
+		expiry:       DefaultExpiryConfig(),
+		clock:        clock.Real(),
+		resumeTokens: token.NewRandomSigner(DefaultResumeTokenTTL),
 	}
 }
 
+// Applies to the sessions generated afterwards
+func (bsm *BattleshipSessionManager) WithSessionConfig(cfg SessionConfig) *BattleshipSessionManager {
+	bsm.session = cfg
+	return bsm
+}
+
+func (bsm *BattleshipSessionManager) WithExpiryConfig(cfg ExpiryConfig) *BattleshipSessionManager {
+	bsm.expiry = cfg
+	return bsm
+}
+
+// Must be set before any session is generated
+func (bsm *BattleshipSessionManager) WithClock(clk clock.Clock) *BattleshipSessionManager {
+	bsm.clock = clk
+	return bsm
+}
+
+// By default tokens are signed with a random secret that
+// is generated on startup
+func (bsm *BattleshipSessionManager) WithResumeTokenSigner(signer *token.Signer) *BattleshipSessionManager {
+	bsm.resumeTokens = signer
+	return bsm
+}
+
 func (bsm *BattleshipSessionManager) GenerateNewSession(conn *websocket.Conn) *Session {
 	sessionId := base64.RawURLEncoding.EncodeToString([]byte(uuid.New().String()))
-	bsm.sessions[sessionId] = NewSession(sessionId, conn)
+	session := NewSession(sessionId, conn, bsm.clock, bsm.session)
+
+	bsm.mu.Lock()
+	bsm.sessions[sessionId] = session
+	bsm.mu.Unlock()
+	sessionsActive.Inc()
 
-	return bsm.sessions[sessionId]
+	return session
 }
 
 func (bsm *BattleshipSessionManager) FindSession(sessionId string) (*Session, error) {
@@ -65,93 +128,405 @@ func (bsm *BattleshipSessionManager) FindSession(sessionId string) (*Session, er
 }
 
 func (bsm *BattleshipSessionManager) TerminateSession(sessionId string) {
+	bsm.mu.Lock()
+	defer bsm.mu.Unlock()
+
+	session, prs := bsm.sessions[sessionId]
+	if !prs {
+		return
+	}
+	if session != nil {
+		session.terminate()
+	}
 	delete(bsm.sessions, sessionId)
+	delete(bsm.remoteConns, sessionId)
+	sessionsActive.Dec()
+}
+
+func (bsm *BattleshipSessionManager) SessionCount() int {
+	bsm.mu.RLock()
+	defer bsm.mu.RUnlock()
+
+	return len(bsm.sessions)
+}
+
+// Copy of the current sessions so that callers can write
+// to them without holding the lock
+func (bsm *BattleshipSessionManager) sessionsSnapshot() []*Session {
+	bsm.mu.RLock()
+	defer bsm.mu.RUnlock()
+
+	sessions := make([]*Session, 0, len(bsm.sessions))
+	for _, session := range bsm.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// Pushes the msg to every session. Failures are only logged;
+// a broken session is taken care of by its own loop.
+func (bsm *BattleshipSessionManager) Broadcast(msg interface{}, msgType uint8) {
+	for _, session := range bsm.sessionsSnapshot() {
+		if err := session.writeToConnWithRetry(session.stampEvent(msg), msgType); err != nil {
+			session.Logger().Warn("broadcast failed", logging.KeyError, err)
+		}
+	}
 }
 
-func (bsm *BattleshipSessionManager) ReconnectSession(sessionId string, conn *websocket.Conn) {
-	session, err := bsm.FindSession(sessionId)
+// Closes the conn of every session with the close code. The
+// session loops then end and clean up after themselves.
+func (bsm *BattleshipSessionManager) CloseAllSessions(closeCode int, reason string) {
+	for _, session := range bsm.sessionsSnapshot() {
+		session.CloseWithMessage(nil, closeCode, reason)
+	}
+}
+
+// Binds the session to the game and player it plays as and
+// returns a resume token for it, see issueResumeToken
+func (bsm *BattleshipSessionManager) BindPlayer(session *Session, gameUuid, playerUuid string) (string, int64) {
+	session.bind(gameUuid, playerUuid)
+	return bsm.issueResumeToken(session, playerUuid)
+}
+
+// Any token issued before for this session stops working.
+// Returns the token and its expiry in unix seconds.
+func (bsm *BattleshipSessionManager) issueResumeToken(session *Session, playerUuid string) (string, int64) {
+	resumeToken, claims := bsm.resumeTokens.Issue(session.id, playerUuid)
+	session.setResumeNonce(claims.Nonce)
+	return resumeToken, claims.ExpiresAt
+}
+
+// Hands the conn over to the loop of the session the token
+// belongs to and returns once the loop has resumed on it.
+// The conn is closed if the token or the session is invalid.
+// A session of a restored game is brought back instead (see
+// reclaimSession) and returned; the caller runs its loop.
+func (bsm *BattleshipSessionManager) ReconnectSession(resumeToken string, conn *websocket.Conn, gameManager mb.GameManager) *Session {
+	reclaimed, err := bsm.reconnect(resumeToken, conn, gameManager)
 	if err != nil {
-		// This either means an expired session or invalid session ID
-		_ = conn.WriteJSON(NewMessage[NoPayload](CodeReceivedInvalidSessionID))
-		conn.Close()
-		return
+		// This either means an expired session or a bad token
+		msg := NewMessage[NoPayload](CodeReceivedInvalidSessionID)
+		msg.AddError(err, cerr.ConstErrResumeSession)
+		CloseConn(conn, msg, websocket.ClosePolicyViolation, "invalid resume token")
+		return nil
+	}
+	return reclaimed
+}
+
+// Returns the session only if it was reclaimed
+func (bsm *BattleshipSessionManager) reconnect(resumeToken string, conn *websocket.Conn, gameManager mb.GameManager) (*Session, error) {
+	claims, err := bsm.verifyResumeToken(resumeToken)
+	if err != nil {
+		return nil, err
 	}
-	session.reconnectionAfterAbnormalClosure(conn)
+
+	session, err := bsm.FindSession(claims.SessionId)
+	if cerr.CodeOf(err) == cerr.ErrCodeSessionNotFound {
+		return bsm.reclaimSession(claims, conn, gameManager)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := session.consumeResumeNonce(claims.PlayerUuid, claims.Nonce); err != nil {
+		return nil, err
+	}
+	return nil, session.handOff(conn)
 }
 
-// This method sends the msg from one session to another
+// The snapshot of a restored game still names the sessions
+// of its players, which died with the previous process. The
+// session comes back with the same ID so that the game and
+// the loop of the opponent need no update. Either side is
+// told whether the other one is back yet.
+func (bsm *BattleshipSessionManager) reclaimSession(claims token.Claims, conn *websocket.Conn, gameManager mb.GameManager) (*Session, error) {
+	game, err := gameManager.ClaimRestoredGame(claims.PlayerUuid, claims.SessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	session := NewSession(claims.SessionId, conn, bsm.clock, bsm.session)
+	session.bind(game.Uuid(), claims.PlayerUuid)
+	bsm.mu.Lock()
+	bsm.sessions[session.id] = session
+	bsm.mu.Unlock()
+	sessionsActive.Inc()
+
+	// The event log died with the previous process
+	resumeToken, expiresAt := bsm.issueResumeToken(session, claims.PlayerUuid)
+	msg := NewMessage[RespSessionResumed](CodeSessionResumed)
+	msg.AddPayload(RespSessionResumed{ResumeToken: resumeToken, ExpiresAt: expiresAt})
+	if err := session.writeToConnWithRetry(msg, MessageTypeJSON); err != nil {
+		// The loop of the caller finds the conn broken
+		return session, nil
+	}
+	reconnectsTotal.Inc()
+	session.Logger().Info("player reclaimed a restored game")
+
+	opponent := game.FetchPlayer(game.HostPlayer().Uuid() != claims.PlayerUuid)
+	if opponent == nil {
+		return session, nil
+	}
+	if otherSession, err := bsm.FindSession(opponent.SessionId()); err == nil {
+		if err := otherSession.writeToConnWithRetry(otherSession.stampEvent(NewMessage[NoPayload](CodeOtherPlayerReconnected)), MessageTypeJSON); err != nil {
+			otherSession.Logger().Info("failed to deliver event", logging.KeyError, err)
+		}
+		return session, nil
+	}
+	if err := session.writeToConnWithRetry(session.stampEvent(NewMessage[NoPayload](CodeOtherPlayerGracePeriod)), MessageTypeJSON); err != nil {
+		session.Logger().Info("failed to deliver event", logging.KeyError, err)
+	}
+	return session, nil
+}
+
+// Swaps in the new conn and confirms it to the client with
+// a fresh token and the seq to replay the missed events from
+func (bsm *BattleshipSessionManager) resumeSession(session *Session, conn *websocket.Conn) error {
+	session.resume(conn)
+
+	session.bindingMu.Lock()
+	playerUuid := session.playerUuid
+	session.bindingMu.Unlock()
+
+	resumeToken, expiresAt := bsm.issueResumeToken(session, playerUuid)
+	msg := NewMessage[RespSessionResumed](CodeSessionResumed)
+	msg.AddPayload(RespSessionResumed{ResumeToken: resumeToken, ExpiresAt: expiresAt, LastSeq: session.latestSeq()})
+	return session.writeToConnWithRetry(msg, MessageTypeJSON)
+}
+
+func (bsm *BattleshipSessionManager) verifyResumeToken(resumeToken string) (token.Claims, error) {
+	claims, err := bsm.resumeTokens.Verify(resumeToken)
+	switch err {
+	case nil:
+		return claims, nil
+	case token.ErrExpired:
+		return claims, cerr.ErrResumeTokenExpired()
+	default:
+		return claims, cerr.ErrResumeTokenInvalid()
+	}
+}
+
+// This method sends the msg from one session to another.
+// A failed write is not an error for the sender: the event
+// stays in the log of the receiver, whose own loop handles
+// its broken conn and whose client replays it on resume.
+// A receiver on another node gets the msg over the bus.
 func (bsm *BattleshipSessionManager) Communicate(senderSessionId, receiverSessionId string, msg interface{}, msgType uint8) error {
 	receiverSession, err := bsm.FindSession(receiverSessionId)
 	if err != nil {
-		return err
+		if bsm.bus == nil {
+			return err
+		}
+		return bsm.publishEvent(receiverSessionId, msg)
 	}
-	return bsm.WriteToSessionConn(receiverSession, msg, msgType, senderSessionId)
+
+	if err := receiverSession.writeToConnWithRetry(receiverSession.stampEvent(msg), msgType); err != nil {
+		receiverSession.Logger().Info("failed to deliver event", "sender_session", logging.HashId(senderSessionId), logging.KeyError, err)
+	}
+	return nil
 }
 
-// To ensure that there is no dangling connections,
-// server session manager marks the connections with a
-// lifetime of more than 20 mins as stale and deletes them.
-func (bsm *BattleshipSessionManager) CleanupPeriodically() {
-	assumedClosedConns := 10
+// Expires the sessions that have been idle or alive for too
+// long (see ExpiryConfig) so that no dangling connection or
+// game is left behind. Runs until ctx is cancelled.
+func (bsm *BattleshipSessionManager) CleanupPeriodically(ctx context.Context, gameManager mb.GameManager) {
+	ticker := bsm.clock.NewTicker(bsm.expiry.SweepInterval)
+	defer ticker.Stop()
 
 	for {
-		time.Sleep(bsm.cleanupInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		now := bsm.clock.Now()
+		for _, session := range bsm.sessionsSnapshot() {
+			if reason, expired := session.expiryReason(now, bsm.expiry); expired {
+				bsm.expireSession(session, reason, gameManager)
+			}
+		}
+		for _, gameUuid := range gameManager.ExpireUnclaimedGames(now) {
+			bsm.endUnclaimedGame(gameUuid, gameManager)
+		}
+	}
+}
+
+// Ends a restored game some player did not come back to,
+// like a grace period that is over: the players who did
+// come back are told that their opponent is gone
+func (bsm *BattleshipSessionManager) endUnclaimedGame(gameUuid string, gameManager mb.GameManager) {
+	game, err := gameManager.FetchGame(gameUuid)
+	if err != nil {
+		return
+	}
+	game.Logger().Info("restored game was not claimed in time")
+	gameManager.TerminateGame(gameUuid)
+
+	for _, player := range []*mb.BattleshipPlayer{game.HostPlayer(), game.JoinPlayer()} {
+		if player == nil {
+			continue
+		}
+		session, err := bsm.FindSession(player.SessionId())
+		if err != nil {
+			continue
+		}
+		if err := session.writeToConnWithRetry(session.stampEvent(NewMessage[NoPayload](CodeOtherPlayerDisconnected)), MessageTypeJSON); err != nil {
+			session.Logger().Info("failed to deliver event", logging.KeyError, err)
+		}
+	}
+}
+
+func (bsm *BattleshipSessionManager) expireSession(session *Session, reason string, gameManager mb.GameManager) {
+	session.Logger().Info("session expired", "reason", reason)
+	sessionsExpiredTotal.WithLabelValues(reason).Inc()
+
+	msg := NewMessage[RespSessionExpired](CodeSessionExpired)
+	msg.AddPayload(RespSessionExpired{Reason: reason})
+	bsm.endSession(session, gameManager, msg, "session expired")
+}
+
+func (bsm *BattleshipSessionManager) ListSessions() []SessionInfo {
+	sessions := bsm.sessionsSnapshot()
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, session.Info())
+	}
+	return infos
+}
+
+// Closes the session with the hashed ID (see SessionInfo)
+// and ends its game like an expiry does
+func (bsm *BattleshipSessionManager) KickSession(hashedSessionId, reason string, gameManager mb.GameManager) error {
+	for _, session := range bsm.sessionsSnapshot() {
+		if logging.HashId(session.id) != hashedSessionId {
+			continue
+		}
+
+		session.Logger().Info("session kicked", "reason", reason)
+		if game, err := gameManager.FetchGame(session.GameUuid()); err == nil {
+			game.EndByOperator()
+		}
+		msg := NewMessage[RespAdminAction](CodeSessionKicked)
+		msg.AddPayload(RespAdminAction{Reason: reason})
+		bsm.endSession(session, gameManager, msg, "session kicked")
+		return nil
+	}
+
+	return cerr.ErrSessionNotFound(hashedSessionId)
+}
+
+// Terminates the game and closes the sessions of both of
+// its players with CodeGameTerminated
+func (bsm *BattleshipSessionManager) EndGame(gameUuid, reason string, gameManager mb.GameManager) error {
+	game, err := gameManager.FetchGame(gameUuid)
+	if err != nil {
+		return err
+	}
+	game.Logger().Info("game ended by an operator", "reason", reason)
+	game.EndByOperator()
+	gameManager.TerminateGame(gameUuid)
+
+	for _, player := range []*mb.BattleshipPlayer{game.HostPlayer(), game.JoinPlayer()} {
+		if player == nil {
+			continue
+		}
+		session, err := bsm.FindSession(player.SessionId())
+		if err != nil {
+			continue
+		}
+		bsm.TerminateSession(session.id)
 
-		bsm.mu.Lock()
-		toDelete := make([]string, 0, assumedClosedConns)
+		msg := NewMessage[RespAdminAction](CodeGameTerminated)
+		msg.AddPayload(RespAdminAction{Reason: reason})
+		session.CloseWithMessage(msg, websocket.CloseNormalClosure, "game terminated")
+	}
+	return nil
+}
 
-		for ID, session := range bsm.sessions {
-			if time.Since(session.createdAt) > bsm.cleanupInterval {
-				toDelete = append(toDelete, ID)
+// Terminates the session and its game, tells the opponent
+// and closes the conn with the msg. The session loop ends on
+// its own once its read fails.
+func (bsm *BattleshipSessionManager) endSession(session *Session, gameManager mb.GameManager, msg interface{}, closeReason string) {
+	var opponentSessionId string
+	gameUuid := session.GameUuid()
+	if game, err := gameManager.FetchGame(gameUuid); err == nil {
+		for _, player := range []*mb.BattleshipPlayer{game.HostPlayer(), game.JoinPlayer()} {
+			if player != nil && player.SessionId() != session.id {
+				opponentSessionId = player.SessionId()
 			}
 		}
+		gameManager.TerminateGame(gameUuid)
+	}
+	bsm.TerminateSession(session.id)
 
-		log.Println("Clean up sessions:")
-		for _, ID := range toDelete {
-			delete(bsm.sessions, ID)
-			log.Printf("removed: %s", ID)
+	if opponentSessionId != "" {
+		if err := bsm.Communicate(session.id, opponentSessionId, NewMessage[NoPayload](CodeOtherPlayerDisconnected), MessageTypeJSON); err != nil {
+			slog.Warn("failed to notify the opponent of an ended session", logging.KeyError, err)
 		}
-		bsm.mu.Unlock()
 	}
+
+	session.CloseWithMessage(msg, websocket.CloseNormalClosure, closeReason)
 }
 
 // This function takes care of abnormal closures happening
 // to either of the clients. This happens due to backgrounding
 // in IOS clients or any other unexpected reasons for web apps.
+// It runs on the session loop and blocks until the client
+// hands over a new conn or the grace period is over.
 func (bsm *BattleshipSessionManager) HandleAbnormalClosureSession(s *Session, otherSessionId string) error {
+	// Without a player there is nothing to resume
+	if !s.isResumable() {
+		return NewConnErr(ConnLoopBreak).AddDesc("session cannot be resumed: " + s.id)
+	}
+
 	// Absence of otherPlayer session means this game is invalid
 	otherSession, err := bsm.FindSession(otherSessionId)
 	if err == nil {
-		// return NewConnErr(ConnLoopBreak).AddDesc("other session is nil; invalid session")
-		if err := otherSession.writeToConnWithRetry(NewMessage[NoPayload](CodeOtherPlayerGracePeriod), MessageTypeJSON); err != nil {
+		if err := otherSession.writeToConnWithRetry(otherSession.stampEvent(NewMessage[NoPayload](CodeOtherPlayerGracePeriod)), MessageTypeJSON); err != nil {
 			return err
 		}
 	}
 
 	// If the other session connection is faulty too, there is no need to continue
-	timer := time.NewTimer(gracePeriod)
+	timer := bsm.clock.NewTimer(s.cfg.GracePeriod)
+	defer timer.Stop()
+
 	select {
-	case <-timer.C:
+	case <-s.done:
+		return NewConnErr(ConnLoopBreak).AddDesc("session terminated during grace period: " + s.id)
+
+	case <-timer.C():
+		gracePeriodExpiriesTotal.Inc()
 		if otherSession != nil {
-			if err := otherSession.writeToConnWithRetry(NewMessage[NoPayload](CodeOtherPlayerDisconnected), MessageTypeJSON); err != nil {
+			if err := otherSession.writeToConnWithRetry(otherSession.stampEvent(NewMessage[NoPayload](CodeOtherPlayerDisconnected)), MessageTypeJSON); err != nil {
 				return err
 			}
 		}
 
-		log.Printf("session terminated: %s\n", s.id)
-		return NewConnErr(ConnLoopBreak).AddDesc("grace period is over for session: %d" + s.id)
+		s.Logger().Info("grace period is over; session terminated")
+		return NewConnErr(ConnLoopBreak).AddDesc("grace period is over for session: " + s.id)
+
+	case h := <-s.handoffChan:
+		if err := bsm.resumeSession(s, h.conn); err != nil {
+			h.result <- err
+			return err
+		}
+		h.result <- nil
+		reconnectsTotal.Inc()
 
-	case <-s.reconnectionSignalChan:
 		if otherSession != nil {
-			if err := otherSession.writeToConnWithRetry(NewMessage[NoPayload](CodeOtherPlayerReconnected), MessageTypeJSON); err != nil {
+			if err := otherSession.writeToConnWithRetry(otherSession.stampEvent(NewMessage[NoPayload](CodeOtherPlayerReconnected)), MessageTypeJSON); err != nil {
 				return err
 			}
 		}
-		log.Printf("player reconnected, session: %s\n", s.id)
+		s.Logger().Info("player reconnected")
 		return nil
 	}
 }
 
+// Only meant for the loop of the session itself; use
+// Communicate to write to the session of the other player
 func (bsm *BattleshipSessionManager) WriteToSessionConn(session *Session, msg interface{}, msgType uint8, otherSessonId string) error {
 	err := session.writeToConnWithRetry(msg, msgType)
 
@@ -161,14 +536,17 @@ func (bsm *BattleshipSessionManager) WriteToSessionConn(session *Session, msg in
 			panic("this will never happen")
 		}
 
+		// The write failed because a reconnect closed the old
+		// conn; the msg is lost but events can be replayed
+		if session.hasPendingHandoff() {
+			return bsm.HandleAbnormalClosureSession(session, otherSessonId)
+		}
+
 		switch connErr.Code() {
 		case ConnLoopBreak, ConnInvalidMsgType:
 			return connErr
 
 		case ConnLoopAbnormalClosureRetry:
-			if otherSessonId == "" {
-				return connErr
-			}
 			if err := bsm.HandleAbnormalClosureSession(session, otherSessonId); err != nil {
 				return connErr
 			}
@@ -184,9 +562,18 @@ func (bsm *BattleshipSessionManager) ReadFromSessionConn(session *Session, other
 	for {
 		messageType, payload, err := session.conn.ReadMessage()
 		if err == nil {
+			session.touch()
 			return messageType, payload, nil
 		}
 
+		// A reconnect closed the old conn under this read
+		if session.hasPendingHandoff() {
+			if err := bsm.HandleAbnormalClosureSession(session, otherSessionId); err != nil {
+				return -1, []byte{}, err
+			}
+			continue
+		}
+
 		switch session.handleReadFromConnErr(err, retries) {
 		case ConnLoopContinue:
 			retries++
@@ -28,10 +28,61 @@ const (
 	CodeRematchCallAccepted
 	CodeRematchCallRejected
 	CodeRematch
+
+	// Client asks for the pushed events it missed (e.g. after
+	// reconnecting) by sending the last seq it received
+	CodeReplayEvents
+
+	// Sent right before the server closes a connection that
+	// went over one of the rate limits
+	CodeRateLimited
+
+	// Pushed to every session once the server starts to shut
+	// down; the payload says when to come back
+	CodeServerShuttingDown
+
+	// Sent on the new conn once the session is resumed; the
+	// token in it replaces the one used to reconnect
+	CodeSessionResumed
+
+	// Sent right before the server closes a session that was
+	// idle or alive for too long
+	CodeSessionExpired
+
+	// Sent right before an operator closes the session or
+	// ends its game through the admin API
+	CodeSessionKicked
+	CodeGameTerminated
+
+	// Free text and catalogue emotes between the players. The
+	// sender gets the delivered version back as the response
+	CodeChat
+	CodeEmote
+
+	// Stops (or resumes) the chat and emotes of the opponent
+	CodeMuteOpponent
+
+	// Takes the seat of an entrant in their current match; the
+	// second one to arrive gets CodeSelectGrid like on a join
+	CodeJoinTournamentMatch
+
+	// Pushed to the seated entrants once a match is decided
+	CodeTournamentMatchResult
+	CodeTournamentStandings
+
+	// Special weapons of the games that allow them; each one
+	// takes the turn like a plain attack
+	CodeBomb
+	CodeTorpedo
+	CodeSonar
 )
 
 type Signal struct {
 	Code uint8 `json:"code"`
+
+	// Optional client-chosen ID; echoed back in every
+	// direct response to this signal
+	RequestId string `json:"request_id,omitempty"`
 }
 
 func NewSignal(code uint8) Signal {
@@ -0,0 +1,49 @@
+package tournament
+
+import (
+	"context"
+	"sync"
+)
+
+// Keeps the tournaments so that they outlive the process. The
+// manager saves one after every change and restores the
+// running ones on startup.
+type TournamentStore interface {
+	SaveTournament(ctx context.Context, tournament Tournament) error
+	ListRunningTournaments(ctx context.Context) ([]Tournament, error)
+}
+
+// Lives as long as the process; for tests and for running
+// without a database
+type MemoryTournamentStore struct {
+	tournaments map[string]Tournament
+	mu          sync.RWMutex
+}
+
+var _ TournamentStore = (*MemoryTournamentStore)(nil)
+
+func NewMemoryTournamentStore() *MemoryTournamentStore {
+	return &MemoryTournamentStore{tournaments: make(map[string]Tournament)}
+}
+
+// The manager hands over clones, so they are kept as they are
+func (mts *MemoryTournamentStore) SaveTournament(ctx context.Context, tournament Tournament) error {
+	mts.mu.Lock()
+	defer mts.mu.Unlock()
+
+	mts.tournaments[tournament.Uuid] = tournament
+	return nil
+}
+
+func (mts *MemoryTournamentStore) ListRunningTournaments(ctx context.Context) ([]Tournament, error) {
+	mts.mu.RLock()
+	defer mts.mu.RUnlock()
+
+	tournaments := make([]Tournament, 0, len(mts.tournaments))
+	for _, tournament := range mts.tournaments {
+		if tournament.Status == StatusRunning {
+			tournaments = append(tournaments, tournament.clone())
+		}
+	}
+	return tournaments, nil
+}
@@ -0,0 +1,329 @@
+/*
+Package tournament runs brackets of games between a fixed list
+of entrants. Every pairing is a regular game of the game
+manager; the entrants take their seat with a secret token
+instead of the game UUID and the result is reported back once
+the game has a winner.
+*/
+package tournament
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sort"
+	"time"
+)
+
+const (
+	FormatSingleElimination = "single_elimination"
+	FormatRoundRobin        = "round_robin"
+)
+
+const (
+	StatusRunning  = "running"
+	StatusFinished = "finished"
+)
+
+const (
+	// Waiting for the earlier rounds
+	MatchStatusPending = "pending"
+
+	// The game is created and the no-show deadline runs
+	MatchStatusScheduled = "scheduled"
+
+	// Both entrants are seated
+	MatchStatusPlaying  = "playing"
+	MatchStatusFinished = "finished"
+)
+
+// How a finished match was decided
+const (
+	DecidedByPlay = "play"
+	DecidedByBye  = "bye"
+
+	// Only one of the entrants showed up, or one of them left
+	// the game before it ended
+	DecidedByForfeit = "forfeit"
+
+	// Neither showed up. In an elimination bracket the better
+	// seed goes through; in a round robin nobody wins.
+	DecidedByNoShow = "no_show"
+)
+
+const (
+	MinEntrants   = 2
+	MaxEntrants   = 64
+	MaxNameLength = 32
+)
+
+type Entrant struct {
+	// 1 is the best; also the ID of the entrant
+	Seed int    `json:"seed"`
+	Name string `json:"name"`
+
+	// Secret of the entrant; only the admin API shows it
+	SeatToken string `json:"seat_token"`
+}
+
+type Match struct {
+	Id    int
+	Round int
+
+	// 0 until the earlier round decided it, or for a bye
+	SeedA int
+	SeedB int
+
+	Status   string
+	GameUuid string
+	Deadline time.Time
+
+	// The first of the two to take a seat hosts the game
+	HostSeed int
+	JoinSeed int
+
+	// 0 if nobody won
+	Winner    int
+	DecidedBy string
+
+	// Single elimination only; 0 for the final. Slot 0 is
+	// SeedA of the next match.
+	NextMatchId int
+	NextSlot    int
+
+	// Sessions of the seated entrants, not persisted
+	hostSessionId string
+	joinSessionId string
+}
+
+func (m *Match) hasEntrant(seed int) bool {
+	return seed != 0 && (m.SeedA == seed || m.SeedB == seed)
+}
+
+func (m *Match) isOpen() bool {
+	return m.Status == MatchStatusScheduled || m.Status == MatchStatusPlaying
+}
+
+func (m *Match) sessionIds() []string {
+	sessionIds := make([]string, 0, 2)
+	for _, sessionId := range []string{m.hostSessionId, m.joinSessionId} {
+		if sessionId != "" {
+			sessionIds = append(sessionIds, sessionId)
+		}
+	}
+	return sessionIds
+}
+
+type Tournament struct {
+	Uuid       string
+	Format     string
+	Difficulty uint8
+	Status     string
+	CreatedAt  time.Time
+
+	// 0 until the tournament is finished
+	Champion int
+
+	Entrants []Entrant
+
+	// Ordered by ID, which starts at 1
+	Matches []*Match
+}
+
+func (t *Tournament) match(matchId int) *Match {
+	if matchId < 1 || matchId > len(t.Matches) {
+		return nil
+	}
+	return t.Matches[matchId-1]
+}
+
+// Shares no memory with t, so it can be handed to a store
+func (t *Tournament) clone() Tournament {
+	c := *t
+	c.Entrants = append([]Entrant(nil), t.Entrants...)
+	c.Matches = make([]*Match, len(t.Matches))
+	for i, m := range t.Matches {
+		copied := *m
+		c.Matches[i] = &copied
+	}
+	return c
+}
+
+func newSeatToken() string {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+/*
+Lays out a bracket for the next power of two so that the best
+seeds meet last, e.g. 1-8, 4-5, 2-7, 3-6 for eight entrants.
+The missing entrants are byes; the best seeds get them.
+*/
+func singleEliminationMatches(entrants int) []*Match {
+	size := 2
+	for size < entrants {
+		size *= 2
+	}
+
+	order := []int{1}
+	for len(order) < size {
+		next := make([]int, 0, len(order)*2)
+		for _, seed := range order {
+			next = append(next, seed, len(order)*2+1-seed)
+		}
+		order = next
+	}
+
+	var matches []*Match
+	roundStart, roundSize := 1, size/2
+	for round := 1; roundSize >= 1; round++ {
+		nextRoundStart := roundStart + roundSize
+		for i := 0; i < roundSize; i++ {
+			m := &Match{Id: roundStart + i, Round: round, Status: MatchStatusPending}
+			if round == 1 {
+				m.SeedA, m.SeedB = order[2*i], order[2*i+1]
+				if m.SeedB > entrants {
+					m.SeedB = 0
+				}
+			}
+			if roundSize > 1 {
+				m.NextMatchId, m.NextSlot = nextRoundStart+i/2, i%2
+			}
+			matches = append(matches, m)
+		}
+		roundStart, roundSize = nextRoundStart, roundSize/2
+	}
+	return matches
+}
+
+// Circle method; with an odd number of entrants one of them
+// sits out every round
+func roundRobinMatches(entrants int) []*Match {
+	seeds := make([]int, 0, entrants+1)
+	for seed := 1; seed <= entrants; seed++ {
+		seeds = append(seeds, seed)
+	}
+	if len(seeds)%2 == 1 {
+		seeds = append(seeds, 0)
+	}
+
+	var matches []*Match
+	for round := 1; round < len(seeds); round++ {
+		for i := 0; i < len(seeds)/2; i++ {
+			a, b := seeds[i], seeds[len(seeds)-1-i]
+			if a == 0 || b == 0 {
+				continue
+			}
+			if a > b {
+				a, b = b, a
+			}
+			matches = append(matches, &Match{Id: len(matches) + 1, Round: round, SeedA: a, SeedB: b, Status: MatchStatusPending})
+		}
+
+		// The first seed stays, the others rotate
+		last := seeds[len(seeds)-1]
+		copy(seeds[2:], seeds[1:len(seeds)-1])
+		seeds[1] = last
+	}
+	return matches
+}
+
+type EntrantStanding struct {
+	Seed       int    `json:"seed"`
+	Name       string `json:"name"`
+	Wins       int    `json:"wins"`
+	Losses     int    `json:"losses"`
+	Eliminated bool   `json:"eliminated,omitempty"`
+}
+
+type MatchStanding struct {
+	Id        int        `json:"id"`
+	Round     int        `json:"round"`
+	SeedA     int        `json:"seed_a,omitempty"`
+	SeedB     int        `json:"seed_b,omitempty"`
+	Status    string     `json:"status"`
+	Winner    int        `json:"winner,omitempty"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+}
+
+// The public view of a tournament; no seat tokens or game UUIDs
+type Standings struct {
+	Uuid       string `json:"uuid"`
+	Format     string `json:"format"`
+	Difficulty uint8  `json:"difficulty"`
+	Status     string `json:"status"`
+
+	// The lowest round with a match left, or the last one
+	Round    int `json:"round"`
+	Champion int `json:"champion,omitempty"`
+
+	// Best first
+	Entrants []EntrantStanding `json:"entrants"`
+	Matches  []MatchStanding   `json:"matches"`
+}
+
+func (t *Tournament) standings() Standings {
+	s := Standings{
+		Uuid:       t.Uuid,
+		Format:     t.Format,
+		Difficulty: t.Difficulty,
+		Status:     t.Status,
+		Champion:   t.Champion,
+		Entrants:   make([]EntrantStanding, len(t.Entrants)),
+		Matches:    make([]MatchStanding, len(t.Matches)),
+	}
+
+	for i, entrant := range t.Entrants {
+		s.Entrants[i] = EntrantStanding{Seed: entrant.Seed, Name: entrant.Name}
+	}
+
+	for i, m := range t.Matches {
+		ms := MatchStanding{Id: m.Id, Round: m.Round, SeedA: m.SeedA, SeedB: m.SeedB, Status: m.Status, Winner: m.Winner, DecidedBy: m.DecidedBy}
+		if m.Status == MatchStatusScheduled {
+			deadline := m.Deadline
+			ms.Deadline = &deadline
+		}
+		s.Matches[i] = ms
+
+		if m.Status != MatchStatusFinished {
+			if s.Round == 0 || m.Round < s.Round {
+				s.Round = m.Round
+			}
+			continue
+		}
+		for _, seed := range []int{m.SeedA, m.SeedB} {
+			if seed == 0 || m.DecidedBy == DecidedByBye {
+				continue
+			}
+			if seed == m.Winner {
+				s.Entrants[seed-1].Wins++
+				continue
+			}
+			s.Entrants[seed-1].Losses++
+			if t.Format == FormatSingleElimination {
+				s.Entrants[seed-1].Eliminated = true
+			}
+		}
+	}
+	if s.Round == 0 && len(t.Matches) > 0 {
+		s.Round = t.Matches[len(t.Matches)-1].Round
+	}
+
+	sort.SliceStable(s.Entrants, func(i, j int) bool {
+		a, b := s.Entrants[i], s.Entrants[j]
+		if a.Eliminated != b.Eliminated {
+			return !a.Eliminated
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		if a.Losses != b.Losses {
+			return a.Losses < b.Losses
+		}
+		return a.Seed < b.Seed
+	})
+	return s
+}
@@ -0,0 +1,592 @@
+package tournament
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/saeidalz13/battleship-backend/internal/clock"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+)
+
+// How long a single call to the tournament store may take
+const tournamentStoreTimeout = time.Second * 5
+
+type TournamentConfig struct {
+	// How long the entrants of a scheduled match have to take
+	// their seat before it is decided without them
+	NoShowTimeout time.Duration
+
+	// How often the deadlines are checked
+	SweepInterval time.Duration
+}
+
+func DefaultTournamentConfig() TournamentConfig {
+	return TournamentConfig{
+		NoShowTimeout: time.Minute * 5,
+		SweepInterval: time.Second * 30,
+	}
+}
+
+type TournamentManager interface {
+	CreateTournament(format string, difficulty uint8, names []string) (Tournament, error)
+	FetchTournament(tournamentUuid string) (Tournament, error)
+	FetchStandings(tournamentUuid string) (Standings, error)
+
+	Seat(tournamentUuid, seatToken, sessionId string) (Seat, error)
+	IsTournamentGame(gameUuid string) bool
+	IsMatchFinished(gameUuid string) bool
+	ReportResult(gameUuid string, hostWon bool) (Result, bool)
+	ReportForfeit(gameUuid string, hostLeft bool) (Result, bool)
+	VoidMatch(gameUuid string) bool
+
+	ExpireMatches(now time.Time) []Result
+	ExpireMatchesPeriodically(ctx context.Context, notify func(Result))
+	RestoreTournaments(ctx context.Context) (int, error)
+}
+
+// An entrant in the game of their current match
+type Seat struct {
+	TournamentUuid string
+	MatchId        int
+	Round          int
+	Seed           int
+
+	Game   *mb.Game
+	Player *mb.BattleshipPlayer
+
+	// Seated second, so both players are in the game now
+	IsJoin bool
+}
+
+// A decided match, to be told to the seated entrants
+type Result struct {
+	TournamentUuid string
+	MatchId        int
+
+	// 0 if nobody won
+	Winner    int
+	DecidedBy string
+
+	// 0 unless this match finished the tournament
+	Champion int
+
+	SessionIds []string
+}
+
+type matchRef struct {
+	tournamentUuid string
+	matchId        int
+}
+
+type BattleshipTournamentManager struct {
+	cfg         TournamentConfig
+	clock       clock.Clock
+	gameManager mb.GameManager
+	store       TournamentStore
+
+	// Guards the tournaments and their matches. Saves happen
+	// while holding it so that an older state of a tournament
+	// never overwrites a newer one.
+	mu          sync.Mutex
+	tournaments map[string]*Tournament
+
+	// Every game a match was played in, including the old
+	// games of the finished matches
+	games map[string]matchRef
+}
+
+var _ TournamentManager = (*BattleshipTournamentManager)(nil)
+
+func NewBattleshipTournamentManager(gameManager mb.GameManager) *BattleshipTournamentManager {
+	return &BattleshipTournamentManager{
+		cfg:         DefaultTournamentConfig(),
+		clock:       clock.Real(),
+		gameManager: gameManager,
+		store:       NewMemoryTournamentStore(),
+		tournaments: make(map[string]*Tournament),
+		games:       make(map[string]matchRef),
+	}
+}
+
+// Applies to the matches scheduled afterwards
+func (btm *BattleshipTournamentManager) WithTournamentConfig(cfg TournamentConfig) *BattleshipTournamentManager {
+	btm.cfg = cfg
+	return btm
+}
+
+// Must be set before any tournament is created
+func (btm *BattleshipTournamentManager) WithClock(clk clock.Clock) *BattleshipTournamentManager {
+	btm.clock = clk
+	return btm
+}
+
+// Must be set before any tournament is created
+func (btm *BattleshipTournamentManager) WithTournamentStore(store TournamentStore) *BattleshipTournamentManager {
+	btm.store = store
+	return btm
+}
+
+// Seeds follow the order of the names, the first is the best.
+// The games of the first round are created right away.
+func (btm *BattleshipTournamentManager) CreateTournament(format string, difficulty uint8, names []string) (Tournament, error) {
+	var matches []*Match
+	switch format {
+	case FormatSingleElimination:
+		matches = singleEliminationMatches(len(names))
+	case FormatRoundRobin:
+		matches = roundRobinMatches(len(names))
+	default:
+		return Tournament{}, cerr.ErrInvalidTournament(fmt.Sprintf("format must be either %s or %s, got %q", FormatSingleElimination, FormatRoundRobin, format))
+	}
+
+	if difficulty > mb.GameDifficultyHard {
+		return Tournament{}, cerr.ErrInvalidGameDifficulty()
+	}
+	entrants, err := newEntrants(names)
+	if err != nil {
+		return Tournament{}, err
+	}
+
+	t := &Tournament{
+		Uuid:       uuid.NewString()[:8],
+		Format:     format,
+		Difficulty: difficulty,
+		Status:     StatusRunning,
+		CreatedAt:  btm.clock.Now(),
+		Entrants:   entrants,
+		Matches:    matches,
+	}
+
+	btm.mu.Lock()
+	defer btm.mu.Unlock()
+
+	btm.tournaments[t.Uuid] = t
+	for _, m := range t.Matches {
+		if m.Round == 1 && t.Format == FormatSingleElimination && m.SeedB == 0 {
+			btm.finishMatch(t, m, m.SeedA, DecidedByBye)
+		}
+	}
+	btm.scheduleReadyMatches(t)
+	btm.save(t)
+
+	slog.Info("tournament created", "tournament", t.Uuid, "format", format, "entrants", len(entrants))
+	return t.clone(), nil
+}
+
+func newEntrants(names []string) ([]Entrant, error) {
+	if len(names) < MinEntrants || len(names) > MaxEntrants {
+		return nil, cerr.ErrInvalidTournament(fmt.Sprintf("needs between %d and %d entrants, got %d", MinEntrants, MaxEntrants, len(names)))
+	}
+
+	entrants := make([]Entrant, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || utf8.RuneCountInString(name) > MaxNameLength {
+			return nil, cerr.ErrInvalidTournament(fmt.Sprintf("names must have between 1 and %d characters, got %q", MaxNameLength, name))
+		}
+		if _, prs := seen[strings.ToLower(name)]; prs {
+			return nil, cerr.ErrInvalidTournament(fmt.Sprintf("name %q is taken", name))
+		}
+		seen[strings.ToLower(name)] = struct{}{}
+
+		entrants = append(entrants, Entrant{Seed: i + 1, Name: name, SeatToken: newSeatToken()})
+	}
+	return entrants, nil
+}
+
+// With the seat tokens; for operators only
+func (btm *BattleshipTournamentManager) FetchTournament(tournamentUuid string) (Tournament, error) {
+	btm.mu.Lock()
+	defer btm.mu.Unlock()
+
+	t, prs := btm.tournaments[tournamentUuid]
+	if !prs {
+		return Tournament{}, cerr.ErrTournamentNotExists(tournamentUuid)
+	}
+	return t.clone(), nil
+}
+
+func (btm *BattleshipTournamentManager) FetchStandings(tournamentUuid string) (Standings, error) {
+	btm.mu.Lock()
+	defer btm.mu.Unlock()
+
+	t, prs := btm.tournaments[tournamentUuid]
+	if !prs {
+		return Standings{}, cerr.ErrTournamentNotExists(tournamentUuid)
+	}
+	return t.standings(), nil
+}
+
+/*
+Puts the entrant with the seat token into the game of their
+current match. The first one to show up hosts it. A game that
+is gone by now (its host left before the opponent came, or it
+was lost in a restart) is replaced by a new one.
+*/
+func (btm *BattleshipTournamentManager) Seat(tournamentUuid, seatToken, sessionId string) (Seat, error) {
+	btm.mu.Lock()
+	defer btm.mu.Unlock()
+
+	t, prs := btm.tournaments[tournamentUuid]
+	if !prs {
+		return Seat{}, cerr.ErrTournamentNotExists(tournamentUuid)
+	}
+
+	seed := 0
+	for _, entrant := range t.Entrants {
+		if subtle.ConstantTimeCompare([]byte(entrant.SeatToken), []byte(seatToken)) == 1 {
+			seed = entrant.Seed
+		}
+	}
+	if seed == 0 {
+		return Seat{}, cerr.ErrSeatTokenInvalid()
+	}
+
+	var m *Match
+	for _, candidate := range t.Matches {
+		if candidate.isOpen() && candidate.hasEntrant(seed) {
+			m = candidate
+			break
+		}
+	}
+	if m == nil {
+		return Seat{}, cerr.ErrNoTournamentMatch()
+	}
+	if m.HostSeed == seed || m.JoinSeed == seed {
+		return Seat{}, cerr.ErrAlreadyInGame(m.GameUuid)
+	}
+
+	game, err := btm.gameManager.FetchGame(m.GameUuid)
+	if err != nil {
+		if game, err = btm.newMatchGame(t, m); err != nil {
+			return Seat{}, err
+		}
+	}
+
+	seat := Seat{TournamentUuid: t.Uuid, MatchId: m.Id, Round: m.Round, Seed: seed, Game: game}
+	if m.HostSeed == 0 {
+		seat.Player = game.CreateHostPlayer(sessionId)
+		m.HostSeed, m.hostSessionId = seed, sessionId
+	} else {
+		seat.Player = game.CreateJoinPlayer(sessionId)
+		m.JoinSeed, m.joinSessionId = seed, sessionId
+		m.Status = MatchStatusPlaying
+		seat.IsJoin = true
+	}
+
+	btm.gameManager.SaveGame(game)
+	btm.save(t)
+	return seat, nil
+}
+
+func (btm *BattleshipTournamentManager) IsTournamentGame(gameUuid string) bool {
+	btm.mu.Lock()
+	defer btm.mu.Unlock()
+
+	_, prs := btm.games[gameUuid]
+	return prs
+}
+
+func (btm *BattleshipTournamentManager) IsMatchFinished(gameUuid string) bool {
+	btm.mu.Lock()
+	defer btm.mu.Unlock()
+
+	t, m := btm.matchOf(gameUuid)
+	return t != nil && m.Status == MatchStatusFinished
+}
+
+// Called once the game of a match has a winner. False if the
+// game is not a tournament one or its match is decided already.
+func (btm *BattleshipTournamentManager) ReportResult(gameUuid string, hostWon bool) (Result, bool) {
+	btm.mu.Lock()
+	defer btm.mu.Unlock()
+
+	t, m := btm.matchOf(gameUuid)
+	if t == nil || m.Status != MatchStatusPlaying {
+		return Result{}, false
+	}
+
+	winner := m.JoinSeed
+	if hostWon {
+		winner = m.HostSeed
+	}
+	result := btm.finishMatch(t, m, winner, DecidedByPlay)
+	btm.save(t)
+	return result, true
+}
+
+/*
+Called when a player leaves the game of a match before it
+ended. Once both are seated the one who left loses; a host who
+is still alone only gives up the seat and may come back before
+the deadline.
+*/
+func (btm *BattleshipTournamentManager) ReportForfeit(gameUuid string, hostLeft bool) (Result, bool) {
+	btm.mu.Lock()
+	defer btm.mu.Unlock()
+
+	t, m := btm.matchOf(gameUuid)
+	if t == nil {
+		return Result{}, false
+	}
+
+	switch m.Status {
+	case MatchStatusScheduled:
+		if hostLeft && m.HostSeed != 0 {
+			m.HostSeed, m.hostSessionId = 0, ""
+			btm.save(t)
+		}
+		return Result{}, false
+
+	case MatchStatusPlaying:
+		winner := m.HostSeed
+		if hostLeft {
+			winner = m.JoinSeed
+		}
+		result := btm.finishMatch(t, m, winner, DecidedByForfeit)
+		btm.save(t)
+		return result, true
+	}
+	return Result{}, false
+}
+
+// Called when an operator ended the game of a match. Nobody
+// wins; the match gets a new game and its entrants take their
+// seats again. False if the game is not a tournament one or its
+// match is decided already.
+func (btm *BattleshipTournamentManager) VoidMatch(gameUuid string) bool {
+	btm.mu.Lock()
+	defer btm.mu.Unlock()
+
+	t, m := btm.matchOf(gameUuid)
+	if t == nil || !m.isOpen() {
+		return false
+	}
+
+	// The loops of both players report the game; only the
+	// first one replays the match
+	delete(btm.games, gameUuid)
+	btm.scheduleMatch(t, m)
+	btm.save(t)
+	slog.Info("match voided", "tournament", t.Uuid, "match", m.Id)
+	return true
+}
+
+// Decides the scheduled matches whose deadline has passed
+func (btm *BattleshipTournamentManager) ExpireMatches(now time.Time) []Result {
+	btm.mu.Lock()
+	defer btm.mu.Unlock()
+
+	var results []Result
+	for _, t := range btm.tournaments {
+		if t.Status != StatusRunning {
+			continue
+		}
+
+		expired := false
+		for _, m := range t.Matches {
+			if m.Status != MatchStatusScheduled || now.Before(m.Deadline) {
+				continue
+			}
+
+			winner, decidedBy := m.HostSeed, DecidedByForfeit
+			if winner == 0 {
+				winner, decidedBy = t.noShowWinner(m), DecidedByNoShow
+			}
+			btm.gameManager.TerminateGame(m.GameUuid)
+			results = append(results, btm.finishMatch(t, m, winner, decidedBy))
+			expired = true
+		}
+		if expired {
+			btm.save(t)
+		}
+	}
+	return results
+}
+
+func (t *Tournament) noShowWinner(m *Match) int {
+	if t.Format == FormatRoundRobin {
+		return 0
+	}
+	return min(m.SeedA, m.SeedB)
+}
+
+// Runs until ctx is cancelled; notify is called for every
+// match that was decided
+func (btm *BattleshipTournamentManager) ExpireMatchesPeriodically(ctx context.Context, notify func(Result)) {
+	ticker := btm.clock.NewTicker(btm.cfg.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		for _, result := range btm.ExpireMatches(btm.clock.Now()) {
+			notify(result)
+		}
+	}
+}
+
+/*
+Brings back the running tournaments of the store. Call it
+after the games are restored: an open match whose game did not
+survive gets a new one, and every scheduled match a new
+deadline since nobody could take a seat while the server was
+down.
+*/
+func (btm *BattleshipTournamentManager) RestoreTournaments(ctx context.Context) (int, error) {
+	tournaments, err := btm.store.ListRunningTournaments(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	btm.mu.Lock()
+	defer btm.mu.Unlock()
+
+	for i := range tournaments {
+		t := &tournaments[i]
+		btm.tournaments[t.Uuid] = t
+
+		for _, m := range t.Matches {
+			if m.GameUuid != "" {
+				btm.games[m.GameUuid] = matchRef{tournamentUuid: t.Uuid, matchId: m.Id}
+			}
+			if !m.isOpen() {
+				continue
+			}
+
+			game, err := btm.gameManager.FetchGame(m.GameUuid)
+			if err != nil {
+				btm.scheduleMatch(t, m)
+				continue
+			}
+			if host := game.HostPlayer(); host != nil {
+				m.hostSessionId = host.SessionId()
+			}
+			if join := game.JoinPlayer(); join != nil {
+				m.joinSessionId = join.SessionId()
+			}
+			if m.Status == MatchStatusScheduled {
+				m.Deadline = btm.clock.Now().Add(btm.cfg.NoShowTimeout)
+			}
+		}
+		btm.save(t)
+		slog.Info("tournament restored", "tournament", t.Uuid)
+	}
+	return len(tournaments), nil
+}
+
+func (btm *BattleshipTournamentManager) matchOf(gameUuid string) (*Tournament, *Match) {
+	ref, prs := btm.games[gameUuid]
+	if !prs {
+		return nil, nil
+	}
+	t := btm.tournaments[ref.tournamentUuid]
+	if t == nil {
+		return nil, nil
+	}
+	return t, t.match(ref.matchId)
+}
+
+// Moves the winner on and schedules whatever became ready
+func (btm *BattleshipTournamentManager) finishMatch(t *Tournament, m *Match, winner int, decidedBy string) Result {
+	m.Status, m.Winner, m.DecidedBy = MatchStatusFinished, winner, decidedBy
+	result := Result{TournamentUuid: t.Uuid, MatchId: m.Id, Winner: winner, DecidedBy: decidedBy, SessionIds: m.sessionIds()}
+	m.hostSessionId, m.joinSessionId = "", ""
+
+	if next := t.match(m.NextMatchId); next != nil {
+		if m.NextSlot == 0 {
+			next.SeedA = winner
+		} else {
+			next.SeedB = winner
+		}
+	}
+	btm.scheduleReadyMatches(t)
+
+	for _, other := range t.Matches {
+		if other.Status != MatchStatusFinished {
+			return result
+		}
+	}
+
+	t.Status = StatusFinished
+	if t.Format == FormatSingleElimination {
+		t.Champion = t.Matches[len(t.Matches)-1].Winner
+	} else {
+		t.Champion = t.standings().Entrants[0].Seed
+	}
+	result.Champion = t.Champion
+	slog.Info("tournament finished", "tournament", t.Uuid, "champion", t.Champion)
+	return result
+}
+
+// A round robin round starts once the previous one is over;
+// an elimination match once both of its entrants are known
+func (btm *BattleshipTournamentManager) scheduleReadyMatches(t *Tournament) {
+	unfinishedRound := 0
+	for _, m := range t.Matches {
+		if m.Status != MatchStatusFinished && (unfinishedRound == 0 || m.Round < unfinishedRound) {
+			unfinishedRound = m.Round
+		}
+	}
+
+	for _, m := range t.Matches {
+		if m.Status != MatchStatusPending {
+			continue
+		}
+		ready := m.SeedA != 0 && m.SeedB != 0
+		if t.Format == FormatRoundRobin {
+			ready = m.Round == unfinishedRound
+		}
+		if ready {
+			btm.scheduleMatch(t, m)
+		}
+	}
+}
+
+func (btm *BattleshipTournamentManager) scheduleMatch(t *Tournament, m *Match) {
+	if _, err := btm.newMatchGame(t, m); err != nil {
+		// The difficulty was checked on creation
+		slog.Error("failed to create the game of a match", "tournament", t.Uuid, "match", m.Id, logging.KeyError, err)
+		return
+	}
+	m.Status = MatchStatusScheduled
+	m.Deadline = btm.clock.Now().Add(btm.cfg.NoShowTimeout)
+}
+
+// Replaces the game of the match and empties its seats
+func (btm *BattleshipTournamentManager) newMatchGame(t *Tournament, m *Match) (*mb.Game, error) {
+	game, err := btm.gameManager.CreateGame(t.Difficulty)
+	if err != nil {
+		return nil, err
+	}
+
+	m.GameUuid = game.Uuid()
+	m.HostSeed, m.JoinSeed = 0, 0
+	m.hostSessionId, m.joinSessionId = "", ""
+	btm.games[m.GameUuid] = matchRef{tournamentUuid: t.Uuid, matchId: m.Id}
+	return game, nil
+}
+
+// A failed write is only logged; the tournament goes on in
+// memory
+func (btm *BattleshipTournamentManager) save(t *Tournament) {
+	ctx, cancel := context.WithTimeout(context.Background(), tournamentStoreTimeout)
+	defer cancel()
+	if err := btm.store.SaveTournament(ctx, t.clone()); err != nil {
+		slog.Warn("failed to save the tournament", "tournament", t.Uuid, logging.KeyError, err)
+	}
+}
@@ -0,0 +1,211 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/saeidalz13/battleship-backend/api"
+	"github.com/saeidalz13/battleship-backend/internal/clock"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+const testAdminToken = "admin-secret"
+
+func serveAdmin(t *testing.T, admin http.Handler, method, target, body string, expectedStatus int) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, req)
+	if rec.Code != expectedStatus {
+		t.Fatalf("%s %s: expected status %d, got %d: %s", method, target, expectedStatus, rec.Code, rec.Body.String())
+	}
+	return rec
+}
+
+func decodeAdmin[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var resp T
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func expectAdminClose[T any](t *testing.T, conn *websocket.Conn, expectedCode uint8) mc.Message[T] {
+	t.Helper()
+
+	msg := readMessage[T](t, conn, expectedCode)
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("expected close error %d, got: %v", websocket.CloseNormalClosure, err)
+	}
+	return msg
+}
+
+func TestAdminAuth(t *testing.T) {
+	admin := api.NewAdminHandler(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil, testAdminToken)
+
+	for _, header := range []string{"", "Bearer wrong", testAdminToken} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/sessions", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected %q to be unauthorized, got %d", header, rec.Code)
+		}
+	}
+}
+
+func TestAdminInspect(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	bsm := mc.NewBattleshipSessionManager().WithClock(clk)
+	bgm := mb.NewBattleshipGameManager()
+	wsUrl := startTestServer(t, api.NewRequestProcessor(bsm, bgm, nil))
+	admin := api.NewAdminHandler(bsm, bgm, nil, testAdminToken)
+
+	hostConn, joinConn, gameUuid := setupTestGame(t, wsUrl)
+	readyTestGame(t, hostConn, joinConn)
+	writeMessage(t, hostConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 0}})
+	readMessage[mc.RespAttack](t, hostConn, mc.CodeAttack)
+	readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack)
+
+	waitingGame, err := bgm.CreateGame(mb.GameDifficultyHard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clk.Advance(time.Second * 90)
+	sessions := decodeAdmin[[]api.RespAdminSession](t, serveAdmin(t, admin, http.MethodGet, "/admin/sessions", "", http.StatusOK))
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got: %+v", sessions)
+	}
+	for _, session := range sessions {
+		if session.GameUuid != gameUuid || session.RemoteAddr == "" || session.Id == "" || session.AgeSeconds != 90 || session.IdleSeconds != 90 {
+			t.Fatalf("unexpected session: %+v", session)
+		}
+	}
+
+	games := decodeAdmin[[]api.RespAdminGame](t, serveAdmin(t, admin, http.MethodGet, "/admin/games", "", http.StatusOK))
+	phases := make(map[string]string, len(games))
+	for _, game := range games {
+		phases[game.Uuid] = game.Phase
+	}
+	if phases[gameUuid] != mb.GamePhaseInProgress || phases[waitingGame.Uuid()] != mb.GamePhaseWaitingForOpponent {
+		t.Fatalf("unexpected phases: %+v", phases)
+	}
+
+	game := decodeAdmin[api.RespAdminGame](t, serveAdmin(t, admin, http.MethodGet, "/admin/games/"+gameUuid, "", http.StatusOK))
+	if game.GridSize != mb.GridSizeEasy || game.StartedAt == nil || len(game.Players) != 2 {
+		t.Fatalf("unexpected game state: %+v", game)
+	}
+	if game.Players[0].AttackGrid[0][0] == int(mb.PositionStateAttackGridEmpty) {
+		t.Fatalf("expected the attack of the host in its grid, got: %+v", game.Players[0].AttackGrid)
+	}
+
+	serveAdmin(t, admin, http.MethodGet, "/admin/games/nope", "", http.StatusNotFound)
+}
+
+// The admin view and the status count are read while both loops
+// play; run with -race to catch unguarded reads
+func TestAdminInspectDuringGame(t *testing.T) {
+	bsm := mc.NewBattleshipSessionManager()
+	bgm := mb.NewBattleshipGameManager()
+	wsUrl := startTestServer(t, api.NewRequestProcessor(bsm, bgm, nil))
+	admin := api.NewAdminHandler(bsm, bgm, nil, testAdminToken)
+
+	hostConn, joinConn, gameUuid := setupTestGame(t, wsUrl)
+
+	done := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			req := httptest.NewRequest(http.MethodGet, "/admin/games/"+gameUuid, nil)
+			req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			admin.ServeHTTP(httptest.NewRecorder(), req)
+			bgm.GamesInProgress()
+		}
+	}()
+
+	readyTestGame(t, hostConn, joinConn)
+	playTestGameToHostWin(t, hostConn, joinConn)
+	close(done)
+	<-polled
+
+	game := decodeAdmin[api.RespAdminGame](t, serveAdmin(t, admin, http.MethodGet, "/admin/games/"+gameUuid, "", http.StatusOK))
+	if game.Phase != mb.GamePhaseFinished || len(game.Players) != 2 {
+		t.Fatalf("unexpected game state: %+v", game)
+	}
+	if game.Players[0].MatchStatus != mb.PlayerMatchStatusWon || game.Players[1].SunkenShips == 0 {
+		t.Fatalf("expected the host to have won, got: %+v", game.Players)
+	}
+}
+
+func TestAdminKickSession(t *testing.T) {
+	bsm := mc.NewBattleshipSessionManager()
+	bgm := mb.NewBattleshipGameManager()
+	wsUrl := startTestServer(t, api.NewRequestProcessor(bsm, bgm, nil))
+	admin := api.NewAdminHandler(bsm, bgm, nil, testAdminToken)
+
+	hostConn, joinConn, gameUuid := setupTestGame(t, wsUrl)
+	readyTestGame(t, hostConn, joinConn)
+
+	var joinSessionId string
+	for _, session := range bsm.ListSessions() {
+		if session.RemoteAddr == joinConn.LocalAddr().String() {
+			joinSessionId = session.Id
+		}
+	}
+
+	serveAdmin(t, admin, http.MethodPost, "/admin/sessions/"+joinSessionId+"/kick", `{"reason":"abuse"}`, http.StatusNoContent)
+
+	msg := expectAdminClose[mc.RespAdminAction](t, joinConn, mc.CodeSessionKicked)
+	if msg.Payload.Reason != "abuse" {
+		t.Fatalf("unexpected reason: %s", msg.Payload.Reason)
+	}
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerDisconnected)
+
+	if _, err := bgm.FetchGame(gameUuid); err == nil {
+		t.Fatal("expected the game of the kicked session to be terminated")
+	}
+	serveAdmin(t, admin, http.MethodPost, "/admin/sessions/"+joinSessionId+"/kick", "", http.StatusNotFound)
+}
+
+func TestAdminTerminateGame(t *testing.T) {
+	bsm := mc.NewBattleshipSessionManager()
+	bgm := mb.NewBattleshipGameManager()
+	wsUrl := startTestServer(t, api.NewRequestProcessor(bsm, bgm, nil))
+	admin := api.NewAdminHandler(bsm, bgm, nil, testAdminToken)
+
+	hostConn, joinConn, gameUuid := setupTestGame(t, wsUrl)
+
+	serveAdmin(t, admin, http.MethodDelete, "/admin/games/"+gameUuid, "", http.StatusNoContent)
+
+	for _, conn := range []*websocket.Conn{hostConn, joinConn} {
+		msg := expectAdminClose[mc.RespAdminAction](t, conn, mc.CodeGameTerminated)
+		if msg.Payload.Reason == "" {
+			t.Fatal("expected the default reason")
+		}
+	}
+	if _, err := bgm.FetchGame(gameUuid); err == nil {
+		t.Fatal("expected the game to be terminated")
+	}
+	serveAdmin(t, admin, http.MethodDelete, "/admin/games/"+gameUuid, "", http.StatusNotFound)
+}
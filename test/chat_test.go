@@ -0,0 +1,86 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/saeidalz13/battleship-backend/api"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+func TestChat(t *testing.T) {
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil).
+		WithChatConfig(api.ChatConfig{MaxLength: 20, MessagesPerSecond: 0.001, MessageBurst: 3, BlockedWords: []string{"noob"}})
+	wsUrl := startTestServer(t, rp)
+
+	// Nobody to talk to yet
+	lonelyConn, _ := dialSession(t, wsUrl)
+	writeMessage(t, lonelyConn, mc.Message[mc.ReqChat]{Code: mc.CodeChat, Payload: mc.ReqChat{Text: "hello?"}})
+	expectErrCode(t, readMessage[mc.RespChat](t, lonelyConn, mc.CodeChat), cerr.ErrCodeNoOpponent)
+
+	hostConn, joinConn, _ := setupTestGame(t, wsUrl)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqChat]{Code: mc.CodeChat, RequestId: "chat-1", Payload: mc.ReqChat{Text: "  you NOOB!  "}})
+	respChat := readMessage[mc.RespChat](t, hostConn, mc.CodeChat)
+	if respChat.RequestId != "chat-1" || respChat.Payload.Text != "you ****!" {
+		t.Fatalf("unexpected chat response: %+v", respChat)
+	}
+	pushedChat := readMessage[mc.RespChat](t, joinConn, mc.CodeChat)
+	if pushedChat.Payload.Text != "you ****!" || pushedChat.Seq == 0 || pushedChat.RequestId != "" {
+		t.Fatalf("unexpected pushed chat: %+v", pushedChat)
+	}
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqChat]{Code: mc.CodeChat, Payload: mc.ReqChat{Text: "this is way too long for the limit"}})
+	expectErrCode(t, readMessage[mc.RespChat](t, hostConn, mc.CodeChat), cerr.ErrCodeChatTooLong)
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqEmote]{Code: mc.CodeEmote, Payload: mc.ReqEmote{EmoteId: 255}})
+	expectErrCode(t, readMessage[mc.RespEmote](t, joinConn, mc.CodeEmote), cerr.ErrCodeEmoteUnknown)
+
+	// Muted messages are acknowledged but never arrive
+	writeMessage(t, joinConn, mc.Message[mc.ReqMuteOpponent]{Code: mc.CodeMuteOpponent, Payload: mc.ReqMuteOpponent{Muted: true}})
+	readMessage[mc.RespMuteOpponent](t, joinConn, mc.CodeMuteOpponent)
+	writeMessage(t, hostConn, mc.Message[mc.ReqChat]{Code: mc.CodeChat, Payload: mc.ReqChat{Text: "can you hear me"}})
+	readMessage[mc.RespChat](t, hostConn, mc.CodeChat)
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqMuteOpponent]{Code: mc.CodeMuteOpponent, Payload: mc.ReqMuteOpponent{Muted: false}})
+	readMessage[mc.RespMuteOpponent](t, joinConn, mc.CodeMuteOpponent)
+	writeMessage(t, hostConn, mc.Message[mc.ReqEmote]{Code: mc.CodeEmote, Payload: mc.ReqEmote{EmoteId: 1}})
+	readMessage[mc.RespEmote](t, hostConn, mc.CodeEmote)
+	pushedEmote := readMessage[mc.RespEmote](t, joinConn, mc.CodeEmote)
+	if pushedEmote.Payload.Key != "good_game" || pushedEmote.Seq != pushedChat.Seq+1 {
+		t.Fatalf("unexpected pushed emote: %+v", pushedEmote)
+	}
+
+	// The burst of 3 is used up by the chat, the muted one and the emote;
+	// rejected messages are not charged
+	writeMessage(t, hostConn, mc.Message[mc.ReqChat]{Code: mc.CodeChat, Payload: mc.ReqChat{Text: "one more"}})
+	expectErrCode(t, readMessage[mc.RespChat](t, hostConn, mc.CodeChat), cerr.ErrCodeChatRateLimited)
+
+	// Both are in the replay log of the receiver
+	writeMessage(t, joinConn, mc.Message[mc.ReqReplayEvents]{Code: mc.CodeReplayEvents, Payload: mc.ReqReplayEvents{LastSeq: pushedChat.Seq - 1}})
+	readMessage[mc.RespChat](t, joinConn, mc.CodeChat)
+	readMessage[mc.RespEmote](t, joinConn, mc.CodeEmote)
+	if respReplay := readMessage[mc.RespReplayEvents](t, joinConn, mc.CodeReplayEvents); respReplay.Payload.Replayed != 2 {
+		t.Fatalf("expected 2 replayed events, got: %+v", respReplay.Payload)
+	}
+}
+
+func TestWordListFilter(t *testing.T) {
+	filter := api.NewWordListFilter([]string{"darn", " Heck "})
+
+	tests := map[string]string{
+		"darn it":          "**** it",
+		"DARN, heck!":      "****, ****!",
+		"darning is fine":  "darning is fine",
+		"oh heck-darn":     "oh ****-****",
+		"héck is not heck": "héck is not ****",
+		"nothing to see":   "nothing to see",
+		"":                 "",
+	}
+	for text, expected := range tests {
+		if filtered := filter.Filter(text); filtered != expected {
+			t.Errorf("filter(%q) = %q, expected %q", text, filtered, expected)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/saeidalz13/battleship-backend/api"
+	"github.com/saeidalz13/battleship-backend/db"
+	"github.com/saeidalz13/battleship-backend/db/sqlc"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+// A server of its own that shares the bus and the registry
+// with the other nodes of the test
+func startTestNode(t *testing.T, bus mc.MessageBus, registry mb.GameRegistry, nodeId string) (string, *mc.BattleshipSessionManager, *mb.BattleshipGameManager) {
+	t.Helper()
+
+	bgm := mb.NewBattleshipGameManager().WithGameRegistry(registry, nodeId)
+	bsm := mc.NewBattleshipSessionManager().WithMessageBus(bus, nodeId)
+	rp := api.NewRequestProcessor(bsm, bgm, nil)
+	if err := rp.ServeMessageBus(bus); err != nil {
+		t.Fatal(err)
+	}
+	return startTestServer(t, rp), bsm, bgm
+}
+
+func TestClusterCrossNodeGame(t *testing.T) {
+	bus, registry := mc.NewInProcessBus(), mb.NewMemoryGameRegistry()
+	t.Cleanup(func() { bus.Close() })
+	wsUrlA, _, bgmA := startTestNode(t, bus, registry, "node-a")
+	wsUrlB, bsmB, bgmB := startTestNode(t, bus, registry, "node-b")
+
+	hostConn, _ := dialSession(t, wsUrlA)
+	joinConn, _ := dialSession(t, wsUrlB)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy}})
+	gameUuid := readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame).Payload.GameUuid
+	if owner, err := bgmB.GameOwner(gameUuid); err != nil || owner != "node-a" {
+		t.Fatalf("expected node-a to own the game, got: %q (%v)", owner, err)
+	}
+
+	// The join request reaches node-b, which relays it
+	writeMessage(t, joinConn, mc.Message[mc.ReqJoinGame]{Code: mc.CodeJoinGame, RequestId: "join-1", Payload: mc.ReqJoinGame{GameUuid: gameUuid}})
+	respJoin := readMessage[mc.RespJoinGame](t, joinConn, mc.CodeJoinGame)
+	if respJoin.RequestId != "join-1" || respJoin.Payload.GameUuid != gameUuid {
+		t.Fatalf("unexpected join response: %+v", respJoin)
+	}
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+
+	if bgmB.GameCount() != 0 {
+		t.Fatalf("expected the game to stay on node-a, node-b has %d", bgmB.GameCount())
+	}
+	game, err := bgmA.FetchGame(gameUuid)
+	if err != nil || game.JoinPlayer() == nil {
+		t.Fatalf("expected the join player on node-a: %v", err)
+	}
+	if bsmB.SessionCount() != 1 {
+		t.Fatalf("expected the relayed session on node-b, got %d sessions", bsmB.SessionCount())
+	}
+
+	readyTestGame(t, hostConn, joinConn)
+	playTestGameToHostWin(t, hostConn, joinConn)
+
+	// Leaving on node-a closes the relayed client on node-b
+	writeMessage(t, hostConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCallRejected))
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeRematchCallRejected)
+	writeMessage(t, joinConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCallRejected))
+	if _, _, err := joinConn.ReadMessage(); err == nil {
+		t.Fatal("expected the relayed conn to be closed")
+	}
+	if _, err := registry.GameOwner(context.Background(), gameUuid); cerr.CodeOf(err) != cerr.ErrCodeGameNotExists {
+		t.Fatalf("expected the game to be unregistered, got: %v", err)
+	}
+}
+
+func TestClusterCommunicateOverBus(t *testing.T) {
+	bus, registry := mc.NewInProcessBus(), mb.NewMemoryGameRegistry()
+	t.Cleanup(func() { bus.Close() })
+	_, bsmA, _ := startTestNode(t, bus, registry, "node-a")
+	wsUrlB, _, _ := startTestNode(t, bus, registry, "node-b")
+
+	conn, respSessionId := dialSession(t, wsUrlB)
+
+	if err := bsmA.Communicate("sender", respSessionId.SessionID, mc.NewMessage[mc.NoPayload](mc.CodeOtherPlayerReconnected), mc.MessageTypeJSON); err != nil {
+		t.Fatal(err)
+	}
+	event := readMessage[mc.NoPayload](t, conn, mc.CodeOtherPlayerReconnected)
+	if event.Seq != 1 {
+		t.Fatalf("expected the event to be stamped by node-b, got seq %d", event.Seq)
+	}
+
+	// Without a bus the session must be local
+	err := mc.NewBattleshipSessionManager().Communicate("sender", respSessionId.SessionID, mc.NewMessage[mc.NoPayload](mc.CodeOtherPlayerReconnected), mc.MessageTypeJSON)
+	if cerr.CodeOf(err) != cerr.ErrCodeSessionNotFound {
+		t.Fatalf("expected error code: %d\tgot: %v", cerr.ErrCodeSessionNotFound, err)
+	}
+}
+
+func TestPostgresGameRegistry(t *testing.T) {
+	psqlDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer psqlDb.Close()
+	registry := db.NewPostgresGameRegistry(sqlc.New(psqlDb))
+
+	mock.ExpectExec(`INSERT INTO game_owners`).
+		WithArgs("a1b2c3", "node-a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := registry.RegisterGame(context.Background(), "a1b2c3", "node-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT node_id FROM game_owners WHERE game_uuid = \$1`).
+		WithArgs("a1b2c3").
+		WillReturnRows(sqlmock.NewRows([]string{"node_id"}).AddRow("node-a"))
+	if owner, err := registry.GameOwner(context.Background(), "a1b2c3"); err != nil || owner != "node-a" {
+		t.Fatalf("expected node-a, got: %q (%v)", owner, err)
+	}
+
+	mock.ExpectQuery(`SELECT node_id FROM game_owners WHERE game_uuid = \$1`).
+		WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+	if _, err := registry.GameOwner(context.Background(), "missing"); cerr.CodeOf(err) != cerr.ErrCodeGameNotExists {
+		t.Fatalf("expected error code: %d\tgot: %v", cerr.ErrCodeGameNotExists, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations were not met: %v", err)
+	}
+}
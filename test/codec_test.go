@@ -0,0 +1,367 @@
+package test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+	mt "github.com/saeidalz13/battleship-backend/models/tournament"
+)
+
+// go test ./test -run TestCodec -update
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of codec tests")
+
+var testCodecs = []mc.Codec{mc.JSONCodec{}, mc.MsgpackCodec{}}
+
+// Encodes the msg, compares it to its golden file and
+// decodes it back to make sure nothing is lost on the way
+func testCodecRoundTrip[T any](t *testing.T, name string, msg mc.Message[T]) {
+	t.Helper()
+
+	for _, codec := range testCodecs {
+		t.Run(codec.Subprotocol()+"/"+name, func(t *testing.T) {
+			encoded, err := codec.Marshal(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenPath := filepath.Join("testdata", codec.Subprotocol(), name+".golden")
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(goldenPath), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(goldenPath, encoded, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			golden, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(encoded, golden) {
+				t.Fatalf("encoded msg does not match %s\nexpected: %q\ngot: %q", goldenPath, golden, encoded)
+			}
+
+			var decoded mc.Message[T]
+			if err := codec.Unmarshal(golden, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, msg) {
+				t.Fatalf("expected decoded msg: %+v\ngot: %+v", msg, decoded)
+			}
+		})
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	grid := mb.NewGrid(mb.GridSizeEasy)
+	grid[0][1] = mb.PositionStateDefenceDestroyer
+	grid[0][2] = mb.PositionStateDefenceDestroyer
+
+	withError := mc.NewMessage[mc.RespAttack](mc.CodeAttack)
+	withError.AddError(cerr.ErrXorYOutOfGridBound(outOfGridBoundNum, 0), cerr.ConstErrAttack)
+	testCodecRoundTrip(t, "resp_attack_error", withError.WithRequestId("req-1"))
+
+	testCodecRoundTrip(t, "no_payload_event", mc.Message[mc.NoPayload]{Code: mc.CodeOtherPlayerGracePeriod, Seq: 42})
+
+	testCodecRoundTrip(t, "req_create_game", mc.Message[mc.ReqCreateGame]{
+		Code:      mc.CodeCreateGame,
+		RequestId: "req-2",
+		Payload:   mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyHard, BestOf: 3, FirstTurn: mb.FirstTurnRandom, SpecialWeapons: true, Disclosure: mb.DisclosureCallOut},
+	})
+
+	testCodecRoundTrip(t, "req_ready_player", mc.Message[mc.ReqReadyPlayer]{
+		Code:    mc.CodeReady,
+		Payload: mc.ReqReadyPlayer{GameUuid: "abc123", PlayerUuid: "0123456789", DefenceGrid: grid},
+	})
+
+	testCodecRoundTrip(t, "req_ready_player_placements", mc.Message[mc.ReqReadyPlayer]{
+		Code: mc.CodeReady,
+		Payload: mc.ReqReadyPlayer{Placements: []mb.Placement{
+			{ShipCode: mb.PositionStateDefenceDestroyer, X: 0, Y: 1, Orientation: mb.ShipHorizontal},
+		}},
+	})
+
+	testCodecRoundTrip(t, "resp_ready", mc.Message[mc.RespReady]{
+		Code:    mc.CodeReady,
+		Payload: mc.RespReady{DefenceGrid: grid},
+	})
+
+	testCodecRoundTrip(t, "req_join_game", mc.Message[mc.ReqJoinGame]{
+		Code:    mc.CodeJoinGame,
+		Payload: mc.ReqJoinGame{GameUuid: "abc123"},
+	})
+
+	testCodecRoundTrip(t, "req_attack", mc.Message[mc.ReqAttack]{
+		Code:    mc.CodeAttack,
+		Payload: mc.ReqAttack{GameUuid: "abc123", PlayerUuid: "0123456789", X: 3, Y: 5},
+	})
+
+	testCodecRoundTrip(t, "req_replay_events", mc.Message[mc.ReqReplayEvents]{
+		Code:    mc.CodeReplayEvents,
+		Payload: mc.ReqReplayEvents{LastSeq: 7},
+	})
+
+	testCodecRoundTrip(t, "resp_session_id", mc.Message[mc.RespSessionId]{
+		Code:    mc.CodeSessionID,
+		Payload: mc.RespSessionId{SessionID: "MjhkOTUzNWEtYjYxNC00MjM1"},
+	})
+
+	testCodecRoundTrip(t, "resp_create_game", mc.Message[mc.RespCreateGame]{
+		Code:    mc.CodeCreateGame,
+		Payload: mc.RespCreateGame{GameUuid: "abc123", HostUuid: "0123456789", BestOf: 3, FirstTurn: mb.FirstTurnRandom, SpecialWeapons: true, Disclosure: mb.DisclosureCallOut},
+	})
+
+	testCodecRoundTrip(t, "resp_join_game", mc.Message[mc.RespJoinGame]{
+		Code:    mc.CodeJoinGame,
+		Payload: mc.RespJoinGame{GameUuid: "abc123", PlayerUuid: "9876543210", GameDifficulty: mb.GameDifficultyNormal, BestOf: 3, FirstTurn: mb.FirstTurnRandom, SpecialWeapons: true, Disclosure: mb.DisclosureCallOut},
+	})
+
+	testCodecRoundTrip(t, "resp_attack", mc.Message[mc.RespAttack]{
+		Code: mc.CodeAttack,
+		Seq:  3,
+		Payload: mc.RespAttack{
+			X:                         0,
+			Y:                         2,
+			PositionState:             mb.PositionStateAttackGridHit,
+			IsTurn:                    true,
+			SunkenShipsHost:           0,
+			SunkenShipsJoin:           1,
+			DefenderSunkenShipsCoords: []mb.Coordinates{{X: 0, Y: 1}, {X: 0, Y: 2}},
+			ShipCode:                  mb.PositionStateDefenceDestroyer,
+		},
+	})
+
+	testCodecRoundTrip(t, "resp_end_game", mc.Message[mc.RespEndGame]{
+		Code: mc.CodeEndGame,
+		Payload: mc.RespEndGame{
+			PlayerMatchStatus: mb.PlayerMatchStatusWon,
+			Series:            &mc.RespSeries{BestOf: 3, Game: 3, HostWins: 2, JoinWins: 1, IsOver: true},
+		},
+	})
+
+	testCodecRoundTrip(t, "resp_rematch", mc.Message[mc.RespRematch]{
+		Code:    mc.CodeRematch,
+		Payload: mc.RespRematch{IsTurn: true, Series: &mc.RespSeries{BestOf: 5, Game: 2, JoinWins: 1}},
+	})
+
+	testCodecRoundTrip(t, "resp_replay_events", mc.Message[mc.RespReplayEvents]{
+		Code:    mc.CodeReplayEvents,
+		Payload: mc.RespReplayEvents{Replayed: 2, LastSeq: 9},
+	})
+
+	testCodecRoundTrip(t, "req_bomb", mc.Message[mc.ReqBomb]{
+		Code:    mc.CodeBomb,
+		Payload: mc.ReqBomb{X: 2, Y: 1},
+	})
+
+	testCodecRoundTrip(t, "req_torpedo", mc.Message[mc.ReqTorpedo]{
+		Code:    mc.CodeTorpedo,
+		Payload: mc.ReqTorpedo{Index: 3, Orientation: mb.TorpedoColumn},
+	})
+
+	testCodecRoundTrip(t, "req_sonar", mc.Message[mc.ReqSonar]{
+		Code:    mc.CodeSonar,
+		Payload: mc.ReqSonar{X: 4, Y: 4},
+	})
+
+	testCodecRoundTrip(t, "resp_special_attack", mc.Message[mc.RespSpecialAttack]{
+		Code: mc.CodeBomb,
+		Seq:  5,
+		Payload: mc.RespSpecialAttack{
+			Cells: []mc.RespAttackCell{
+				{X: 0, Y: 1, PositionState: mb.PositionStateAttackGridHit, ShipCode: mb.PositionStateDefenceDestroyer},
+				{X: 0, Y: 2, PositionState: mb.PositionStateAttackGridHit, ShipCode: mb.PositionStateDefenceDestroyer},
+				{X: 1, Y: 1, PositionState: mb.PositionStateAttackGridMiss},
+			},
+			IsTurn:                    true,
+			SunkenShipsHost:           1,
+			SunkenShipsJoin:           2,
+			DefenderSunkenShipsCoords: []mb.Coordinates{{X: 0, Y: 1}, {X: 0, Y: 2}},
+			Inventory:                 mb.Inventory{Torpedoes: 1, Sonars: 2},
+		},
+	})
+
+	testCodecRoundTrip(t, "resp_sonar", mc.Message[mc.RespSonar]{
+		Code:    mc.CodeSonar,
+		Payload: mc.RespSonar{X: 4, Y: 4, ShipDetected: true, IsTurn: true, Inventory: mb.Inventory{Bombs: 1, Torpedoes: 1, Sonars: 1}},
+	})
+
+	testCodecRoundTrip(t, "req_chat", mc.Message[mc.ReqChat]{
+		Code:    mc.CodeChat,
+		Payload: mc.ReqChat{Text: "good luck"},
+	})
+
+	testCodecRoundTrip(t, "resp_chat", mc.Message[mc.RespChat]{
+		Code:    mc.CodeChat,
+		Seq:     11,
+		Payload: mc.RespChat{Text: "good luck"},
+	})
+
+	testCodecRoundTrip(t, "req_emote", mc.Message[mc.ReqEmote]{
+		Code:    mc.CodeEmote,
+		Payload: mc.ReqEmote{EmoteId: 3},
+	})
+
+	testCodecRoundTrip(t, "resp_emote", mc.Message[mc.RespEmote]{
+		Code:    mc.CodeEmote,
+		Seq:     12,
+		Payload: mc.RespEmote{EmoteId: 3, Key: "nice_shot"},
+	})
+
+	testCodecRoundTrip(t, "req_mute_opponent", mc.Message[mc.ReqMuteOpponent]{
+		Code:    mc.CodeMuteOpponent,
+		Payload: mc.ReqMuteOpponent{Muted: true},
+	})
+
+	testCodecRoundTrip(t, "resp_mute_opponent", mc.Message[mc.RespMuteOpponent]{
+		Code:      mc.CodeMuteOpponent,
+		RequestId: "req-3",
+		Payload:   mc.RespMuteOpponent{Muted: true},
+	})
+
+	testCodecRoundTrip(t, "req_join_tournament_match", mc.Message[mc.ReqJoinTournamentMatch]{
+		Code:    mc.CodeJoinTournamentMatch,
+		Payload: mc.ReqJoinTournamentMatch{TournamentUuid: "t-abc123", SeatToken: "c2VhdC10b2tlbg"},
+	})
+
+	testCodecRoundTrip(t, "resp_join_tournament_match", mc.Message[mc.RespJoinTournamentMatch]{
+		Code: mc.CodeJoinTournamentMatch,
+		Payload: mc.RespJoinTournamentMatch{
+			TournamentUuid: "t-abc123",
+			MatchId:        2,
+			Round:          1,
+			Seed:           3,
+			GameUuid:       "abc123",
+			PlayerUuid:     "0123456789",
+			GameDifficulty: mb.GameDifficultyNormal,
+			IsHost:         true,
+			ResumeToken:    "eyJzaWQiOi",
+		},
+	})
+
+	testCodecRoundTrip(t, "resp_tournament_match_result", mc.Message[mc.RespTournamentMatchResult]{
+		Code:    mc.CodeTournamentMatchResult,
+		Seq:     14,
+		Payload: mc.RespTournamentMatchResult{TournamentUuid: "t-abc123", MatchId: 3, Winner: 1, DecidedBy: mt.DecidedByForfeit, Champion: 1},
+	})
+
+	testCodecRoundTrip(t, "req_tournament_standings", mc.Message[mc.ReqTournamentStandings]{
+		Code:    mc.CodeTournamentStandings,
+		Payload: mc.ReqTournamentStandings{TournamentUuid: "t-abc123"},
+	})
+
+	// Without a deadline: MessagePack timestamps carry no zone,
+	// so it would not come back in the location it was sent in
+	testCodecRoundTrip(t, "resp_tournament_standings", mc.Message[mc.RespTournamentStandings]{
+		Code: mc.CodeTournamentStandings,
+		Payload: mc.RespTournamentStandings{
+			Uuid:       "t-abc123",
+			Format:     mt.FormatSingleElimination,
+			Difficulty: mb.GameDifficultyEasy,
+			Status:     mt.StatusRunning,
+			Round:      2,
+			Entrants: []mt.EntrantStanding{
+				{Seed: 1, Name: "ada", Wins: 1},
+				{Seed: 2, Name: "bob", Losses: 1, Eliminated: true},
+			},
+			Matches: []mt.MatchStanding{
+				{Id: 1, Round: 1, SeedA: 1, SeedB: 2, Status: mt.MatchStatusFinished, Winner: 1, DecidedBy: mt.DecidedByPlay},
+				{Id: 2, Round: 2, SeedA: 1, Status: mt.MatchStatusScheduled},
+			},
+		},
+	})
+
+	testCodecRoundTrip(t, "resp_start_game", mc.Message[mc.RespStartGame]{
+		Code: mc.CodeStartGame,
+		Seq:  2,
+		Payload: mc.RespStartGame{
+			FirstTurn:   mb.FirstTurnRandom,
+			StarterUuid: "9876543210",
+			HostStarts:  false,
+			Inventory:   &mb.Inventory{Bombs: 1, Torpedoes: 1, Sonars: 2},
+		},
+	})
+
+	testCodecRoundTrip(t, "resp_server_shutting_down", mc.Message[mc.RespServerShuttingDown]{
+		Code:    mc.CodeServerShuttingDown,
+		Payload: mc.RespServerShuttingDown{DrainSeconds: 30, RetryAfterSeconds: 7},
+	})
+
+	testCodecRoundTrip(t, "resp_session_resumed", mc.Message[mc.RespSessionResumed]{
+		Code:    mc.CodeSessionResumed,
+		Payload: mc.RespSessionResumed{ResumeToken: "eyJzaWQiOi", ExpiresAt: 1714825800, LastSeq: 9},
+	})
+
+	testCodecRoundTrip(t, "resp_session_expired", mc.Message[mc.RespSessionExpired]{
+		Code:    mc.CodeSessionExpired,
+		Payload: mc.RespSessionExpired{Reason: mc.ExpiryReasonIdle},
+	})
+
+	testCodecRoundTrip(t, "resp_admin_action", mc.Message[mc.RespAdminAction]{
+		Code:    mc.CodeSessionKicked,
+		Payload: mc.RespAdminAction{Reason: "ended by an operator"},
+	})
+}
+
+func TestMsgpackSubprotocol(t *testing.T) {
+	msgpackDialer := websocket.Dialer{
+		HandshakeTimeout: dialer.HandshakeTimeout,
+		Subprotocols:     []string{mc.SubprotocolMsgpack},
+	}
+
+	conn, _, err := msgpackDialer.Dial(testWsUrl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if conn.Subprotocol() != mc.SubprotocolMsgpack {
+		t.Fatalf("expected subprotocol: %s\tgot: %s", mc.SubprotocolMsgpack, conn.Subprotocol())
+	}
+
+	codec := mc.MsgpackCodec{}
+	frameType, payload, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frameType != websocket.BinaryMessage {
+		t.Fatalf("expected binary frame, got: %d", frameType)
+	}
+
+	var respSessionId mc.Message[mc.RespSessionId]
+	if err := codec.Unmarshal(payload, &respSessionId); err != nil {
+		t.Fatal(err)
+	}
+	if respSessionId.Code != mc.CodeSessionID || respSessionId.Payload.SessionID == "" {
+		t.Fatalf("expected session id msg, got: %+v", respSessionId)
+	}
+
+	reqPayload, err := codec.Marshal(mc.NewMessage[mc.NoPayload](255).WithRequestId("bin-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, reqPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	_, payload, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var respInvalid mc.Message[mc.NoPayload]
+	if err := codec.Unmarshal(payload, &respInvalid); err != nil {
+		t.Fatal(err)
+	}
+	if respInvalid.Code != mc.CodeInvalidSignal || respInvalid.RequestId != "bin-1" {
+		t.Fatalf("expected invalid signal response to bin-1, got: %+v", respInvalid)
+	}
+}
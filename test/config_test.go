@@ -0,0 +1,148 @@
+package test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saeidalz13/battleship-backend/internal/config"
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+func testLookupEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func writeTestConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg, err := config.Load(nil, testLookupEnv(map[string]string{"STAGE": "dev"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Session != mc.DefaultSessionConfig() || cfg.Expiry != mc.DefaultExpiryConfig() || cfg.Game != mb.DefaultGameConfig() {
+		t.Fatalf("expected the defaults of the packages, got: %+v", cfg)
+	}
+	if cfg.Port != "1313" || cfg.ResumeTokenTTL != mc.DefaultResumeTokenTTL {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := writeTestConfigFile(t, `
+stage: prod
+port: "9000"
+session:
+  grace_period: 3m
+  max_retries: 4
+websocket:
+  allowed_origins: [https://a.example.com, https://b.example.com]
+game:
+  grid_size_hard: 10
+`)
+
+	env := map[string]string{
+		"CONFIG_FILE":          path,
+		"SESSION_GRACE_PERIOD": "4m",
+		"GAME_GRID_SIZE_HARD":  "11",
+		// Empty counts as unset
+		"PORT": "",
+	}
+	cfg, err := config.Load([]string{"-session.grace_period=5m", "-log.level=debug"}, testLookupEnv(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Stage != "prod" || cfg.Port != "9000" || cfg.Session.MaxRetries != 4 {
+		t.Fatalf("expected the values of the file, got: %+v", cfg)
+	}
+	if cfg.Game.GridSizeHard != 11 {
+		t.Fatalf("expected the env to win over the file, got: %d", cfg.Game.GridSizeHard)
+	}
+	if cfg.Session.GracePeriod != time.Minute*5 || cfg.Log.Level != slog.LevelDebug {
+		t.Fatalf("expected the flags to win, got: %s %s", cfg.Session.GracePeriod, cfg.Log.Level)
+	}
+	if strings.Join(cfg.Upgrader.AllowedOrigins, " ") != "https://a.example.com https://b.example.com" {
+		t.Fatalf("unexpected origins: %v", cfg.Upgrader.AllowedOrigins)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		args        []string
+		env         map[string]string
+		file        string
+		expectedErr string
+	}{
+		{name: "missing stage", expectedErr: "stage: must be either"},
+		{name: "invalid env", env: map[string]string{"STAGE": "dev", "WS_READ_LIMIT": "lots"}, expectedErr: "invalid env WS_READ_LIMIT for websocket.read_limit"},
+		{name: "invalid flag", args: []string{"-session.max_retries=300"}, env: map[string]string{"STAGE": "dev"}, expectedErr: "invalid flag for session.max_retries"},
+		{name: "unknown flag", args: []string{"-session.grace=1m"}, env: map[string]string{"STAGE": "dev"}, expectedErr: "flag provided but not defined"},
+		{name: "unknown file key", file: "stage: dev\nsession:\n  grace: 1m\n", expectedErr: "unknown key session.grace"},
+		{name: "out of range", args: []string{"-game.grid_size_easy=3", "-session.sweep_interval=0s"}, env: map[string]string{"STAGE": "dev"}, expectedErr: "session.sweep_interval: must be positive\ngame.grid_size_easy: must be between 4 and 16, got 3"},
+		{name: "game store without secret", env: map[string]string{"STAGE": "dev", "GAME_STORE": "postgres", "DATABASE_URL": "postgres://db/battleship"}, expectedErr: "game.store: postgres needs resume_token.secret"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			env := test.env
+			if env == nil {
+				env = map[string]string{}
+			}
+			if test.file != "" {
+				env["CONFIG_FILE"] = writeTestConfigFile(t, test.file)
+			}
+
+			_, err := config.Load(test.args, testLookupEnv(env))
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Fatalf("expected error containing %q, got: %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigLogRedactsSecrets(t *testing.T) {
+	env := map[string]string{
+		"STAGE":               "dev",
+		"DATABASE_URL":        "postgres://battleteam:hunter2@db:5432/battleship",
+		"RESUME_TOKEN_SECRET": "resume-secret",
+		"ADMIN_TOKEN":         "admin-secret",
+	}
+	cfg, err := config.Load(nil, testLookupEnv(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("effective config", "config", &cfg)
+
+	for _, secret := range []string{"hunter2", "resume-secret", "admin-secret"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Fatalf("secret %q was logged: %s", secret, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), "config.session.grace_period=2m0s") || !strings.Contains(buf.String(), "config.resume_token.ttl=1h0m0s") {
+		t.Fatalf("expected the settings in the log: %s", buf.String())
+	}
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/saeidalz13/battleship-backend/api"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+// The host hits the destroyer of testDefenceGridEasy twice,
+// which sinks it
+func TestAttackDisclosure(t *testing.T) {
+	destroyer := []mb.Coordinates{mb.NewCoordinates(0, 1), mb.NewCoordinates(0, 2)}
+
+	tests := []struct {
+		name       string
+		disclosure string
+		expectHit  mc.RespAttack
+		expectSink mc.RespAttack
+	}{
+		{
+			name:       "default",
+			disclosure: "",
+			expectHit:  mc.RespAttack{X: 0, Y: 1, PositionState: mb.PositionStateAttackGridHit},
+			expectSink: mc.RespAttack{X: 0, Y: 2, PositionState: mb.PositionStateAttackGridHit, SunkenShipsJoin: 1, DefenderSunkenShipsCoords: destroyer},
+		},
+		{
+			name:       "hide sinking",
+			disclosure: mb.DisclosureHideSinking,
+			expectHit:  mc.RespAttack{X: 0, Y: 1, PositionState: mb.PositionStateAttackGridHit},
+			expectSink: mc.RespAttack{X: 0, Y: 2, PositionState: mb.PositionStateAttackGridHit},
+		},
+		{
+			name:       "call out",
+			disclosure: mb.DisclosureCallOut,
+			expectHit:  mc.RespAttack{X: 0, Y: 1, PositionState: mb.PositionStateAttackGridHit, ShipCode: mb.PositionStateDefenceDestroyer},
+			expectSink: mc.RespAttack{X: 0, Y: 2, PositionState: mb.PositionStateAttackGridHit, SunkenShipsJoin: 1, DefenderSunkenShipsCoords: destroyer, ShipCode: mb.PositionStateDefenceDestroyer},
+		},
+	}
+
+	wsUrl := startTestServer(t, api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hostConn, joinConn, respCreateGame, respJoinGame := setupTestGameWithRules(t, wsUrl, mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy, Disclosure: test.disclosure})
+			expectedDisclosure := test.disclosure
+			if expectedDisclosure == "" {
+				expectedDisclosure = mb.DisclosureHit
+			}
+			if respCreateGame.Disclosure != expectedDisclosure || respJoinGame.Disclosure != expectedDisclosure {
+				t.Fatalf("expected disclosure %q, got: %+v %+v", expectedDisclosure, respCreateGame, respJoinGame)
+			}
+			readyTestGame(t, hostConn, joinConn)
+
+			writeMessage(t, hostConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 1}})
+			if hit := readMessage[mc.RespAttack](t, hostConn, mc.CodeAttack).Payload; !reflect.DeepEqual(hit, test.expectHit) {
+				t.Fatalf("expected: %+v\tgot: %+v", test.expectHit, hit)
+			}
+			readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack)
+			attackTestCell(t, joinConn, hostConn, 5, 5)
+
+			writeMessage(t, hostConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 2}})
+			if sink := readMessage[mc.RespAttack](t, hostConn, mc.CodeAttack).Payload; !reflect.DeepEqual(sink, test.expectSink) {
+				t.Fatalf("expected: %+v\tgot: %+v", test.expectSink, sink)
+			}
+
+			// The defender gets the same news
+			test.expectSink.IsTurn = true
+			if sink := readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack).Payload; !reflect.DeepEqual(sink, test.expectSink) {
+				t.Fatalf("expected: %+v\tgot: %+v", test.expectSink, sink)
+			}
+		})
+	}
+
+	hostConn, _ := dialSession(t, wsUrl)
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{Disclosure: "everything"}})
+	expectErrCode(t, readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame), cerr.ErrCodeInvalidDisclosure)
+}
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/saeidalz13/battleship-backend/api"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+func newFirstTurnTestGame(t *testing.T, bgm *mb.BattleshipGameManager, policy string) *mb.Game {
+	t.Helper()
+
+	game, err := bgm.CreateGame(mb.GameDifficultyEasy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := game.SetFirstTurnPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	game.CreateHostPlayer("host-session")
+	game.CreateJoinPlayer("join-session")
+	return game
+}
+
+// Ends the current game and starts the next one; returns
+// whether the host starts it
+func finishTestGame(t *testing.T, game *mb.Game, hostWins bool) bool {
+	t.Helper()
+
+	winner, loser := game.HostPlayer(), game.JoinPlayer()
+	if !hostWins {
+		winner, loser = loser, winner
+	}
+	winner.SetMatchStatusToWon()
+	loser.SetMatchStatusToLost()
+	game.RecordWin(hostWins)
+
+	if err := game.ResetRematchForGame(); err != nil {
+		t.Fatal(err)
+	}
+	if game.HostPlayer().IsTurn() == game.JoinPlayer().IsTurn() {
+		t.Fatal("exactly one player must have the turn")
+	}
+	return game.HostPlayer().IsTurn()
+}
+
+func TestFirstTurnPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		hostWins []bool
+		// The first game and every rematch
+		hostStarts []bool
+	}{
+		{
+			name:       "host",
+			policy:     mb.FirstTurnHost,
+			hostWins:   []bool{false, true},
+			hostStarts: []bool{true, true, true},
+		},
+		{
+			name:       "alternate",
+			policy:     mb.FirstTurnAlternate,
+			hostWins:   []bool{true, true, false},
+			hostStarts: []bool{true, false, true, false},
+		},
+		{
+			name:       "loser",
+			policy:     mb.FirstTurnLoser,
+			hostWins:   []bool{true, true, false},
+			hostStarts: []bool{true, false, false, true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := newFirstTurnTestGame(t, mb.NewBattleshipGameManager(), test.policy)
+
+			hostStarts := []bool{game.HostPlayer().IsTurn()}
+			for _, hostWins := range test.hostWins {
+				hostStarts = append(hostStarts, finishTestGame(t, game, hostWins))
+			}
+			for i := range hostStarts {
+				if hostStarts[i] != test.hostStarts[i] {
+					t.Fatalf("expected the host to start: %v\tgot: %v", test.hostStarts, hostStarts)
+				}
+			}
+		})
+	}
+}
+
+// The same seed gives the same starters, and both players
+// get to start now and then
+func TestFirstTurnRandom(t *testing.T) {
+	playGames := func() []bool {
+		game := newFirstTurnTestGame(t, mb.NewBattleshipGameManager().WithRandSeed(1313), mb.FirstTurnRandom)
+
+		hostStarts := []bool{game.HostStarts()}
+		for range 20 {
+			hostStarts = append(hostStarts, finishTestGame(t, game, true))
+		}
+		return hostStarts
+	}
+
+	first, second := playGames(), playGames()
+	hostStartCount := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same starters for the same seed:\n%v\n%v", first, second)
+		}
+		if first[i] {
+			hostStartCount++
+		}
+	}
+	if hostStartCount == 0 || hostStartCount == len(first) {
+		t.Fatalf("expected both players to start some games, got: %v", first)
+	}
+}
+
+func TestFirstTurnAnnounced(t *testing.T) {
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil).
+		WithRateLimitConfig(api.RateLimitConfig{})
+	wsUrl := startTestServer(t, rp)
+
+	hostConn, _ := dialSession(t, wsUrl)
+	joinConn, _ := dialSession(t, wsUrl)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy, FirstTurn: "coin"}})
+	respCreateGame := readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame)
+	expectErrCode(t, respCreateGame, cerr.ErrCodeInvalidFirstTurnPolicy)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy, FirstTurn: mb.FirstTurnLoser}})
+	respCreateGame = readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame)
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqJoinGame]{Code: mc.CodeJoinGame, Payload: mc.ReqJoinGame{GameUuid: respCreateGame.Payload.GameUuid}})
+	respJoinGame := readMessage[mc.RespJoinGame](t, joinConn, mc.CodeJoinGame)
+	if respJoinGame.Payload.FirstTurn != mb.FirstTurnLoser {
+		t.Fatalf("expected first turn policy %q, got: %+v", mb.FirstTurnLoser, respJoinGame.Payload)
+	}
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+
+	startGame := readyTestGame(t, hostConn, joinConn)
+	expected := mc.RespStartGame{FirstTurn: mb.FirstTurnLoser, StarterUuid: respCreateGame.Payload.HostUuid, HostStarts: true}
+	if startGame != expected {
+		t.Fatalf("expected start: %+v\tgot: %+v", expected, startGame)
+	}
+	playTestGameToHostWin(t, hostConn, joinConn)
+
+	// The join player lost, so they start the rematch although they accepted it
+	_, joinRematch := rematchTestGame(t, hostConn, joinConn)
+	if !joinRematch.IsTurn {
+		t.Fatalf("expected the join player to start the rematch, got: %+v", joinRematch)
+	}
+	startGame = readyTestGame(t, hostConn, joinConn)
+	expected = mc.RespStartGame{FirstTurn: mb.FirstTurnLoser, StarterUuid: respJoinGame.Payload.PlayerUuid}
+	if startGame != expected {
+		t.Fatalf("expected start: %+v\tgot: %+v", expected, startGame)
+	}
+}
@@ -0,0 +1,250 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/saeidalz13/battleship-backend/api"
+	"github.com/saeidalz13/battleship-backend/db"
+	"github.com/saeidalz13/battleship-backend/db/sqlc"
+	"github.com/saeidalz13/battleship-backend/internal/clock"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	"github.com/saeidalz13/battleship-backend/internal/token"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+// SavedAt is set by the game manager, not by the game
+func snapshotWithoutSavedAt(snapshot mb.GameSnapshot) mb.GameSnapshot {
+	snapshot.SavedAt = time.Time{}
+	return snapshot
+}
+
+func TestGameStoreRestore(t *testing.T) {
+	store := mb.NewMemoryGameStore()
+	bgm := mb.NewBattleshipGameManager().WithGameStore(store)
+	wsUrl := startTestServer(t, api.NewRequestProcessor(mc.NewBattleshipSessionManager(), bgm, nil))
+
+	hostConn, joinConn, gameUuid := setupTestGame(t, wsUrl)
+	readyTestGame(t, hostConn, joinConn)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 0}})
+	readMessage[mc.RespAttack](t, hostConn, mc.CodeAttack)
+	readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack)
+
+	game, err := bgm.FetchGame(gameUuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := store.LoadGame(context.Background(), gameUuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Phase != mb.GamePhaseInProgress || saved.StartedAt.IsZero() {
+		t.Fatalf("expected a started game in progress, got phase %s started at %v", saved.Phase, saved.StartedAt)
+	}
+	if !reflect.DeepEqual(snapshotWithoutSavedAt(saved), game.Snapshot()) {
+		t.Fatalf("the saved snapshot is behind the game:\n%+v\n%+v", saved, game.Snapshot())
+	}
+
+	restoredBgm := mb.NewBattleshipGameManager().WithGameStore(store)
+	restored, err := restoredBgm.RestoreGames(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != 1 {
+		t.Fatalf("expected 1 restored game, got: %d", restored)
+	}
+
+	restoredGame, err := restoredBgm.FetchGame(gameUuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restoredGame.Snapshot(), game.Snapshot()) {
+		t.Fatalf("restored game differs:\n%+v\n%+v", restoredGame.Snapshot(), game.Snapshot())
+	}
+	if restoredBgm.GamesInProgress() != 1 {
+		t.Fatalf("expected the restored game to be in progress")
+	}
+}
+
+func TestGameStoreTerminate(t *testing.T) {
+	store := mb.NewMemoryGameStore()
+	bgm := mb.NewBattleshipGameManager().WithGameStore(store)
+
+	terminated, _ := bgm.CreateGame(mb.GameDifficultyEasy)
+	bgm.SaveGame(terminated)
+	bgm.TerminateGame(terminated.Uuid())
+	if _, err := store.LoadGame(context.Background(), terminated.Uuid()); cerr.CodeOf(err) != cerr.ErrCodeGameNotExists {
+		t.Fatalf("expected the snapshot of a terminated game to be deleted, got: %v", err)
+	}
+
+	// Like on shutdown
+	preserved, _ := bgm.CreateGame(mb.GameDifficultyEasy)
+	bgm.SaveGame(preserved)
+	bgm.PreserveSnapshots()
+	bgm.TerminateGame(preserved.Uuid())
+	if _, err := store.LoadGame(context.Background(), preserved.Uuid()); err != nil {
+		t.Fatalf("expected the snapshot to be preserved, got: %v", err)
+	}
+}
+
+func TestGameStoreRestoreMaxAge(t *testing.T) {
+	store := mb.NewMemoryGameStore()
+	clk := clock.NewFake(time.Now())
+	cfg := mb.DefaultGameConfig()
+	cfg.RestoreMaxAge = time.Minute
+
+	bgm := mb.NewBattleshipGameManager().WithClock(clk).WithGameStore(store)
+	stale, _ := bgm.CreateGame(mb.GameDifficultyEasy)
+	bgm.SaveGame(stale)
+	clk.Advance(time.Minute)
+	fresh, _ := bgm.CreateGame(mb.GameDifficultyEasy)
+	bgm.SaveGame(fresh)
+	clk.Advance(time.Second)
+
+	restoredBgm := mb.NewBattleshipGameManager().WithClock(clk).WithGameConfig(cfg).WithGameStore(store)
+	restored, err := restoredBgm.RestoreGames(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != 1 {
+		t.Fatalf("expected 1 restored game, got: %d", restored)
+	}
+	if _, err := store.LoadGame(context.Background(), stale.Uuid()); cerr.CodeOf(err) != cerr.ErrCodeGameNotExists {
+		t.Fatalf("expected the stale snapshot to be deleted, got: %v", err)
+	}
+	if _, err := restoredBgm.FetchGame(fresh.Uuid()); err != nil {
+		t.Fatalf("expected the fresh snapshot to be restored, got: %v", err)
+	}
+}
+
+func TestPostgresGameStore(t *testing.T) {
+	psqlDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer psqlDb.Close()
+	store := db.NewPostgresGameStore(sqlc.New(psqlDb))
+
+	game, _ := mb.NewBattleshipGameManager().CreateGame(mb.GameDifficultyNormal)
+	game.CreateHostPlayer("host-session")
+	snapshot := game.Snapshot()
+	snapshotJson, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`INSERT INTO game_snapshots`).
+		WithArgs(game.Uuid(), mb.GamePhaseWaitingForOpponent, snapshotJson).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.SaveGame(context.Background(), snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT snapshot FROM game_snapshots WHERE phase <> 'finished'`).
+		WillReturnRows(sqlmock.NewRows([]string{"snapshot"}).AddRow(snapshotJson))
+	snapshots, err := store.ListUnfinishedGames(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || !reflect.DeepEqual(mb.RestoreGame(snapshots[0]).Snapshot(), game.Snapshot()) {
+		t.Fatalf("unexpected snapshots: %+v", snapshots)
+	}
+
+	mock.ExpectQuery(`SELECT snapshot FROM game_snapshots WHERE game_uuid = \$1`).
+		WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+	if _, err := store.LoadGame(context.Background(), "missing"); cerr.CodeOf(err) != cerr.ErrCodeGameNotExists {
+		t.Fatalf("expected error code: %d\tgot: %v", cerr.ErrCodeGameNotExists, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations were not met: %v", err)
+	}
+}
+
+// Serves the games of the store with a token secret that
+// survives restarts, like with GAME_STORE=postgres
+func startRestoringServer(t *testing.T, store mb.GameStore, clk clock.Clock) (string, api.RequestProcessor, *mb.BattleshipGameManager, *mc.BattleshipSessionManager) {
+	t.Helper()
+
+	bgm := mb.NewBattleshipGameManager().WithClock(clk).WithGameStore(store)
+	if _, err := bgm.RestoreGames(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	bsm := mc.NewBattleshipSessionManager().WithClock(clk).
+		WithResumeTokenSigner(token.NewSigner([]byte("test-secret"), time.Hour))
+	rp := api.NewRequestProcessor(bsm, bgm, nil)
+	return startTestServer(t, rp), rp, bgm, bsm
+}
+
+func TestRestoredGameResume(t *testing.T) {
+	store := mb.NewMemoryGameStore()
+	wsUrl, rp, _, _ := startRestoringServer(t, store, clock.Real())
+	hostConn, joinConn, hostToken, joinToken := setupResumableTestGame(t, wsUrl)
+	readyTestGame(t, hostConn, joinConn)
+
+	rp.Shutdown(context.Background(), api.ShutdownConfig{})
+
+	wsUrl, _, bgm, _ := startRestoringServer(t, store, clock.Real())
+	if bgm.GamesInProgress() != 1 {
+		t.Fatalf("expected the game to be restored in progress, got: %d", bgm.GamesInProgress())
+	}
+
+	hostConn, _ = resumeTestSession(t, wsUrl, hostConn, hostToken, false)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerGracePeriod)
+	joinConn, _ = resumeTestSession(t, wsUrl, joinConn, joinToken, false)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerReconnected)
+
+	// A token reclaims its session only once
+	expectResumeRejected(t, wsUrl, hostToken, cerr.ErrCodeResumeTokenReplayed)
+
+	hostEndGame, _ := playTestGameToWin(t, hostConn, joinConn)
+	if hostEndGame.PlayerMatchStatus != mb.PlayerMatchStatusWon {
+		t.Fatalf("expected the host to win the restored game, got: %+v", hostEndGame)
+	}
+}
+
+func TestRestoredGameUnclaimed(t *testing.T) {
+	store := mb.NewMemoryGameStore()
+	wsUrl, rp, oldBgm, _ := startRestoringServer(t, store, clock.Real())
+	hostConn, joinConn, hostToken, joinToken := setupResumableTestGame(t, wsUrl)
+	readyTestGame(t, hostConn, joinConn)
+
+	// Nobody comes back to this one
+	abandoned, _ := oldBgm.CreateGame(mb.GameDifficultyEasy)
+	abandoned.CreateHostPlayer("gone")
+	oldBgm.SaveGame(abandoned)
+
+	rp.Shutdown(context.Background(), api.ShutdownConfig{})
+
+	clk := clock.NewFake(time.Now())
+	wsUrl, _, bgm, bsm := startRestoringServer(t, store, clk)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go bsm.CleanupPeriodically(ctx, bgm)
+	clk.BlockUntil(1)
+
+	hostConn, _ = resumeTestSession(t, wsUrl, hostConn, hostToken, false)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerGracePeriod)
+	if bgm.GameCount() != 2 {
+		t.Fatalf("expected 2 restored games, got: %d", bgm.GameCount())
+	}
+
+	clk.Advance(mb.DefaultGameConfig().RestoreClaimWindow + time.Minute)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerDisconnected)
+	if bgm.GameCount() != 0 || bgm.GamesInProgress() != 0 {
+		t.Fatalf("expected the unclaimed games to be ended, got %d games, %d in progress", bgm.GameCount(), bgm.GamesInProgress())
+	}
+	if _, err := store.LoadGame(context.Background(), abandoned.Uuid()); cerr.CodeOf(err) != cerr.ErrCodeGameNotExists {
+		t.Fatalf("expected the snapshot of the unclaimed game to be deleted, got: %v", err)
+	}
+
+	expectResumeRejected(t, wsUrl, joinToken, cerr.ErrCodeSessionNotFound)
+}
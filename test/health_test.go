@@ -0,0 +1,107 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/saeidalz13/battleship-backend/api"
+	"github.com/saeidalz13/battleship-backend/internal/clock"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+func serveHealth[T any](t *testing.T, handler http.HandlerFunc, expectedStatus int) T {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != expectedStatus {
+		t.Fatalf("expected status %d, got %d: %s", expectedStatus, rec.Code, rec.Body.String())
+	}
+
+	var resp T
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestHealthz(t *testing.T) {
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil)
+
+	resp := serveHealth[api.RespHealth](t, rp.HandleHealthz, http.StatusOK)
+	if resp.Status != api.LivenessOk {
+		t.Fatalf("unexpected status: %s", resp.Status)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil).WithDBPinger(db)
+
+	t.Run("db reachable", func(t *testing.T) {
+		mock.ExpectPing()
+		resp := serveHealth[api.RespHealth](t, rp.HandleReadyz, http.StatusOK)
+		if resp.Status != api.ReadinessReady {
+			t.Fatalf("unexpected status: %s", resp.Status)
+		}
+	})
+
+	t.Run("db unreachable", func(t *testing.T) {
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		resp := serveHealth[api.RespHealth](t, rp.HandleReadyz, http.StatusServiceUnavailable)
+		if resp.Status != api.ReadinessDbUnavailable {
+			t.Fatalf("unexpected status: %s", resp.Status)
+		}
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		// No games or sessions, so it returns right away
+		rp.Shutdown(context.Background(), api.ShutdownConfig{})
+
+		resp := serveHealth[api.RespHealth](t, rp.HandleReadyz, http.StatusServiceUnavailable)
+		if resp.Status != api.ReadinessDraining {
+			t.Fatalf("unexpected status: %s", resp.Status)
+		}
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	bgm := mb.NewBattleshipGameManager()
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), bgm, nil).WithClock(clk)
+	wsUrl := startTestServer(t, rp)
+
+	hostConn, joinConn, _ := setupTestGame(t, wsUrl)
+	readyTestGame(t, hostConn, joinConn)
+	if _, err := bgm.CreateGame(mb.GameDifficultyHard); err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(90 * time.Second)
+
+	resp := serveHealth[api.RespStatus](t, rp.HandleStatus, http.StatusOK)
+	if resp.Version == "" || resp.Commit == "" {
+		t.Fatalf("expected build info, got: %+v", resp)
+	}
+	if resp.ActiveSessions != 2 || resp.ActiveGames != 2 || resp.GamesInProgress != 1 || resp.Draining {
+		t.Fatalf("unexpected status: %+v", resp)
+	}
+	if resp.UptimeSeconds != 90 {
+		t.Fatalf("expected uptime of 90 seconds, got: %d", resp.UptimeSeconds)
+	}
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/saeidalz13/battleship-backend/internal/logging"
+)
+
+func TestLoggingRedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Format: logging.FormatJSON, Level: slog.LevelDebug})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Info("reconnect", "resume_token", "eyJzaWQiOi.sig", "Authorization", "Bearer abc", logging.KeyGame, "abc123")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["resume_token"] != "[REDACTED]" || line["Authorization"] != "[REDACTED]" {
+		t.Fatalf("secrets were not redacted: %s", buf.String())
+	}
+	if line[logging.KeyGame] != "abc123" {
+		t.Fatalf("expected the game uuid to be kept, got: %s", buf.String())
+	}
+}
+
+func TestLoggingConfig(t *testing.T) {
+	if _, err := logging.New(&bytes.Buffer{}, logging.Config{Format: "xml"}); err == nil {
+		t.Fatal("expected an unknown format to be rejected")
+	}
+
+	level, err := logging.ParseLevel("warn")
+	if err != nil || level != slog.LevelWarn {
+		t.Fatalf("expected warn, got %v (%v)", level, err)
+	}
+	if _, err := logging.ParseLevel("loud"); err == nil {
+		t.Fatal("expected an unknown level to be rejected")
+	}
+}
+
+func TestLoggingHashId(t *testing.T) {
+	sessionId := "MjhkOTUzNWEtYjYxNC00MjM1LTk2YTgtZTRmMWEyYWNlYjIz"
+
+	hashed := logging.HashId(sessionId)
+	if hashed != logging.HashId(sessionId) {
+		t.Fatal("expected the hash to be stable")
+	}
+	if len(hashed) != 12 || strings.Contains(sessionId, hashed) {
+		t.Fatalf("unexpected hash: %s", hashed)
+	}
+}
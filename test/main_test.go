@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -54,15 +55,15 @@ func TestMain(m *testing.M) {
 		// querier := sqlc.New(db)
 		// testQuerier = querier
 
-		// test session manager
-		bsm := mc.NewBattleshipSessionManager()
-		testSessionManager = bsm
-		go bsm.CleanupPeriodically()
-
 		// test game manager
 		bgm := mb.NewBattleshipGameManager()
 		testGameManager = bgm
 
+		// test session manager
+		bsm := mc.NewBattleshipSessionManager()
+		testSessionManager = bsm
+		go bsm.CleanupPeriodically(context.Background(), bgm)
+
 		rp := api.NewRequestProcessor(bsm, bgm, nil)
 		testRp = rp
 
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/saeidalz13/battleship-backend/api"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+// The fleet of testDefenceGridEasy
+var testPlacementsEasy = []mb.Placement{
+	{ShipCode: mb.PositionStateDefenceDestroyer, X: 0, Y: 1, Orientation: mb.ShipHorizontal},
+	{ShipCode: mb.PositionStateDefenceCruiser, X: 1, Y: 0, Orientation: mb.ShipVertical},
+	{ShipCode: mb.PositionStateDefenceBattleship, X: 1, Y: 3, Orientation: mb.ShipVertical},
+}
+
+func TestExpandPlacements(t *testing.T) {
+	game, err := mb.NewBattleshipGameManager().CreateGame(mb.GameDifficultyEasy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grid, err := game.ExpandPlacements(testPlacementsEasy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(grid, testDefenceGridEasy) {
+		t.Fatalf("expected: %v\tgot: %v", testDefenceGridEasy, grid)
+	}
+
+	withPlacement := func(i int, placement mb.Placement) []mb.Placement {
+		placements := append([]mb.Placement{}, testPlacementsEasy...)
+		placements[i] = placement
+		return placements
+	}
+
+	tests := []struct {
+		name       string
+		placements []mb.Placement
+		expected   cerr.ErrCode
+	}{
+		{
+			name:       "unknown ship",
+			placements: withPlacement(0, mb.Placement{ShipCode: mb.PositionStateDefenceGridHit, X: 0, Y: 1, Orientation: mb.ShipHorizontal}),
+			expected:   cerr.ErrCodeInvalidShipCode,
+		},
+		{
+			name:       "diagonal",
+			placements: withPlacement(0, mb.Placement{ShipCode: mb.PositionStateDefenceDestroyer, X: 0, Y: 1, Orientation: "diagonal"}),
+			expected:   cerr.ErrCodeInvalidShipOrientation,
+		},
+		{
+			name:       "out of bounds",
+			placements: withPlacement(2, mb.Placement{ShipCode: mb.PositionStateDefenceBattleship, X: 3, Y: 3, Orientation: mb.ShipVertical}),
+			expected:   cerr.ErrCodeShipOutOfGridBound,
+		},
+		{
+			name:       "overlap",
+			placements: withPlacement(0, mb.Placement{ShipCode: mb.PositionStateDefenceDestroyer, X: 1, Y: 3, Orientation: mb.ShipHorizontal}),
+			expected:   cerr.ErrCodeShipsOverlap,
+		},
+		{
+			name:       "missing ship",
+			placements: testPlacementsEasy[:2],
+			expected:   cerr.ErrCodeShipMisplaced,
+		},
+		{
+			name:       "ship twice",
+			placements: withPlacement(1, mb.Placement{ShipCode: mb.PositionStateDefenceDestroyer, X: 5, Y: 0, Orientation: mb.ShipHorizontal}),
+			expected:   cerr.ErrCodeShipMisplaced,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := game.ExpandPlacements(test.placements)
+			if cerr.CodeOf(err) != test.expected {
+				t.Fatalf("expected error code: %d\tgot: %v", test.expected, err)
+			}
+		})
+	}
+}
+
+// The grid format goes through the same validator
+func TestValidateDefenceGrid(t *testing.T) {
+	game, err := mb.NewBattleshipGameManager().CreateGame(mb.GameDifficultyEasy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := game.ValidateDefenceGrid(testDefenceGridEasy); err != nil {
+		t.Fatal(err)
+	}
+
+	cloneGrid := func() mb.Grid {
+		grid := mb.NewGrid(mb.GridSizeEasy)
+		for i := range testDefenceGridEasy {
+			copy(grid[i], testDefenceGridEasy[i])
+		}
+		return grid
+	}
+
+	bentCruiser := cloneGrid()
+	bentCruiser[3][0], bentCruiser[2][1] = mb.PositionStateDefenceGridEmpty, mb.PositionStateDefenceCruiser
+	if err := game.ValidateDefenceGrid(bentCruiser); cerr.CodeOf(err) != cerr.ErrCodeShipMisplaced {
+		t.Fatalf("expected the bent cruiser to be rejected, got: %v", err)
+	}
+
+	withHit := cloneGrid()
+	withHit[5][5] = mb.PositionStateDefenceGridHit
+	if err := game.ValidateDefenceGrid(withHit); cerr.CodeOf(err) != cerr.ErrCodeDefenceGridInvalidPositionState {
+		t.Fatalf("expected the hit to be rejected, got: %v", err)
+	}
+}
+
+func TestReadyWithPlacements(t *testing.T) {
+	wsUrl := startTestServer(t, api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil))
+
+	// Before creating or joining a game
+	loneConn, _ := dialSession(t, wsUrl)
+	writeMessage(t, loneConn, mc.Message[mc.ReqReadyPlayer]{Code: mc.CodeReady, Payload: mc.ReqReadyPlayer{Placements: testPlacementsEasy}})
+	expectErrCode(t, readMessage[mc.RespReady](t, loneConn, mc.CodeReady), cerr.ErrCodeGameNotExists)
+
+	hostConn, joinConn, _ := setupTestGame(t, wsUrl)
+	writeMessage(t, hostConn, mc.Message[mc.ReqReadyPlayer]{Code: mc.CodeReady, Payload: mc.ReqReadyPlayer{Placements: testPlacementsEasy[:2]}})
+	expectErrCode(t, readMessage[mc.RespReady](t, hostConn, mc.CodeReady), cerr.ErrCodeShipMisplaced)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqReadyPlayer]{Code: mc.CodeReady, Payload: mc.ReqReadyPlayer{Placements: testPlacementsEasy}})
+	if respReady := readMessage[mc.RespReady](t, hostConn, mc.CodeReady); !reflect.DeepEqual(respReady.Payload.DefenceGrid, testDefenceGridEasy) {
+		t.Fatalf("expected the canonical grid, got: %+v", respReady)
+	}
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqReadyPlayer]{Code: mc.CodeReady, Payload: mc.ReqReadyPlayer{DefenceGrid: testDefenceGridEasy}})
+	readMessage[mc.RespReady](t, joinConn, mc.CodeReady)
+	readMessage[mc.RespStartGame](t, joinConn, mc.CodeStartGame)
+	readMessage[mc.RespStartGame](t, hostConn, mc.CodeStartGame)
+
+	// The expanded grid is the one being attacked
+	attackTestCell(t, hostConn, joinConn, 5, 5)
+	writeMessage(t, joinConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 1}})
+	readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack)
+	if respAttack := readMessage[mc.RespAttack](t, hostConn, mc.CodeAttack); respAttack.Payload.PositionState != mb.PositionStateAttackGridHit {
+		t.Fatalf("expected a hit, got: %+v", respAttack)
+	}
+}
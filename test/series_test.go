@@ -0,0 +1,150 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/saeidalz13/battleship-backend/api"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+// The caller sends the rematch call and the other player
+// accepts it; both players are at the grid selection after
+func rematchTestGame(t *testing.T, callerConn, accepterConn *websocket.Conn) (callerRematch, accepterRematch mc.RespRematch) {
+	t.Helper()
+
+	writeMessage(t, callerConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCall))
+	readMessage[mc.NoPayload](t, accepterConn, mc.CodeRematchCall)
+
+	writeMessage(t, accepterConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCallAccepted))
+	callerRematch = readMessage[mc.RespRematch](t, callerConn, mc.CodeRematch).Payload
+	accepterRematch = readMessage[mc.RespRematch](t, accepterConn, mc.CodeRematch).Payload
+	return callerRematch, accepterRematch
+}
+
+func expectSeries(t *testing.T, series *mc.RespSeries, expected mc.RespSeries) {
+	t.Helper()
+
+	if series == nil || *series != expected {
+		t.Fatalf("expected series: %+v\tgot: %+v", expected, series)
+	}
+}
+
+func TestSeries(t *testing.T) {
+	// Several games in a row are more than the message rate limit allows
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil).
+		WithRateLimitConfig(api.RateLimitConfig{})
+	wsUrl := startTestServer(t, rp)
+
+	hostConn, _ := dialSession(t, wsUrl)
+	joinConn, _ := dialSession(t, wsUrl)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy, BestOf: 4}})
+	respCreateGame := readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame)
+	expectErrCode(t, respCreateGame, cerr.ErrCodeInvalidSeriesLength)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy, BestOf: 3}})
+	respCreateGame = readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame)
+	if respCreateGame.Payload.BestOf != 3 {
+		t.Fatalf("expected best of 3, got: %+v", respCreateGame.Payload)
+	}
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqJoinGame]{Code: mc.CodeJoinGame, Payload: mc.ReqJoinGame{GameUuid: respCreateGame.Payload.GameUuid}})
+	if respJoinGame := readMessage[mc.RespJoinGame](t, joinConn, mc.CodeJoinGame); respJoinGame.Payload.BestOf != 3 {
+		t.Fatalf("expected best of 3, got: %+v", respJoinGame.Payload)
+	}
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+
+	// Game 1: the host starts and wins
+	readyTestGame(t, hostConn, joinConn)
+	hostEndGame, joinEndGame := playTestGameToWin(t, hostConn, joinConn)
+	expectSeries(t, hostEndGame.Series, mc.RespSeries{BestOf: 3, Game: 1, HostWins: 1})
+	expectSeries(t, joinEndGame.Series, mc.RespSeries{BestOf: 3, Game: 1, HostWins: 1})
+
+	// Game 2: the join player starts, even though the host called the rematch
+	hostRematch, joinRematch := rematchTestGame(t, hostConn, joinConn)
+	if hostRematch.IsTurn || !joinRematch.IsTurn {
+		t.Fatalf("expected the join player to start game 2, host: %+v join: %+v", hostRematch, joinRematch)
+	}
+	expectSeries(t, joinRematch.Series, mc.RespSeries{BestOf: 3, Game: 2, HostWins: 1})
+
+	readyTestGame(t, hostConn, joinConn)
+	joinEndGame, hostEndGame = playTestGameToWin(t, joinConn, hostConn)
+	expectSeries(t, hostEndGame.Series, mc.RespSeries{BestOf: 3, Game: 2, HostWins: 1, JoinWins: 1})
+
+	// Game 3: the host starts again and clinches the series
+	joinRematch, hostRematch = rematchTestGame(t, joinConn, hostConn)
+	if !hostRematch.IsTurn || joinRematch.IsTurn {
+		t.Fatalf("expected the host to start game 3, host: %+v join: %+v", hostRematch, joinRematch)
+	}
+
+	readyTestGame(t, hostConn, joinConn)
+	hostEndGame, joinEndGame = playTestGameToWin(t, hostConn, joinConn)
+	expectSeries(t, hostEndGame.Series, mc.RespSeries{BestOf: 3, Game: 3, HostWins: 2, JoinWins: 1, IsOver: true})
+	expectSeries(t, joinEndGame.Series, mc.RespSeries{BestOf: 3, Game: 3, HostWins: 2, JoinWins: 1, IsOver: true})
+
+	writeMessage(t, joinConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCall))
+	respRematchCall := readMessage[mc.NoPayload](t, joinConn, mc.CodeRematchCall)
+	expectErrCode(t, respRematchCall, cerr.ErrCodeSeriesOver)
+}
+
+// A single game has no series in its payloads and may be
+// rematched as often as wanted
+func TestSeriesSingleGame(t *testing.T) {
+	// Several games in a row are more than the message rate limit allows
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil).
+		WithRateLimitConfig(api.RateLimitConfig{})
+	wsUrl := startTestServer(t, rp)
+	hostConn, joinConn, _ := setupTestGame(t, wsUrl)
+
+	for range 2 {
+		readyTestGame(t, hostConn, joinConn)
+		hostEndGame, _ := playTestGameToWin(t, hostConn, joinConn)
+		if hostEndGame.Series != nil {
+			t.Fatalf("expected no series, got: %+v", hostEndGame.Series)
+		}
+
+		// The caller has the first turn
+		hostRematch, _ := rematchTestGame(t, hostConn, joinConn)
+		if !hostRematch.IsTurn || hostRematch.Series != nil {
+			t.Fatalf("expected the host to start without a series, got: %+v", hostRematch)
+		}
+	}
+}
+
+// A rejected accept is answered with an error and the
+// session lives on
+func TestAcceptRematchGuards(t *testing.T) {
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil).
+		WithRateLimitConfig(api.RateLimitConfig{})
+	wsUrl := startTestServer(t, rp)
+
+	loneConn, _ := dialSession(t, wsUrl)
+	writeMessage(t, loneConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCall))
+	expectErrCode(t, readMessage[mc.NoPayload](t, loneConn, mc.CodeRematchCall), cerr.ErrCodeGameNotExists)
+	writeMessage(t, loneConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCallAccepted))
+	expectErrCode(t, readMessage[mc.RespRematch](t, loneConn, mc.CodeRematch), cerr.ErrCodeGameNotExists)
+
+	hostConn, joinConn, _ := setupTestGame(t, wsUrl)
+	readyTestGame(t, hostConn, joinConn)
+
+	writeMessage(t, joinConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCallAccepted))
+	expectErrCode(t, readMessage[mc.RespRematch](t, joinConn, mc.CodeRematch), cerr.ErrCodeRematchNotCalled)
+
+	writeMessage(t, hostConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCall))
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeRematchCall)
+	writeMessage(t, joinConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCallAccepted))
+	expectErrCode(t, readMessage[mc.RespRematch](t, joinConn, mc.CodeRematch), cerr.ErrCodeGameNotFinished)
+
+	playTestGameToWin(t, hostConn, joinConn)
+
+	writeMessage(t, joinConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCallAccepted))
+	readMessage[mc.RespRematch](t, hostConn, mc.CodeRematch)
+	if joinRematch := readMessage[mc.RespRematch](t, joinConn, mc.CodeRematch); joinRematch.Error != nil {
+		t.Fatalf("expected the rematch to start, got: %+v", joinRematch.Error)
+	}
+}
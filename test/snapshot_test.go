@@ -0,0 +1,301 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+)
+
+// A game in any state, including ones no match would reach,
+// so that every field of the snapshot is exercised
+type randomGame struct {
+	*mb.Game
+}
+
+func (randomGame) Generate(r *rand.Rand, size int) reflect.Value {
+	gridSize := mb.MinGridSize + uint8(r.Intn(int(mb.MaxGridSize-mb.MinGridSize)+1))
+	snapshot := mb.GameSnapshot{
+		Uuid:                    randomString(r, 6),
+		Difficulty:              uint8(r.Intn(3)),
+		GridSize:                gridSize,
+		RematchAlreadyRequested: r.Intn(2) == 0,
+		BestOf:                  uint8(r.Intn(int(mb.SeriesLengthMax) + 1)),
+		HostWins:                uint8(r.Intn(int(mb.SeriesLengthMax) + 1)),
+		JoinWins:                uint8(r.Intn(int(mb.SeriesLengthMax) + 1)),
+		SeriesGame:              uint8(r.Intn(int(mb.SeriesLengthMax) + 1)),
+		FirstTurn:               []string{mb.FirstTurnHost, mb.FirstTurnRandom, mb.FirstTurnAlternate, mb.FirstTurnLoser}[r.Intn(4)],
+		HostStarts:              r.Intn(2) == 0,
+		SpecialWeapons:          r.Intn(2) == 0,
+		Disclosure:              []string{mb.DisclosureHideSinking, mb.DisclosureHit, mb.DisclosureCallOut}[r.Intn(3)],
+	}
+	if r.Intn(2) == 0 {
+		snapshot.StartedAt = time.Unix(r.Int63n(1<<32), r.Int63n(int64(time.Second))).UTC()
+	}
+	if r.Intn(10) > 0 {
+		host := randomPlayer(r, gridSize, true)
+		snapshot.HostPlayer = &host
+	}
+	if r.Intn(10) > 2 {
+		join := randomPlayer(r, gridSize, false)
+		snapshot.JoinPlayer = &join
+	}
+	return reflect.ValueOf(randomGame{mb.RestoreGame(snapshot)})
+}
+
+func randomPlayer(r *rand.Rand, gridSize uint8, isHost bool) mb.PlayerSnapshot {
+	player := mb.PlayerSnapshot{
+		Uuid:        randomString(r, 10),
+		SessionId:   randomString(r, 48),
+		IsHost:      isHost,
+		IsTurn:      r.Intn(2) == 0,
+		IsReady:     r.Intn(2) == 0,
+		MatchStatus: uint8(r.Intn(3)),
+		SunkenShips: uint8(r.Intn(4)),
+		AttackGrid:  randomGrid(r, gridSize, mb.PositionStateAttackGridHit),
+		DefenceGrid: randomGrid(r, gridSize, mb.PositionStateDefenceBattleship),
+		Inventory:   mb.Inventory{Bombs: uint8(r.Intn(2)), Torpedoes: uint8(r.Intn(2)), Sonars: uint8(r.Intn(3))},
+	}
+
+	for code, length := range map[uint8]uint8{mb.PositionStateDefenceDestroyer: 2, mb.PositionStateDefenceCruiser: 3, mb.PositionStateDefenceBattleship: 4} {
+		ship := mb.ShipSnapshot{Code: code, Length: length, Hits: uint8(r.Intn(int(length) + 1)), HitCoordinates: []mb.Coordinates{}}
+		for i := uint8(0); i < ship.Hits; i++ {
+			ship.HitCoordinates = append(ship.HitCoordinates, mb.NewCoordinates(uint8(r.Intn(int(gridSize))), uint8(r.Intn(int(gridSize)))))
+		}
+		player.Ships = append(player.Ships, ship)
+	}
+	return player
+}
+
+func randomGrid(r *rand.Rand, gridSize, maxState uint8) mb.SnapshotGrid {
+	grid := make(mb.SnapshotGrid, gridSize)
+	for i := range grid {
+		grid[i] = make([]uint8, gridSize)
+		for j := range grid[i] {
+			grid[i][j] = uint8(r.Intn(int(maxState) + 1))
+		}
+	}
+	return grid
+}
+
+func randomString(r *rand.Rand, length int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789-_"
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = letters[r.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	cfg := &quick.Config{MaxCount: 300}
+
+	t.Run("game binary", func(t *testing.T) {
+		roundTrip := func(g randomGame) bool {
+			encoded, err := g.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var restored mb.Game
+			if err := restored.UnmarshalBinary(encoded); err != nil {
+				t.Fatal(err)
+			}
+			reencoded, err := restored.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return bytes.Equal(encoded, reencoded)
+		}
+		if err := quick.Check(roundTrip, cfg); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("game json", func(t *testing.T) {
+		roundTrip := func(g randomGame) bool {
+			encoded, err := json.Marshal(g.Game)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var restored mb.Game
+			if err := json.Unmarshal(encoded, &restored); err != nil {
+				t.Fatal(err)
+			}
+			reencoded, err := json.Marshal(&restored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return bytes.Equal(encoded, reencoded)
+		}
+		if err := quick.Check(roundTrip, cfg); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("player", func(t *testing.T) {
+		roundTrip := func(g randomGame) bool {
+			player := g.HostPlayer()
+			if player == nil {
+				return true
+			}
+
+			encodedBinary, err := player.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			encodedJson, err := json.Marshal(player)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var fromBinary, fromJson mb.BattleshipPlayer
+			if err := fromBinary.UnmarshalBinary(encodedBinary); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(encodedJson, &fromJson); err != nil {
+				t.Fatal(err)
+			}
+			reencodedBinary, _ := fromBinary.MarshalBinary()
+			reencodedJson, _ := json.Marshal(&fromJson)
+			return bytes.Equal(encodedBinary, reencodedBinary) && bytes.Equal(encodedJson, reencodedJson)
+		}
+		if err := quick.Check(roundTrip, cfg); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ship", func(t *testing.T) {
+		roundTrip := func(length, hits uint8) bool {
+			ship := mb.NewShip(mb.PositionStateDefenceCruiser, length)
+			for i := uint8(0); i < hits; i++ {
+				ship.GotHit()
+			}
+
+			encoded, err := ship.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var restored mb.Ship
+			if err := restored.UnmarshalBinary(encoded); err != nil {
+				t.Fatal(err)
+			}
+			reencoded, _ := restored.MarshalBinary()
+			return bytes.Equal(encoded, reencoded) && restored.IsSunk() == ship.IsSunk()
+		}
+		if err := quick.Check(roundTrip, cfg); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// Version 1 was written by the game store before snapshots
+// had versions; its grid rows are base64 strings
+func TestSnapshotMigration(t *testing.T) {
+	v1Json, err := os.ReadFile("testdata/snapshot/game_v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fromJson mb.GameSnapshot
+	if err := json.Unmarshal(v1Json, &fromJson); err != nil {
+		t.Fatal(err)
+	}
+	if fromJson.Uuid != "a1b2c3" || fromJson.JoinPlayer == nil || fromJson.JoinPlayer.DefenceGrid[0][0] != mb.PositionStateDefenceGridHit {
+		t.Fatalf("unexpected migrated snapshot: %+v", fromJson)
+	}
+	if fromJson.HostPlayer.DefenceGrid[2][3] != mb.PositionStateDefenceBattleship {
+		t.Fatalf("unexpected migrated defence grid: %v", fromJson.HostPlayer.DefenceGrid)
+	}
+	if fromJson.BestOf != mb.SeriesLengthSingle || fromJson.FirstTurn != mb.FirstTurnHost || !fromJson.HostStarts {
+		t.Fatalf("expected a single game started by the host: %+v", fromJson)
+	}
+	if fromJson.SpecialWeapons || fromJson.HostPlayer.Inventory != mb.DefaultInventory() || fromJson.JoinPlayer.Inventory != mb.DefaultInventory() {
+		t.Fatalf("expected no special weapons and full inventories: %+v", fromJson)
+	}
+	if fromJson.Disclosure != mb.DisclosureHit {
+		t.Fatalf("expected disclosure %q, got: %q", mb.DisclosureHit, fromJson.Disclosure)
+	}
+
+	// Version 5 games only miss the disclosure
+	var fromV5 mb.GameSnapshot
+	if err := json.Unmarshal([]byte(`{"version":5,"snapshot":{"uuid":"a1b2c3","grid_size":6,"special_weapons":true}}`), &fromV5); err != nil {
+		t.Fatal(err)
+	}
+	if !fromV5.SpecialWeapons || fromV5.Disclosure != mb.DisclosureHit {
+		t.Fatalf("unexpected migrated version 5 snapshot: %+v", fromV5)
+	}
+
+	// The same document as an old binary snapshot
+	var doc map[string]any
+	if err := json.Unmarshal(v1Json, &doc); err != nil {
+		t.Fatal(err)
+	}
+	v1Msgpack, err := msgpack.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromBinary mb.GameSnapshot
+	if err := fromBinary.UnmarshalBinary(append(binary.BigEndian.AppendUint16(nil, 1), v1Msgpack...)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromBinary.HostPlayer, fromJson.HostPlayer) || !reflect.DeepEqual(fromBinary.JoinPlayer, fromJson.JoinPlayer) {
+		t.Fatalf("binary and json migrations differ:\n%+v\n%+v", fromBinary, fromJson)
+	}
+
+	// Written back in the latest version
+	migrated, err := json.Marshal(fromJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope struct {
+		Version uint16 `json:"version"`
+	}
+	if err := json.Unmarshal(migrated, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Version != mb.SnapshotVersion {
+		t.Fatalf("expected version %d, got: %d", mb.SnapshotVersion, envelope.Version)
+	}
+}
+
+// Players on their own are migrated too, e.g. when a
+// version 4 player without an inventory is read
+func TestPlayerSnapshotMigration(t *testing.T) {
+	v4Json := []byte(`{"version":4,"snapshot":{"uuid":"host123456","session_id":"host-session","is_host":true,"is_turn":true,"is_ready":true,"match_status":0,"sunken_ships":1,"attack_grid":[[0]],"defence_grid":[[2]],"ships":[]}}`)
+
+	var player mb.BattleshipPlayer
+	if err := json.Unmarshal(v4Json, &player); err != nil {
+		t.Fatal(err)
+	}
+	if player.Uuid() != "host123456" || player.SunkenShips() != 1 || player.Inventory() != mb.DefaultInventory() {
+		t.Fatalf("unexpected migrated player: %+v", player.Inventory())
+	}
+}
+
+func TestSnapshotVersionUnsupported(t *testing.T) {
+	var snapshot mb.GameSnapshot
+	err := json.Unmarshal([]byte(`{"version":65535,"snapshot":{}}`), &snapshot)
+	if cerr.CodeOf(err) != cerr.ErrCodeSnapshotVersionUnsupported {
+		t.Fatalf("expected error code: %d\tgot: %v", cerr.ErrCodeSnapshotVersionUnsupported, err)
+	}
+
+	err = snapshot.UnmarshalBinary(append(binary.BigEndian.AppendUint16(nil, mb.SnapshotVersion+1), 0x80))
+	if cerr.CodeOf(err) != cerr.ErrCodeSnapshotVersionUnsupported {
+		t.Fatalf("expected error code: %d\tgot: %v", cerr.ErrCodeSnapshotVersionUnsupported, err)
+	}
+
+	err = json.Unmarshal([]byte(`{"version":2,"snapshot":{"uuid":"a1b2c3","unknown":true}}`), &snapshot)
+	if cerr.CodeOf(err) != cerr.ErrCodeInvalidSnapshot {
+		t.Fatalf("expected error code: %d\tgot: %v", cerr.ErrCodeInvalidSnapshot, err)
+	}
+}
@@ -0,0 +1,369 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/websocket"
+
+	"github.com/saeidalz13/battleship-backend/api"
+	"github.com/saeidalz13/battleship-backend/db"
+	"github.com/saeidalz13/battleship-backend/db/sqlc"
+	"github.com/saeidalz13/battleship-backend/internal/clock"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+	mt "github.com/saeidalz13/battleship-backend/models/tournament"
+)
+
+func matchOf(t *testing.T, standings mt.Standings, matchId int) mt.MatchStanding {
+	t.Helper()
+
+	for _, m := range standings.Matches {
+		if m.Id == matchId {
+			return m
+		}
+	}
+	t.Fatalf("no match %d in %+v", matchId, standings.Matches)
+	return mt.MatchStanding{}
+}
+
+func TestTournamentSingleElimination(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	btm := mt.NewBattleshipTournamentManager(mb.NewBattleshipGameManager()).WithClock(fakeClock)
+
+	for _, names := range [][]string{{"solo"}, {"ann", "ANN"}, {"ann", ""}} {
+		if _, err := btm.CreateTournament(mt.FormatSingleElimination, mb.GameDifficultyEasy, names); cerr.CodeOf(err) != cerr.ErrCodeInvalidTournament {
+			t.Fatalf("expected error code: %d for %q\tgot: %v", cerr.ErrCodeInvalidTournament, names, err)
+		}
+	}
+
+	tournament, err := btm.CreateTournament(mt.FormatSingleElimination, mb.GameDifficultyEasy, []string{"ann", "bob", "cy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ann got the bye, so the final waits for bob or cy
+	standings, _ := btm.FetchStandings(tournament.Uuid)
+	if bye := matchOf(t, standings, 1); bye.Winner != 1 || bye.DecidedBy != mt.DecidedByBye {
+		t.Fatalf("expected a bye for seed 1, got: %+v", bye)
+	}
+	if semi := matchOf(t, standings, 2); semi.Status != mt.MatchStatusScheduled || semi.SeedA != 2 || semi.SeedB != 3 {
+		t.Fatalf("expected 2 vs 3 to be scheduled, got: %+v", semi)
+	}
+	if final := matchOf(t, standings, 3); final.Status != mt.MatchStatusPending || final.SeedA != 1 {
+		t.Fatalf("expected the final to wait, got: %+v", final)
+	}
+
+	if _, err := btm.Seat(tournament.Uuid, tournament.Entrants[0].SeatToken, "session-ann"); cerr.CodeOf(err) != cerr.ErrCodeNoTournamentMatch {
+		t.Fatalf("expected error code: %d\tgot: %v", cerr.ErrCodeNoTournamentMatch, err)
+	}
+	if _, err := btm.Seat(tournament.Uuid, "forged", "session-x"); cerr.CodeOf(err) != cerr.ErrCodeSeatTokenInvalid {
+		t.Fatalf("expected error code: %d\tgot: %v", cerr.ErrCodeSeatTokenInvalid, err)
+	}
+
+	// Nobody shows up for the semi; the better seed goes through
+	fakeClock.Advance(mt.DefaultTournamentConfig().NoShowTimeout)
+	results := btm.ExpireMatches(fakeClock.Now())
+	if len(results) != 1 || results[0].Winner != 2 || results[0].DecidedBy != mt.DecidedByNoShow {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	// Only ann shows up for the final
+	seat, err := btm.Seat(tournament.Uuid, tournament.Entrants[0].SeatToken, "session-ann")
+	if err != nil || !seat.Player.IsHost() || seat.IsJoin {
+		t.Fatalf("expected ann to host the final: %+v (%v)", seat, err)
+	}
+	fakeClock.Advance(mt.DefaultTournamentConfig().NoShowTimeout)
+	results = btm.ExpireMatches(fakeClock.Now())
+	if len(results) != 1 || results[0].Winner != 1 || results[0].DecidedBy != mt.DecidedByForfeit || results[0].Champion != 1 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if len(results[0].SessionIds) != 1 || results[0].SessionIds[0] != "session-ann" {
+		t.Fatalf("expected ann to be told, got: %v", results[0].SessionIds)
+	}
+
+	standings, _ = btm.FetchStandings(tournament.Uuid)
+	if standings.Status != mt.StatusFinished || standings.Entrants[0].Seed != 1 || standings.Entrants[0].Wins != 1 || !standings.Entrants[2].Eliminated {
+		t.Fatalf("unexpected standings: %+v", standings)
+	}
+}
+
+func TestTournamentRoundRobin(t *testing.T) {
+	fakeClock := clock.NewFake(time.Now())
+	btm := mt.NewBattleshipTournamentManager(mb.NewBattleshipGameManager()).WithClock(fakeClock)
+
+	tournament, err := btm.CreateTournament(mt.FormatRoundRobin, mb.GameDifficultyEasy, []string{"ann", "bob", "cy", "dee"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tournament.Matches) != 6 {
+		t.Fatalf("expected 6 matches, got %d", len(tournament.Matches))
+	}
+
+	// Everyone meets everyone once, two matches per round
+	pairs := make(map[[2]int]bool)
+	for _, m := range tournament.Matches {
+		pairs[[2]int{m.SeedA, m.SeedB}] = true
+		if m.Round == 1 && m.Status != mt.MatchStatusScheduled || m.Round > 1 && m.Status != mt.MatchStatusPending {
+			t.Fatalf("unexpected status of match %+v", m)
+		}
+	}
+	if len(pairs) != 6 {
+		t.Fatalf("expected 6 distinct pairs, got %v", pairs)
+	}
+
+	for round := 1; round <= 3; round++ {
+		fakeClock.Advance(mt.DefaultTournamentConfig().NoShowTimeout)
+		results := btm.ExpireMatches(fakeClock.Now())
+		if len(results) != 2 || results[0].Winner != 0 {
+			t.Fatalf("round %d: unexpected results: %+v", round, results)
+		}
+	}
+
+	standings, _ := btm.FetchStandings(tournament.Uuid)
+	if standings.Status != mt.StatusFinished || standings.Champion != 1 || standings.Entrants[0].Losses != 3 {
+		t.Fatalf("unexpected standings: %+v", standings)
+	}
+}
+
+func TestTournamentMatch(t *testing.T) {
+	bgm := mb.NewBattleshipGameManager()
+	btm := mt.NewBattleshipTournamentManager(bgm)
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), bgm, nil).WithTournamentManager(btm)
+	wsUrl := startTestServer(t, rp)
+
+	tournament, err := btm.CreateTournament(mt.FormatSingleElimination, mb.GameDifficultyEasy, []string{"ann", "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostConn, _ := dialSession(t, wsUrl)
+	joinConn, _ := dialSession(t, wsUrl)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqJoinTournamentMatch]{Code: mc.CodeJoinTournamentMatch, RequestId: "seat-1", Payload: mc.ReqJoinTournamentMatch{TournamentUuid: tournament.Uuid, SeatToken: tournament.Entrants[1].SeatToken}})
+	respHost := readMessage[mc.RespJoinTournamentMatch](t, hostConn, mc.CodeJoinTournamentMatch)
+	if respHost.RequestId != "seat-1" || !respHost.Payload.IsHost || respHost.Payload.Seed != 2 || respHost.Payload.ResumeToken == "" {
+		t.Fatalf("unexpected seat response: %+v", respHost)
+	}
+
+	// The game is only reachable with a seat token
+	intruderConn, _ := dialSession(t, wsUrl)
+	writeMessage(t, intruderConn, mc.Message[mc.ReqJoinGame]{Code: mc.CodeJoinGame, Payload: mc.ReqJoinGame{GameUuid: respHost.Payload.GameUuid}})
+	expectErrCode(t, readMessage[mc.RespJoinGame](t, intruderConn, mc.CodeJoinGame), cerr.ErrCodeTournamentGame)
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqJoinTournamentMatch]{Code: mc.CodeJoinTournamentMatch, Payload: mc.ReqJoinTournamentMatch{TournamentUuid: tournament.Uuid, SeatToken: tournament.Entrants[0].SeatToken}})
+	respJoin := readMessage[mc.RespJoinTournamentMatch](t, joinConn, mc.CodeJoinTournamentMatch)
+	if respJoin.Payload.IsHost || respJoin.Payload.GameUuid != respHost.Payload.GameUuid {
+		t.Fatalf("unexpected seat response: %+v", respJoin)
+	}
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+
+	readyTestGame(t, hostConn, joinConn)
+	playTestGameToHostWin(t, hostConn, joinConn)
+
+	for _, conn := range []*websocket.Conn{hostConn, joinConn} {
+		result := readMessage[mc.RespTournamentMatchResult](t, conn, mc.CodeTournamentMatchResult)
+		if result.Payload.Winner != 2 || result.Payload.Champion != 2 || result.Payload.DecidedBy != mt.DecidedByPlay {
+			t.Fatalf("unexpected result: %+v", result.Payload)
+		}
+	}
+
+	writeMessage(t, hostConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCall))
+	expectErrCode(t, readMessage[mc.NoPayload](t, hostConn, mc.CodeRematchCall), cerr.ErrCodeTournamentGame)
+
+	// Nor can the match be replayed by accepting right away
+	writeMessage(t, joinConn, mc.NewMessage[mc.NoPayload](mc.CodeRematchCallAccepted))
+	expectErrCode(t, readMessage[mc.RespRematch](t, joinConn, mc.CodeRematch), cerr.ErrCodeTournamentGame)
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqTournamentStandings]{Code: mc.CodeTournamentStandings, Payload: mc.ReqTournamentStandings{TournamentUuid: tournament.Uuid}})
+	if standings := readMessage[mc.RespTournamentStandings](t, joinConn, mc.CodeTournamentStandings); standings.Payload.Champion != 2 {
+		t.Fatalf("unexpected standings: %+v", standings.Payload)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tournaments/{uuid}", rp.HandleTournamentStandings)
+	for uuid, expectedStatus := range map[string]int{tournament.Uuid: http.StatusOK, "missing": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tournaments/"+uuid, nil))
+		if rec.Code != expectedStatus {
+			t.Fatalf("expected %d for %s, got %d", expectedStatus, uuid, rec.Code)
+		}
+	}
+}
+
+func TestTournamentForfeitOnLeave(t *testing.T) {
+	bgm := mb.NewBattleshipGameManager()
+	btm := mt.NewBattleshipTournamentManager(bgm)
+	wsUrl := startTestServer(t, api.NewRequestProcessor(mc.NewBattleshipSessionManager(), bgm, nil).WithTournamentManager(btm))
+
+	tournament, err := btm.CreateTournament(mt.FormatRoundRobin, mb.GameDifficultyEasy, []string{"ann", "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostConn, _ := dialSession(t, wsUrl)
+	joinConn, _ := dialSession(t, wsUrl)
+	for _, seat := range []struct {
+		conn  *websocket.Conn
+		token string
+	}{{hostConn, tournament.Entrants[0].SeatToken}, {joinConn, tournament.Entrants[1].SeatToken}} {
+		writeMessage(t, seat.conn, mc.Message[mc.ReqJoinTournamentMatch]{Code: mc.CodeJoinTournamentMatch, Payload: mc.ReqJoinTournamentMatch{TournamentUuid: tournament.Uuid, SeatToken: seat.token}})
+		readMessage[mc.RespJoinTournamentMatch](t, seat.conn, mc.CodeJoinTournamentMatch)
+	}
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+
+	// A normal closure ends the session right away
+	hostConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	hostConn.Close()
+
+	result := readMessage[mc.RespTournamentMatchResult](t, joinConn, mc.CodeTournamentMatchResult)
+	if result.Payload.Winner != 2 || result.Payload.DecidedBy != mt.DecidedByForfeit || result.Payload.Champion != 2 {
+		t.Fatalf("unexpected result: %+v", result.Payload)
+	}
+}
+
+// An operator ending the game or kicking a player is nobody's
+// forfeit; the match is played again with a new game
+func TestTournamentVoidedByOperator(t *testing.T) {
+	bsm := mc.NewBattleshipSessionManager()
+	bgm := mb.NewBattleshipGameManager()
+	btm := mt.NewBattleshipTournamentManager(bgm)
+	wsUrl := startTestServer(t, api.NewRequestProcessor(bsm, bgm, nil).WithTournamentManager(btm))
+	admin := api.NewAdminHandler(bsm, bgm, btm, testAdminToken)
+
+	tournament, err := btm.CreateTournament(mt.FormatRoundRobin, mb.GameDifficultyEasy, []string{"ann", "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seatBoth := func() (hostConn, joinConn *websocket.Conn, gameUuid string) {
+		hostConn, _ = dialSession(t, wsUrl)
+		joinConn, _ = dialSession(t, wsUrl)
+		for _, seat := range []struct {
+			conn  *websocket.Conn
+			token string
+		}{{hostConn, tournament.Entrants[0].SeatToken}, {joinConn, tournament.Entrants[1].SeatToken}} {
+			writeMessage(t, seat.conn, mc.Message[mc.ReqJoinTournamentMatch]{Code: mc.CodeJoinTournamentMatch, Payload: mc.ReqJoinTournamentMatch{TournamentUuid: tournament.Uuid, SeatToken: seat.token}})
+			gameUuid = readMessage[mc.RespJoinTournamentMatch](t, seat.conn, mc.CodeJoinTournamentMatch).Payload.GameUuid
+		}
+		readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+		readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+		return hostConn, joinConn, gameUuid
+	}
+
+	// The loops of the players void the match once they end
+	expectVoided := func(gameUuid string) {
+		t.Helper()
+
+		deadline := time.Now().Add(time.Second * 2)
+		for {
+			current, err := btm.FetchTournament(tournament.Uuid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := current.Matches[0]
+			if m.GameUuid != gameUuid {
+				if m.Status != mt.MatchStatusScheduled || m.Winner != 0 || m.DecidedBy != "" {
+					t.Fatalf("expected the match to be played again, got: %+v", m)
+				}
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the match of %s to be voided, got: %+v", gameUuid, m)
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	hostConn, joinConn, gameUuid := seatBoth()
+	readyTestGame(t, hostConn, joinConn)
+	serveAdmin(t, admin, http.MethodDelete, "/admin/games/"+gameUuid, `{"reason":"maintenance"}`, http.StatusNoContent)
+	expectAdminClose[mc.RespAdminAction](t, hostConn, mc.CodeGameTerminated)
+	expectAdminClose[mc.RespAdminAction](t, joinConn, mc.CodeGameTerminated)
+	expectVoided(gameUuid)
+
+	// Both take their seats again in the new game
+	hostConn, joinConn, gameUuid = seatBoth()
+
+	var joinSessionId string
+	for _, session := range bsm.ListSessions() {
+		if session.RemoteAddr == joinConn.LocalAddr().String() {
+			joinSessionId = session.Id
+		}
+	}
+	serveAdmin(t, admin, http.MethodPost, "/admin/sessions/"+joinSessionId+"/kick", `{"reason":"abuse"}`, http.StatusNoContent)
+	expectAdminClose[mc.RespAdminAction](t, joinConn, mc.CodeSessionKicked)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerDisconnected)
+	expectVoided(gameUuid)
+}
+
+func TestPostgresTournamentStore(t *testing.T) {
+	psqlDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer psqlDb.Close()
+	store := db.NewPostgresTournamentStore(sqlc.New(psqlDb))
+
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	deadline := createdAt.Add(time.Minute * 5)
+	tournament := mt.Tournament{
+		Uuid:       "1a2b3c4d",
+		Format:     mt.FormatSingleElimination,
+		Difficulty: mb.GameDifficultyEasy,
+		Status:     mt.StatusRunning,
+		CreatedAt:  createdAt,
+		Entrants:   []mt.Entrant{{Seed: 1, Name: "ann", SeatToken: "token-ann"}, {Seed: 2, Name: "bob", SeatToken: "token-bob"}},
+		Matches:    []*mt.Match{{Id: 1, Round: 1, SeedA: 1, SeedB: 2, Status: mt.MatchStatusScheduled, GameUuid: "a1b2c3", Deadline: deadline}},
+	}
+
+	mock.ExpectExec(`INSERT INTO tournaments`).
+		WithArgs("1a2b3c4d", mt.FormatSingleElimination, int16(0), mt.StatusRunning, int32(0), createdAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, entrant := range tournament.Entrants {
+		mock.ExpectExec(`INSERT INTO tournament_entrants`).
+			WithArgs("1a2b3c4d", int32(entrant.Seed), entrant.Name, entrant.SeatToken).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(`INSERT INTO tournament_matches`).
+		WithArgs("1a2b3c4d", int32(1), int32(1), int32(1), int32(2), mt.MatchStatusScheduled, "a1b2c3", sqlmock.AnyArg(), int32(0), int32(0), int32(0), "", int32(0), int32(0)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.SaveTournament(context.Background(), tournament); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT (.+) FROM tournaments WHERE status = 'running'`).
+		WillReturnRows(sqlmock.NewRows([]string{"uuid", "format", "difficulty", "status", "champion_seed", "created_at"}).
+			AddRow("1a2b3c4d", mt.FormatSingleElimination, 0, mt.StatusRunning, 0, createdAt))
+	mock.ExpectQuery(`SELECT (.+) FROM tournament_entrants WHERE tournament_uuid = \$1`).
+		WithArgs("1a2b3c4d").
+		WillReturnRows(sqlmock.NewRows([]string{"tournament_uuid", "seed", "name", "seat_token"}).
+			AddRow("1a2b3c4d", 1, "ann", "token-ann").
+			AddRow("1a2b3c4d", 2, "bob", "token-bob"))
+	mock.ExpectQuery(`SELECT (.+) FROM tournament_matches WHERE tournament_uuid = \$1`).
+		WithArgs("1a2b3c4d").
+		WillReturnRows(sqlmock.NewRows([]string{"tournament_uuid", "match_id", "round", "seed_a", "seed_b", "status", "game_uuid", "deadline", "host_seed", "join_seed", "winner_seed", "decided_by", "next_match_id", "next_slot"}).
+			AddRow("1a2b3c4d", 1, 1, 1, 2, mt.MatchStatusScheduled, "a1b2c3", deadline, 0, 0, 0, "", 0, 0))
+
+	restored, err := store.ListRunningTournaments(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoredJson, _ := json.Marshal(restored)
+	expectedJson, _ := json.Marshal([]mt.Tournament{tournament})
+	if string(restoredJson) != string(expectedJson) {
+		t.Fatalf("restored tournament differs:\n%s\n%s", restoredJson, expectedJson)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations were not met: %v", err)
+	}
+}
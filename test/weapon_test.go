@@ -0,0 +1,163 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/saeidalz13/battleship-backend/api"
+	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	mb "github.com/saeidalz13/battleship-backend/models/battleship"
+	mc "github.com/saeidalz13/battleship-backend/models/connection"
+)
+
+// Fires a weapon and reads the result on both sides unless it failed
+func fireTestWeapon[Req any, Resp any](t *testing.T, attackerConn, defenderConn *websocket.Conn, code uint8, req Req) mc.Message[Resp] {
+	t.Helper()
+
+	writeMessage(t, attackerConn, mc.Message[Req]{Code: code, Payload: req})
+	resp := readMessage[Resp](t, attackerConn, code)
+	if resp.Error == nil {
+		readMessage[Resp](t, defenderConn, code)
+	}
+	return resp
+}
+
+func attackTestCell(t *testing.T, attackerConn, defenderConn *websocket.Conn, x, y uint8) {
+	t.Helper()
+
+	writeMessage(t, attackerConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: x, Y: y}})
+	readMessage[mc.RespAttack](t, attackerConn, mc.CodeAttack)
+	readMessage[mc.RespAttack](t, defenderConn, mc.CodeAttack)
+}
+
+func TestWeaponAreas(t *testing.T) {
+	game, err := mb.NewBattleshipGameManager().CreateGame(mb.GameDifficultyEasy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cells := game.SquareArea(mb.NewCoordinates(0, 0)); len(cells) != 4 {
+		t.Fatalf("expected the corner square to be cut to 4 cells, got: %v", cells)
+	}
+	if cells := game.SquareArea(mb.NewCoordinates(2, 2)); len(cells) != 9 {
+		t.Fatalf("expected 9 cells, got: %v", cells)
+	}
+
+	column := game.Line(3, mb.TorpedoColumn)
+	if len(column) != int(mb.GridSizeEasy) || column[0] != mb.NewCoordinates(0, 3) || column[5] != mb.NewCoordinates(5, 3) {
+		t.Fatalf("unexpected column: %v", column)
+	}
+}
+
+func TestSpecialWeaponsDisabled(t *testing.T) {
+	wsUrl := startTestServer(t, api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil))
+	hostConn, joinConn, _ := setupTestGame(t, wsUrl)
+	if startGame := readyTestGame(t, hostConn, joinConn); startGame.Inventory != nil {
+		t.Fatalf("expected no inventory, got: %+v", startGame.Inventory)
+	}
+
+	respBomb := fireTestWeapon[mc.ReqBomb, mc.RespSpecialAttack](t, hostConn, joinConn, mc.CodeBomb, mc.ReqBomb{X: 1, Y: 1})
+	expectErrCode(t, respBomb, cerr.ErrCodeSpecialWeaponsDisabled)
+}
+
+// Weapons fired without a game or an opponent are rejected
+// and the session lives on
+func TestSpecialWeaponsWithoutGame(t *testing.T) {
+	wsUrl := startTestServer(t, api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil))
+	conn, _ := dialSession(t, wsUrl)
+
+	expectRejected := func(t *testing.T) {
+		t.Helper()
+
+		writeMessage(t, conn, mc.Message[mc.ReqBomb]{Code: mc.CodeBomb, Payload: mc.ReqBomb{X: 1, Y: 1}})
+		expectErrCode(t, readMessage[mc.RespSpecialAttack](t, conn, mc.CodeBomb), cerr.ErrCodeGameNotExists)
+
+		writeMessage(t, conn, mc.Message[mc.ReqTorpedo]{Code: mc.CodeTorpedo, Payload: mc.ReqTorpedo{Index: 1, Orientation: mb.TorpedoRow}})
+		expectErrCode(t, readMessage[mc.RespSpecialAttack](t, conn, mc.CodeTorpedo), cerr.ErrCodeGameNotExists)
+
+		writeMessage(t, conn, mc.Message[mc.ReqSonar]{Code: mc.CodeSonar, Payload: mc.ReqSonar{X: 1, Y: 1}})
+		expectErrCode(t, readMessage[mc.RespSonar](t, conn, mc.CodeSonar), cerr.ErrCodeGameNotExists)
+	}
+
+	expectRejected(t)
+
+	// The host of a game nobody has joined yet
+	writeMessage(t, conn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy, SpecialWeapons: true}})
+	readMessage[mc.RespCreateGame](t, conn, mc.CodeCreateGame)
+	expectRejected(t)
+}
+
+// Both players use testDefenceGridEasy and the host starts
+func TestSpecialWeapons(t *testing.T) {
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil).
+		WithRateLimitConfig(api.RateLimitConfig{})
+	wsUrl := startTestServer(t, rp)
+
+	hostConn, _ := dialSession(t, wsUrl)
+	joinConn, _ := dialSession(t, wsUrl)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy, SpecialWeapons: true}})
+	respCreateGame := readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame)
+	if !respCreateGame.Payload.SpecialWeapons {
+		t.Fatalf("expected special weapons, got: %+v", respCreateGame.Payload)
+	}
+	writeMessage(t, joinConn, mc.Message[mc.ReqJoinGame]{Code: mc.CodeJoinGame, Payload: mc.ReqJoinGame{GameUuid: respCreateGame.Payload.GameUuid}})
+	readMessage[mc.RespJoinGame](t, joinConn, mc.CodeJoinGame)
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+
+	startGame := readyTestGame(t, hostConn, joinConn)
+	if startGame.Inventory == nil || *startGame.Inventory != mb.DefaultInventory() {
+		t.Fatalf("expected the default inventory, got: %+v", startGame.Inventory)
+	}
+
+	// The bomb covers the whole cruiser
+	respBomb := fireTestWeapon[mc.ReqBomb, mc.RespSpecialAttack](t, hostConn, joinConn, mc.CodeBomb, mc.ReqBomb{X: 2, Y: 1})
+	if respBomb.Error != nil || len(respBomb.Payload.Cells) != 9 || len(respBomb.Payload.DefenderSunkenShipsCoords) != 3 {
+		t.Fatalf("unexpected bomb result: %+v", respBomb)
+	}
+	if respBomb.Payload.SunkenShipsJoin != 1 || respBomb.Payload.IsTurn || respBomb.Payload.Inventory.Bombs != 0 {
+		t.Fatalf("unexpected bomb result: %+v", respBomb.Payload)
+	}
+	for _, cell := range respBomb.Payload.Cells {
+		expectedState := mb.PositionStateAttackGridMiss
+		if cell.Y == 0 {
+			expectedState = mb.PositionStateAttackGridHit
+		}
+		if cell.PositionState != expectedState {
+			t.Fatalf("unexpected cell: %+v", cell)
+		}
+	}
+
+	respSonar := fireTestWeapon[mc.ReqSonar, mc.RespSonar](t, joinConn, hostConn, mc.CodeSonar, mc.ReqSonar{X: 5, Y: 5})
+	if respSonar.Error != nil || respSonar.Payload.ShipDetected || respSonar.Payload.Inventory.Sonars != 1 {
+		t.Fatalf("unexpected sonar result: %+v", respSonar)
+	}
+
+	respBomb = fireTestWeapon[mc.ReqBomb, mc.RespSpecialAttack](t, hostConn, joinConn, mc.CodeBomb, mc.ReqBomb{X: 4, Y: 4})
+	expectErrCode(t, respBomb, cerr.ErrCodeWeaponUsedUp)
+	respTorpedo := fireTestWeapon[mc.ReqTorpedo, mc.RespSpecialAttack](t, hostConn, joinConn, mc.CodeTorpedo, mc.ReqTorpedo{Index: 3, Orientation: "diagonal"})
+	expectErrCode(t, respTorpedo, cerr.ErrCodeInvalidTorpedoOrientation)
+
+	attackTestCell(t, hostConn, joinConn, 0, 1)
+	respSonar = fireTestWeapon[mc.ReqSonar, mc.RespSonar](t, joinConn, hostConn, mc.CodeSonar, mc.ReqSonar{X: 3, Y: 3})
+	if respSonar.Error != nil || !respSonar.Payload.ShipDetected || respSonar.Payload.Inventory.Sonars != 0 {
+		t.Fatalf("unexpected sonar result: %+v", respSonar)
+	}
+	attackTestCell(t, hostConn, joinConn, 0, 2)
+	attackTestCell(t, joinConn, hostConn, 5, 5)
+
+	// Sinking the battleship wins, so the last cell of the column is spared
+	respTorpedo = fireTestWeapon[mc.ReqTorpedo, mc.RespSpecialAttack](t, hostConn, joinConn, mc.CodeTorpedo, mc.ReqTorpedo{Index: 3, Orientation: mb.TorpedoColumn})
+	if respTorpedo.Error != nil || len(respTorpedo.Payload.Cells) != 5 || respTorpedo.Payload.SunkenShipsJoin != 3 {
+		t.Fatalf("unexpected torpedo result: %+v", respTorpedo)
+	}
+
+	if endGame := readMessage[mc.RespEndGame](t, hostConn, mc.CodeEndGame); endGame.Payload.PlayerMatchStatus != mb.PlayerMatchStatusWon {
+		t.Fatalf("expected the host to win, got: %+v", endGame.Payload)
+	}
+	if endGame := readMessage[mc.RespEndGame](t, joinConn, mc.CodeEndGame); endGame.Payload.PlayerMatchStatus != mb.PlayerMatchStatusLost {
+		t.Fatalf("expected the join player to lose, got: %+v", endGame.Payload)
+	}
+}
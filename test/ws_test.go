@@ -1,11 +1,23 @@
 package test
 
 import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/saeidalz13/battleship-backend/api"
+	"github.com/saeidalz13/battleship-backend/internal/clock"
 	cerr "github.com/saeidalz13/battleship-backend/internal/error"
+	"github.com/saeidalz13/battleship-backend/internal/metrics"
+	"github.com/saeidalz13/battleship-backend/internal/token"
 	mb "github.com/saeidalz13/battleship-backend/models/battleship"
 	mc "github.com/saeidalz13/battleship-backend/models/connection"
 )
@@ -13,8 +25,9 @@ import (
 type Test[T, K any] struct {
 	name string
 
-	expectedCode uint8
-	expectedErr  string
+	expectedCode    uint8
+	expectedErr     string
+	expectedErrCode cerr.ErrCode
 
 	reqPayload          T
 	respPayload         K // Used to unmarshal the response
@@ -205,7 +218,7 @@ func TestReadyGame(t *testing.T) {
 		{0, 0, 0, 0, 0, 0},
 	}
 
-	tests := []Test[mc.Message[mc.ReqReadyPlayer], mc.Message[mc.NoPayload]]{
+	tests := []Test[mc.Message[mc.ReqReadyPlayer], mc.Message[mc.RespReady]]{
 		{
 			name:         "set defence grid ready host",
 			expectedCode: mc.CodeReady,
@@ -217,7 +230,7 @@ func TestReadyGame(t *testing.T) {
 					PlayerUuid:  testHostPlayer.Uuid(),
 				},
 			},
-			respPayload: mc.Message[mc.NoPayload]{},
+			respPayload: mc.Message[mc.RespReady]{},
 			conn:        HostConn,
 		},
 		{
@@ -231,7 +244,7 @@ func TestReadyGame(t *testing.T) {
 					PlayerUuid:  testJoinPlayer.Uuid(),
 				},
 			},
-			respPayload: mc.Message[mc.NoPayload]{},
+			respPayload: mc.Message[mc.RespReady]{},
 			conn:        JoinConn,
 		},
 	}
@@ -249,6 +262,9 @@ func TestReadyGame(t *testing.T) {
 			if test.respPayload.Code != test.expectedCode {
 				t.Fatalf("expected status: %d\t got: %d", test.expectedCode, test.respPayload.Code)
 			}
+			if !reflect.DeepEqual(test.respPayload.Payload.DefenceGrid, test.reqPayload.Payload.DefenceGrid) {
+				t.Fatalf("expected the grid back, got: %v", test.respPayload.Payload.DefenceGrid)
+			}
 
 			if test.respPayload.Error != nil {
 				if test.respPayload.Error.ErrorDetails != test.expectedErr {
@@ -262,13 +278,16 @@ func TestReadyGame(t *testing.T) {
 				// Reading game ready codes
 
 				// Host
-				var respStartGameHost mc.Message[mc.NoPayload]
+				var respStartGameHost mc.Message[mc.RespStartGame]
 				if err := HostConn.ReadJSON(&respStartGameHost); err != nil {
 					t.Fatal(err)
 				}
+				if !respStartGameHost.Payload.HostStarts || respStartGameHost.Payload.StarterUuid != testHostPlayer.Uuid() {
+					t.Fatalf("expected the host to start, got: %+v", respStartGameHost.Payload)
+				}
 
 				// Join
-				var respStartGameJoin mc.Message[mc.NoPayload]
+				var respStartGameJoin mc.Message[mc.RespStartGame]
 				if err := JoinConn.ReadJSON(&respStartGameJoin); err != nil {
 					t.Fatal(err)
 				}
@@ -277,6 +296,54 @@ func TestReadyGame(t *testing.T) {
 	}
 }
 
+// Both loops try to start the game once the second player is
+// ready; only one of them may
+func TestTryStartOnce(t *testing.T) {
+	game, err := mb.NewBattleshipGameManager().CreateGame(mb.GameDifficultyEasy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostPlayer := game.CreateHostPlayer("host")
+	joinPlayer := game.CreateJoinPlayer("join")
+
+	tryStart := func() int32 {
+		var started atomic.Int32
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if game.TryStart(time.Now()) {
+					started.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		return started.Load()
+	}
+
+	for i := range 2 {
+		if err := game.SetPlayerReadyForGame(hostPlayer, testDefenceGridEasy); err != nil {
+			t.Fatal(err)
+		}
+		if started := tryStart(); started != 0 {
+			t.Fatalf("game %d: expected no start with one player ready, got: %d", i+1, started)
+		}
+
+		if err := game.SetPlayerReadyForGame(joinPlayer, testDefenceGridEasy); err != nil {
+			t.Fatal(err)
+		}
+		if started := tryStart(); started != 1 {
+			t.Fatalf("game %d: expected exactly one start, got: %d", i+1, started)
+		}
+
+		// A rematch can be started again
+		if err := game.ResetRematchForGame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestAttack(t *testing.T) {
 	tests := []Test[mc.Message[mc.ReqAttack], mc.Message[mc.RespAttack]]{
 		{
@@ -372,9 +439,10 @@ func TestAttack(t *testing.T) {
 		},
 
 		{
-			name:         "wrong turn of player join",
-			expectedCode: mc.CodeAttack,
-			expectedErr:  cerr.ErrNotTurnForAttacker(testJoinPlayer.Uuid()).Error(),
+			name:            "wrong turn of player join",
+			expectedCode:    mc.CodeAttack,
+			expectedErr:     cerr.ErrNotTurnForAttacker(testJoinPlayer.Uuid()).Error(),
+			expectedErrCode: cerr.ErrCodeNotTurnForAttacker,
 			reqPayload: mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{
 				GameUuid:   testGameUuid,
 				PlayerUuid: testJoinPlayer.Uuid(),
@@ -388,9 +456,10 @@ func TestAttack(t *testing.T) {
 		},
 
 		{
-			name:         "invalid x attack host",
-			expectedCode: mc.CodeAttack,
-			expectedErr:  cerr.ErrXorYOutOfGridBound(outOfGridBoundNum, 0).Error(),
+			name:            "invalid x attack host",
+			expectedCode:    mc.CodeAttack,
+			expectedErr:     cerr.ErrXorYOutOfGridBound(outOfGridBoundNum, 0).Error(),
+			expectedErrCode: cerr.ErrCodeXorYOutOfGridBound,
 			reqPayload: mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{
 				GameUuid:   testGameUuid,
 				PlayerUuid: testHostPlayer.Uuid(),
@@ -404,9 +473,10 @@ func TestAttack(t *testing.T) {
 		},
 
 		{
-			name:         "invalid y attack host",
-			expectedCode: mc.CodeAttack,
-			expectedErr:  cerr.ErrXorYOutOfGridBound(0, outOfGridBoundNum).Error(),
+			name:            "invalid y attack host",
+			expectedCode:    mc.CodeAttack,
+			expectedErr:     cerr.ErrXorYOutOfGridBound(0, outOfGridBoundNum).Error(),
+			expectedErrCode: cerr.ErrCodeXorYOutOfGridBound,
 			reqPayload: mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{
 				GameUuid:   testGameUuid,
 				PlayerUuid: testHostPlayer.Uuid(),
@@ -420,9 +490,10 @@ func TestAttack(t *testing.T) {
 		},
 
 		{
-			name:         "invalid attack already hit host",
-			expectedCode: mc.CodeAttack,
-			expectedErr:  cerr.ErrAttackPositionAlreadyFilled(0, 1).Error(),
+			name:            "invalid attack already hit host",
+			expectedCode:    mc.CodeAttack,
+			expectedErr:     cerr.ErrAttackPositionAlreadyFilled(0, 1).Error(),
+			expectedErrCode: cerr.ErrCodeAttackPositionAlreadyFilled,
 			reqPayload: mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{
 				GameUuid:   testGameUuid,
 				PlayerUuid: testHostPlayer.Uuid(),
@@ -753,6 +824,9 @@ func TestAttack(t *testing.T) {
 				if test.respPayload.Error.ErrorDetails != test.expectedErr {
 					t.Fatalf("expected error: %s\t got: %s", test.expectedErr, test.respPayload.Error.ErrorDetails)
 				}
+				if test.respPayload.Error.Code != test.expectedErrCode {
+					t.Fatalf("expected error code: %d\t got: %d", test.expectedErrCode, test.respPayload.Error.Code)
+				}
 
 			} else {
 				if !reflect.DeepEqual(test.respPayload, test.expectedRespPayload) {
@@ -897,3 +971,789 @@ func TestRematchRejection(t *testing.T) {
 		t.Fatal("session for join player must not exist in session maps")
 	}
 }
+
+func TestRequestIdAndEventReplay(t *testing.T) {
+	hostConn, _ := dialSession(t, testWsUrl)
+	joinConn, _ := dialSession(t, testWsUrl)
+
+	reqCreate := mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, RequestId: "create-1", Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy}}
+	if err := hostConn.WriteJSON(reqCreate); err != nil {
+		t.Fatal(err)
+	}
+	var respCreate mc.Message[mc.RespCreateGame]
+	if err := hostConn.ReadJSON(&respCreate); err != nil {
+		t.Fatal(err)
+	}
+	if respCreate.RequestId != "create-1" {
+		t.Fatalf("expected request id: %s\tgot: %s", "create-1", respCreate.RequestId)
+	}
+	if respCreate.Seq != 0 {
+		t.Fatalf("direct response must not carry a seq, got: %d", respCreate.Seq)
+	}
+
+	reqJoin := mc.Message[mc.ReqJoinGame]{Code: mc.CodeJoinGame, RequestId: "join-1", Payload: mc.ReqJoinGame{GameUuid: respCreate.Payload.GameUuid}}
+	if err := joinConn.WriteJSON(reqJoin); err != nil {
+		t.Fatal(err)
+	}
+	var respJoin mc.Message[mc.RespJoinGame]
+	if err := joinConn.ReadJSON(&respJoin); err != nil {
+		t.Fatal(err)
+	}
+	if respJoin.RequestId != "join-1" {
+		t.Fatalf("expected request id: %s\tgot: %s", "join-1", respJoin.RequestId)
+	}
+	var respSelectGridJoin mc.Message[mc.NoPayload]
+	if err := joinConn.ReadJSON(&respSelectGridJoin); err != nil {
+		t.Fatal(err)
+	}
+	if respSelectGridJoin.RequestId != "join-1" {
+		t.Fatalf("expected request id: %s\tgot: %s", "join-1", respSelectGridJoin.RequestId)
+	}
+
+	// Host did not send this request; it is a pushed event
+	var respSelectGridHost mc.Message[mc.NoPayload]
+	if err := hostConn.ReadJSON(&respSelectGridHost); err != nil {
+		t.Fatal(err)
+	}
+	if respSelectGridHost.RequestId != "" || respSelectGridHost.Seq != 1 {
+		t.Fatalf("expected pushed event with seq 1 and no request id, got: %+v", respSelectGridHost)
+	}
+
+	reqReplay := mc.Message[mc.ReqReplayEvents]{Code: mc.CodeReplayEvents, RequestId: "replay-1", Payload: mc.ReqReplayEvents{LastSeq: 0}}
+	if err := hostConn.WriteJSON(reqReplay); err != nil {
+		t.Fatal(err)
+	}
+	var replayed mc.Message[mc.NoPayload]
+	if err := hostConn.ReadJSON(&replayed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, respSelectGridHost) {
+		t.Fatalf("expected replayed event: %+v\tgot: %+v", respSelectGridHost, replayed)
+	}
+	var respReplay mc.Message[mc.RespReplayEvents]
+	if err := hostConn.ReadJSON(&respReplay); err != nil {
+		t.Fatal(err)
+	}
+	expectedRespReplay := mc.Message[mc.RespReplayEvents]{Code: mc.CodeReplayEvents, RequestId: "replay-1", Payload: mc.RespReplayEvents{Replayed: 1, LastSeq: 1}}
+	if !reflect.DeepEqual(respReplay, expectedRespReplay) {
+		t.Fatalf("expected resp payload: %+v\n got: %+v", expectedRespReplay, respReplay)
+	}
+}
+
+func TestOriginPolicy(t *testing.T) {
+	policy := api.NewOriginPolicy([]string{"https://battleship.example.com", "https://*.staging.example.com/"}, false)
+
+	tests := []struct {
+		name            string
+		origin          string
+		expectedAllowed bool
+		expectedReason  string
+	}{
+		{name: "exact origin", origin: "https://battleship.example.com", expectedAllowed: true},
+		{name: "exact origin different case", origin: "HTTPS://Battleship.Example.com", expectedAllowed: true},
+		{name: "exact origin wrong scheme", origin: "http://battleship.example.com", expectedReason: api.RejectReasonOriginNotAllowed},
+		{name: "wildcard subdomain", origin: "https://pr-12.staging.example.com", expectedAllowed: true},
+		{name: "wildcard does not match apex", origin: "https://staging.example.com", expectedReason: api.RejectReasonOriginNotAllowed},
+		{name: "wildcard suffix trick", origin: "https://evilstaging.example.com", expectedReason: api.RejectReasonOriginNotAllowed},
+		{name: "no origin", origin: "", expectedReason: api.RejectReasonMissingOrigin},
+		{name: "malformed origin", origin: "null", expectedReason: api.RejectReasonMalformedOrigin},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed, reason := policy.Check(test.origin)
+			if allowed != test.expectedAllowed || reason != test.expectedReason {
+				t.Fatalf("expected allowed: %t reason: %q\tgot allowed: %t reason: %q", test.expectedAllowed, test.expectedReason, allowed, reason)
+			}
+		})
+	}
+}
+
+func TestUpgradeRejectedForOrigin(t *testing.T) {
+	_, resp, err := dialer.Dial(testWsUrl, http.Header{"Origin": []string{"https://evil.example.com"}})
+	if err == nil {
+		t.Fatal("expected the upgrade to be rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected status: %d\tgot: %+v", http.StatusForbidden, resp)
+	}
+
+	var exposition bytes.Buffer
+	metrics.Default().WriteText(&exposition)
+	if !strings.Contains(exposition.String(), `battleship_websocket_upgrades_rejected_total{reason="origin_not_allowed"} 1`) {
+		t.Fatalf("rejected upgrade was not counted:\n%s", exposition.String())
+	}
+}
+
+// Starts a separate server so that tests can change the
+// configuration without affecting the shared one
+func startTestServer(t *testing.T, rp api.RequestProcessor) string {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /battleship", rp)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/battleship"
+}
+
+func expectRateLimitedClose(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	var respRateLimited mc.Message[mc.NoPayload]
+	if err := conn.ReadJSON(&respRateLimited); err != nil {
+		t.Fatal(err)
+	}
+	if respRateLimited.Code != mc.CodeRateLimited || respRateLimited.Error == nil || respRateLimited.Error.Code != cerr.ErrCodeRateLimited {
+		t.Fatalf("expected rate limited msg, got: %+v", respRateLimited)
+	}
+
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expected close error %d, got: %v", websocket.ClosePolicyViolation, err)
+	}
+}
+
+func TestRateLimitSessionMessages(t *testing.T) {
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil).
+		WithRateLimitConfig(api.RateLimitConfig{MessagesPerSecond: 1, MessageBurst: 2})
+	wsUrl := startTestServer(t, rp)
+
+	conn, _, err := dialer.Dial(wsUrl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var respSessionId mc.Message[mc.RespSessionId]
+	if err := conn.ReadJSON(&respSessionId); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := conn.WriteJSON(mc.NewMessage[mc.NoPayload](255)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The burst goes through as usual
+	for i := 0; i < 2; i++ {
+		var respInvalid mc.Message[mc.NoPayload]
+		if err := conn.ReadJSON(&respInvalid); err != nil {
+			t.Fatal(err)
+		}
+		if respInvalid.Code != mc.CodeInvalidSignal {
+			t.Fatalf("expected status: %d\t got: %d", mc.CodeInvalidSignal, respInvalid.Code)
+		}
+	}
+
+	expectRateLimitedClose(t, conn)
+}
+
+func TestRateLimitIpConnections(t *testing.T) {
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil).
+		WithRateLimitConfig(api.RateLimitConfig{MaxConnsPerIp: 1})
+	wsUrl := startTestServer(t, rp)
+
+	conn, _, err := dialer.Dial(wsUrl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var respSessionId mc.Message[mc.RespSessionId]
+	if err := conn.ReadJSON(&respSessionId); err != nil {
+		t.Fatal(err)
+	}
+
+	secondConn, _, err := dialer.Dial(wsUrl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secondConn.Close()
+
+	expectRateLimitedClose(t, secondConn)
+}
+
+var (
+	testDefenceGridEasy = mb.Grid{
+		{0, mb.PositionStateDefenceDestroyer, mb.PositionStateDefenceDestroyer, 0, 0, 0},
+		{mb.PositionStateDefenceCruiser, 0, 0, mb.PositionStateDefenceBattleship, 0, 0},
+		{mb.PositionStateDefenceCruiser, 0, 0, mb.PositionStateDefenceBattleship, 0, 0},
+		{mb.PositionStateDefenceCruiser, 0, 0, mb.PositionStateDefenceBattleship, 0, 0},
+		{0, 0, 0, mb.PositionStateDefenceBattleship, 0, 0},
+		{0, 0, 0, 0, 0, 0},
+	}
+)
+
+// Reads the next message and fails the test if its code is not the expected one
+func readMessage[T any](t *testing.T, conn *websocket.Conn, expectedCode uint8) mc.Message[T] {
+	t.Helper()
+
+	var msg mc.Message[T]
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Code != expectedCode {
+		t.Fatalf("expected status: %d\t got: %d (%+v)", expectedCode, msg.Code, msg)
+	}
+	return msg
+}
+
+// Fails the test unless the msg carries the expected error code
+func expectErrCode[T any](t *testing.T, msg mc.Message[T], expected cerr.ErrCode) {
+	t.Helper()
+
+	if msg.Error == nil || msg.Error.Code != expected {
+		t.Fatalf("expected error code: %d\tgot: %+v", expected, msg.Error)
+	}
+}
+
+func writeMessage[T any](t *testing.T, conn *websocket.Conn, msg mc.Message[T]) {
+	t.Helper()
+
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func dialSession(t *testing.T, wsUrl string) (*websocket.Conn, mc.RespSessionId) {
+	t.Helper()
+
+	conn, _, err := dialer.Dial(wsUrl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, readMessage[mc.RespSessionId](t, conn, mc.CodeSessionID).Payload
+}
+
+// Creates and joins an easy game; both players are at the grid selection
+func setupTestGame(t *testing.T, wsUrl string) (hostConn, joinConn *websocket.Conn, gameUuid string) {
+	t.Helper()
+
+	hostConn, _ = dialSession(t, wsUrl)
+	joinConn, _ = dialSession(t, wsUrl)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy}})
+	gameUuid = readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame).Payload.GameUuid
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqJoinGame]{Code: mc.CodeJoinGame, Payload: mc.ReqJoinGame{GameUuid: gameUuid}})
+	readMessage[mc.RespJoinGame](t, joinConn, mc.CodeJoinGame)
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+
+	return hostConn, joinConn, gameUuid
+}
+
+// Like setupTestGame, with the rules of the request
+func setupTestGameWithRules(t *testing.T, wsUrl string, req mc.ReqCreateGame) (hostConn, joinConn *websocket.Conn, respCreateGame mc.RespCreateGame, respJoinGame mc.RespJoinGame) {
+	t.Helper()
+
+	hostConn, _ = dialSession(t, wsUrl)
+	joinConn, _ = dialSession(t, wsUrl)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: req})
+	respCreateGame = readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame).Payload
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqJoinGame]{Code: mc.CodeJoinGame, Payload: mc.ReqJoinGame{GameUuid: respCreateGame.GameUuid}})
+	respJoinGame = readMessage[mc.RespJoinGame](t, joinConn, mc.CodeJoinGame).Payload
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+
+	return hostConn, joinConn, respCreateGame, respJoinGame
+}
+
+// Both players send their grid; the game is in progress afterwards.
+// Both are told the same starter.
+func readyTestGame(t *testing.T, hostConn, joinConn *websocket.Conn) mc.RespStartGame {
+	t.Helper()
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqReadyPlayer]{Code: mc.CodeReady, Payload: mc.ReqReadyPlayer{DefenceGrid: testDefenceGridEasy}})
+	readMessage[mc.RespReady](t, hostConn, mc.CodeReady)
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqReadyPlayer]{Code: mc.CodeReady, Payload: mc.ReqReadyPlayer{DefenceGrid: testDefenceGridEasy}})
+	readMessage[mc.RespReady](t, joinConn, mc.CodeReady)
+
+	joinStartGame := readMessage[mc.RespStartGame](t, joinConn, mc.CodeStartGame).Payload
+	hostStartGame := readMessage[mc.RespStartGame](t, hostConn, mc.CodeStartGame).Payload
+	if !reflect.DeepEqual(joinStartGame, hostStartGame) {
+		t.Fatalf("players disagree on the start, host: %+v join: %+v", hostStartGame, joinStartGame)
+	}
+	return hostStartGame
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	bsm := mc.NewBattleshipSessionManager()
+	rp := api.NewRequestProcessor(bsm, mb.NewBattleshipGameManager(), nil).WithClock(clk)
+	wsUrl := startTestServer(t, rp)
+
+	hostConn, joinConn, _ := setupTestGame(t, wsUrl)
+	readyTestGame(t, hostConn, joinConn)
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		rp.Shutdown(context.Background(), api.ShutdownConfig{DrainWindow: time.Second * 45, RetryAfter: time.Second * 7})
+		close(shutdownDone)
+	}()
+
+	for _, conn := range []*websocket.Conn{hostConn, joinConn} {
+		msg := readMessage[mc.RespServerShuttingDown](t, conn, mc.CodeServerShuttingDown)
+		if msg.Payload.RetryAfterSeconds != 7 {
+			t.Fatalf("expected retry after: %d\tgot: %d", 7, msg.Payload.RetryAfterSeconds)
+		}
+	}
+
+	// No new sessions while draining
+	_, resp, err := dialer.Dial(wsUrl, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected status: %d\tgot: %+v", http.StatusServiceUnavailable, resp)
+	}
+	if resp.Header.Get("Retry-After") != "7" {
+		t.Fatalf("expected Retry-After: 7\tgot: %s", resp.Header.Get("Retry-After"))
+	}
+
+	// The game in progress is still playable within the drain window
+	clk.BlockUntil(2)
+	clk.Advance(time.Second * 44)
+	writeMessage(t, hostConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 0}})
+	readMessage[mc.RespAttack](t, hostConn, mc.CodeAttack)
+	readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack)
+
+	clk.Advance(time.Second)
+	for _, conn := range []*websocket.Conn{hostConn, joinConn} {
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+			t.Fatalf("expected close error %d, got: %v", websocket.CloseServiceRestart, err)
+		}
+	}
+
+	// The session loops end on their own; the drain polls
+	// on every tick until they are gone
+	deadline := time.After(time.Second * 5)
+	for done := false; !done; {
+		clk.Advance(time.Second)
+		select {
+		case <-shutdownDone:
+			done = true
+		case <-deadline:
+			t.Fatal("shutdown did not return")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	if bsm.SessionCount() != 0 {
+		t.Fatalf("expected no sessions after shutdown, got: %d", bsm.SessionCount())
+	}
+}
+
+// Dials with the resume token and expects the server to refuse it
+func expectResumeRejected(t *testing.T, wsUrl, resumeToken string, expectedErrCode cerr.ErrCode) {
+	t.Helper()
+
+	conn, _, err := dialer.Dial(wsUrl+"?"+api.URLQueryResumeTokenKeyword+"="+resumeToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	expectErrCode(t, readMessage[mc.NoPayload](t, conn, mc.CodeReceivedInvalidSessionID), expectedErrCode)
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expected close error %d, got: %v", websocket.ClosePolicyViolation, err)
+	}
+}
+
+func TestResumeToken(t *testing.T) {
+	wsUrl := startTestServer(t, api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil))
+
+	hostConn, _ := dialSession(t, wsUrl)
+	joinConn, _ := dialSession(t, wsUrl)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy}})
+	respCreateGame := readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame)
+	hostToken := respCreateGame.Payload.ResumeToken
+	if hostToken == "" {
+		t.Fatal("expected a resume token for the host")
+	}
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqJoinGame]{Code: mc.CodeJoinGame, Payload: mc.ReqJoinGame{GameUuid: respCreateGame.Payload.GameUuid}})
+	if readMessage[mc.RespJoinGame](t, joinConn, mc.CodeJoinGame).Payload.ResumeToken == "" {
+		t.Fatal("expected a resume token for the join player")
+	}
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+	readyTestGame(t, hostConn, joinConn)
+
+	t.Run("forged token", func(t *testing.T) {
+		expectResumeRejected(t, wsUrl, hostToken[:len(hostToken)-4]+"AAAA", cerr.ErrCodeResumeTokenInvalid)
+		expectResumeRejected(t, wsUrl, "not-a-token", cerr.ErrCodeResumeTokenInvalid)
+	})
+
+	// Drop the host without a close frame, like a backgrounded app
+	hostConn.NetConn().Close()
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeOtherPlayerGracePeriod)
+
+	newHostConn, _, err := dialer.Dial(wsUrl+"?"+api.URLQueryResumeTokenKeyword+"="+hostToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newHostConn.Close()
+
+	respResumed := readMessage[mc.RespSessionResumed](t, newHostConn, mc.CodeSessionResumed)
+	if respResumed.Payload.ResumeToken == "" || respResumed.Payload.ResumeToken == hostToken {
+		t.Fatalf("expected a rotated resume token, got: %q", respResumed.Payload.ResumeToken)
+	}
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeOtherPlayerReconnected)
+
+	t.Run("replayed token", func(t *testing.T) {
+		expectResumeRejected(t, wsUrl, hostToken, cerr.ErrCodeResumeTokenReplayed)
+	})
+
+	// The game goes on over the new conn
+	writeMessage(t, newHostConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 0}})
+	readMessage[mc.RespAttack](t, newHostConn, mc.CodeAttack)
+	readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack)
+}
+
+func TestResumeTokenExpired(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	bsm := mc.NewBattleshipSessionManager().WithResumeTokenSigner(token.NewSigner([]byte("test-secret"), time.Minute).WithClock(clk))
+	wsUrl := startTestServer(t, api.NewRequestProcessor(bsm, mb.NewBattleshipGameManager(), nil))
+
+	hostConn, _ := dialSession(t, wsUrl)
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy}})
+	hostToken := readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame).Payload.ResumeToken
+
+	clk.Advance(time.Minute)
+	expectResumeRejected(t, wsUrl, hostToken, cerr.ErrCodeResumeTokenExpired)
+}
+
+// Drops the conn without a close frame (unless `keepOldConn`,
+// i.e. the server has not noticed the drop yet) and resumes
+// the session on a new conn
+func resumeTestSession(t *testing.T, wsUrl string, conn *websocket.Conn, resumeToken string, keepOldConn bool) (*websocket.Conn, mc.RespSessionResumed) {
+	t.Helper()
+
+	if !keepOldConn {
+		conn.NetConn().Close()
+	}
+
+	newConn, _, err := dialer.Dial(wsUrl+"?"+api.URLQueryResumeTokenKeyword+"="+resumeToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { newConn.Close() })
+
+	return newConn, readMessage[mc.RespSessionResumed](t, newConn, mc.CodeSessionResumed).Payload
+}
+
+// Creates and joins an easy game like setupTestGame but also returns the resume tokens
+func setupResumableTestGame(t *testing.T, wsUrl string) (hostConn, joinConn *websocket.Conn, hostToken, joinToken string) {
+	t.Helper()
+
+	hostConn, _ = dialSession(t, wsUrl)
+	joinConn, _ = dialSession(t, wsUrl)
+
+	writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy}})
+	respCreateGame := readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame)
+
+	writeMessage(t, joinConn, mc.Message[mc.ReqJoinGame]{Code: mc.CodeJoinGame, Payload: mc.ReqJoinGame{GameUuid: respCreateGame.Payload.GameUuid}})
+	respJoinGame := readMessage[mc.RespJoinGame](t, joinConn, mc.CodeJoinGame)
+	readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+	readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+
+	return hostConn, joinConn, respCreateGame.Payload.ResumeToken, respJoinGame.Payload.ResumeToken
+}
+
+// Host sinks every ship of testDefenceGridEasy while join only misses
+func playTestGameToHostWin(t *testing.T, hostConn, joinConn *websocket.Conn) {
+	t.Helper()
+
+	playTestGameToWin(t, hostConn, joinConn)
+}
+
+// The winner has the first turn; both players use testDefenceGridEasy
+func playTestGameToWin(t *testing.T, winnerConn, loserConn *websocket.Conn) (winnerEndGame, loserEndGame mc.RespEndGame) {
+	t.Helper()
+
+	var winnerTargets, loserTargets []mc.ReqAttack
+	for x, row := range testDefenceGridEasy {
+		for y, state := range row {
+			if state != 0 {
+				winnerTargets = append(winnerTargets, mc.ReqAttack{X: uint8(x), Y: uint8(y)})
+			} else {
+				loserTargets = append(loserTargets, mc.ReqAttack{X: uint8(x), Y: uint8(y)})
+			}
+		}
+	}
+
+	for i, target := range winnerTargets {
+		writeMessage(t, winnerConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: target})
+		readMessage[mc.RespAttack](t, winnerConn, mc.CodeAttack)
+		readMessage[mc.RespAttack](t, loserConn, mc.CodeAttack)
+
+		if i == len(winnerTargets)-1 {
+			break
+		}
+
+		writeMessage(t, loserConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: loserTargets[i]})
+		readMessage[mc.RespAttack](t, loserConn, mc.CodeAttack)
+		readMessage[mc.RespAttack](t, winnerConn, mc.CodeAttack)
+	}
+
+	winnerEndGame = readMessage[mc.RespEndGame](t, winnerConn, mc.CodeEndGame).Payload
+	loserEndGame = readMessage[mc.RespEndGame](t, loserConn, mc.CodeEndGame).Payload
+	return winnerEndGame, loserEndGame
+}
+
+func TestReconnectDuringGamePhases(t *testing.T) {
+	// Every phase opens new sessions from the same IP
+	rp := api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil).
+		WithRateLimitConfig(api.RateLimitConfig{})
+	wsUrl := startTestServer(t, rp)
+
+	t.Run("waiting for opponent", func(t *testing.T) {
+		hostConn, _ := dialSession(t, wsUrl)
+		writeMessage(t, hostConn, mc.Message[mc.ReqCreateGame]{Code: mc.CodeCreateGame, Payload: mc.ReqCreateGame{GameDifficulty: mb.GameDifficultyEasy}})
+		respCreateGame := readMessage[mc.RespCreateGame](t, hostConn, mc.CodeCreateGame)
+
+		hostConn, _ = resumeTestSession(t, wsUrl, hostConn, respCreateGame.Payload.ResumeToken, false)
+
+		joinConn, _ := dialSession(t, wsUrl)
+		writeMessage(t, joinConn, mc.Message[mc.ReqJoinGame]{Code: mc.CodeJoinGame, Payload: mc.ReqJoinGame{GameUuid: respCreateGame.Payload.GameUuid}})
+		readMessage[mc.RespJoinGame](t, joinConn, mc.CodeJoinGame)
+		readMessage[mc.NoPayload](t, joinConn, mc.CodeSelectGrid)
+		readMessage[mc.NoPayload](t, hostConn, mc.CodeSelectGrid)
+	})
+
+	t.Run("selecting grid", func(t *testing.T) {
+		hostConn, joinConn, _, joinToken := setupResumableTestGame(t, wsUrl)
+
+		joinConn, _ = resumeTestSession(t, wsUrl, joinConn, joinToken, false)
+		readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerGracePeriod)
+		readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerReconnected)
+
+		readyTestGame(t, hostConn, joinConn)
+	})
+
+	t.Run("in progress", func(t *testing.T) {
+		hostConn, joinConn, hostToken, _ := setupResumableTestGame(t, wsUrl)
+		readyTestGame(t, hostConn, joinConn)
+
+		hostConn, _ = resumeTestSession(t, wsUrl, hostConn, hostToken, false)
+		readMessage[mc.NoPayload](t, joinConn, mc.CodeOtherPlayerGracePeriod)
+		readMessage[mc.NoPayload](t, joinConn, mc.CodeOtherPlayerReconnected)
+
+		writeMessage(t, hostConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 0}})
+		readMessage[mc.RespAttack](t, hostConn, mc.CodeAttack)
+		readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack)
+	})
+
+	// The client reconnects before the server sees the old
+	// conn fail; the handoff has to close it
+	t.Run("in progress, drop not noticed", func(t *testing.T) {
+		hostConn, joinConn, hostToken, _ := setupResumableTestGame(t, wsUrl)
+		readyTestGame(t, hostConn, joinConn)
+
+		oldHostConn := hostConn
+		hostConn, _ = resumeTestSession(t, wsUrl, hostConn, hostToken, true)
+		if _, _, err := oldHostConn.ReadMessage(); err == nil {
+			t.Fatal("expected the old conn to be closed by the server")
+		}
+		readMessage[mc.NoPayload](t, joinConn, mc.CodeOtherPlayerGracePeriod)
+		readMessage[mc.NoPayload](t, joinConn, mc.CodeOtherPlayerReconnected)
+
+		writeMessage(t, hostConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 0}})
+		readMessage[mc.RespAttack](t, hostConn, mc.CodeAttack)
+		readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack)
+	})
+
+	t.Run("in progress, events missed", func(t *testing.T) {
+		hostConn, joinConn, _, joinToken := setupResumableTestGame(t, wsUrl)
+		readyTestGame(t, hostConn, joinConn)
+
+		joinConn.NetConn().Close()
+		readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerGracePeriod)
+
+		writeMessage(t, hostConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 0}})
+		readMessage[mc.RespAttack](t, hostConn, mc.CodeAttack)
+
+		joinConn, respResumed := resumeTestSession(t, wsUrl, joinConn, joinToken, true)
+		readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerReconnected)
+
+		writeMessage(t, joinConn, mc.Message[mc.ReqReplayEvents]{Code: mc.CodeReplayEvents, Payload: mc.ReqReplayEvents{LastSeq: respResumed.LastSeq - 1}})
+		if replayed := readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack); replayed.Seq != respResumed.LastSeq {
+			t.Fatalf("expected seq: %d\tgot: %d", respResumed.LastSeq, replayed.Seq)
+		}
+		readMessage[mc.RespReplayEvents](t, joinConn, mc.CodeReplayEvents)
+	})
+
+	t.Run("game over", func(t *testing.T) {
+		hostConn, joinConn, _, joinToken := setupResumableTestGame(t, wsUrl)
+		readyTestGame(t, hostConn, joinConn)
+		playTestGameToHostWin(t, hostConn, joinConn)
+
+		joinConn, _ = resumeTestSession(t, wsUrl, joinConn, joinToken, false)
+		readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerGracePeriod)
+		readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerReconnected)
+
+		writeMessage(t, hostConn, mc.Message[mc.NoPayload]{Code: mc.CodeRematchCall})
+		readMessage[mc.NoPayload](t, joinConn, mc.CodeRematchCall)
+	})
+}
+
+func TestSessionExpiry(t *testing.T) {
+	// Starts a sweeper on a fake clock; it must stop once the test ends
+	startExpiringServer := func(t *testing.T, cfg mc.ExpiryConfig) (string, *clock.Fake, *mb.BattleshipGameManager) {
+		clk := clock.NewFake(time.Now())
+		bgm := mb.NewBattleshipGameManager()
+		bsm := mc.NewBattleshipSessionManager().WithClock(clk).WithExpiryConfig(cfg)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		sweeperDone := make(chan struct{})
+		go func() {
+			bsm.CleanupPeriodically(ctx, bgm)
+			close(sweeperDone)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			select {
+			case <-sweeperDone:
+			case <-time.After(time.Second):
+				t.Error("sweeper did not stop")
+			}
+		})
+
+		clk.BlockUntil(1)
+		return startTestServer(t, api.NewRequestProcessor(bsm, bgm, nil)), clk, bgm
+	}
+
+	expectExpired := func(t *testing.T, conn *websocket.Conn, expectedReason string) {
+		t.Helper()
+
+		msg := readMessage[mc.RespSessionExpired](t, conn, mc.CodeSessionExpired)
+		if msg.Payload.Reason != expectedReason {
+			t.Fatalf("expected reason: %s\tgot: %s", expectedReason, msg.Payload.Reason)
+		}
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			t.Fatalf("expected close error %d, got: %v", websocket.CloseNormalClosure, err)
+		}
+	}
+
+	t.Run("idle", func(t *testing.T) {
+		wsUrl, clk, bgm := startExpiringServer(t, mc.ExpiryConfig{IdleTimeout: time.Minute * 10, MaxLifetime: time.Hour, SweepInterval: time.Minute})
+
+		hostConn, joinConn, gameUuid := setupTestGame(t, wsUrl)
+		readyTestGame(t, hostConn, joinConn)
+
+		// Only the host is active after this
+		clk.Advance(time.Minute * 6)
+		writeMessage(t, hostConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 0}})
+		readMessage[mc.RespAttack](t, hostConn, mc.CodeAttack)
+		readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack)
+
+		clk.Advance(time.Minute * 5)
+		expectExpired(t, joinConn, mc.ExpiryReasonIdle)
+		readMessage[mc.NoPayload](t, hostConn, mc.CodeOtherPlayerDisconnected)
+
+		if _, err := bgm.FetchGame(gameUuid); err == nil {
+			t.Fatal("expected the game of the expired session to be terminated")
+		}
+	})
+
+	t.Run("max lifetime", func(t *testing.T) {
+		wsUrl, clk, _ := startExpiringServer(t, mc.ExpiryConfig{IdleTimeout: time.Minute * 10, MaxLifetime: time.Minute * 30, SweepInterval: time.Minute})
+
+		conn, _ := dialSession(t, wsUrl)
+		// Never idle but alive for 31 minutes in the end
+		for range 3 {
+			clk.Advance(time.Minute * 8)
+			writeMessage(t, conn, mc.Message[mc.ReqReplayEvents]{Code: mc.CodeReplayEvents})
+			readMessage[mc.RespReplayEvents](t, conn, mc.CodeReplayEvents)
+		}
+
+		clk.Advance(time.Minute * 7)
+		expectExpired(t, conn, mc.ExpiryReasonMaxLifetime)
+	})
+}
+
+func TestGracePeriod(t *testing.T) {
+	// The grace timer is the only one on the clock, there is no sweeper
+	startGraceServer := func(t *testing.T) (string, *clock.Fake) {
+		clk := clock.NewFake(time.Now())
+		bsm := mc.NewBattleshipSessionManager().WithClock(clk)
+		return startTestServer(t, api.NewRequestProcessor(bsm, mb.NewBattleshipGameManager(), nil)), clk
+	}
+
+	t.Run("expires", func(t *testing.T) {
+		wsUrl, clk := startGraceServer(t)
+		hostConn, joinConn, hostToken, _ := setupResumableTestGame(t, wsUrl)
+		readyTestGame(t, hostConn, joinConn)
+
+		hostConn.NetConn().Close()
+		readMessage[mc.NoPayload](t, joinConn, mc.CodeOtherPlayerGracePeriod)
+
+		clk.BlockUntil(1)
+		clk.Advance(mc.DefaultSessionConfig().GracePeriod)
+		readMessage[mc.NoPayload](t, joinConn, mc.CodeOtherPlayerDisconnected)
+
+		expectResumeRejected(t, wsUrl, hostToken, cerr.ErrCodeSessionNotFound)
+	})
+
+	t.Run("reconnect just in time", func(t *testing.T) {
+		wsUrl, clk := startGraceServer(t)
+		hostConn, joinConn, hostToken, _ := setupResumableTestGame(t, wsUrl)
+		readyTestGame(t, hostConn, joinConn)
+
+		hostConn.NetConn().Close()
+		readMessage[mc.NoPayload](t, joinConn, mc.CodeOtherPlayerGracePeriod)
+
+		clk.BlockUntil(1)
+		clk.Advance(mc.DefaultSessionConfig().GracePeriod - time.Millisecond)
+		hostConn, _ = resumeTestSession(t, wsUrl, hostConn, hostToken, true)
+		readMessage[mc.NoPayload](t, joinConn, mc.CodeOtherPlayerReconnected)
+
+		// The stopped grace timer must not end the session later
+		clk.Advance(mc.DefaultSessionConfig().GracePeriod)
+		writeMessage(t, hostConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 0}})
+		readMessage[mc.RespAttack](t, hostConn, mc.CodeAttack)
+		readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack)
+	})
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	wsUrl := startTestServer(t, api.NewRequestProcessor(mc.NewBattleshipSessionManager(), mb.NewBattleshipGameManager(), nil))
+
+	hostConn, joinConn, _ := setupTestGame(t, wsUrl)
+	readyTestGame(t, hostConn, joinConn)
+
+	// Out of turn, counted by its error code
+	writeMessage(t, joinConn, mc.Message[mc.ReqAttack]{Code: mc.CodeAttack, Payload: mc.ReqAttack{X: 0, Y: 0}})
+	readMessage[mc.RespAttack](t, joinConn, mc.CodeAttack)
+
+	playTestGameToHostWin(t, hostConn, joinConn)
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("unexpected content type: %s", rec.Header().Get("Content-Type"))
+	}
+
+	for _, expected := range []string{
+		"# TYPE battleship_sessions_active gauge",
+		`battleship_games_active{difficulty="easy"}`,
+		"battleship_games_waiting_for_opponent",
+		`battleship_games_created_total{difficulty="easy"}`,
+		`battleship_games_finished_total{difficulty="easy"}`,
+		"battleship_attacks_total",
+		`battleship_errors_total{code="not_turn_for_attacker"}`,
+		`battleship_message_handling_seconds_bucket{signal="7",le="+Inf"}`,
+		"# TYPE battleship_match_duration_seconds histogram",
+		"battleship_match_duration_seconds_count",
+	} {
+		if !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("expected %q in metrics:\n%s", expected, rec.Body.String())
+		}
+	}
+}